@@ -0,0 +1,233 @@
+package tuf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/keys"
+)
+
+const (
+	// hashedBinsRole is the base name of the delegation, reserved for
+	// CreateHashedBins, that a split role delegates to and that in turn
+	// delegates to each of the hashed bins
+	hashedBinsRole = "hashed-bins"
+	// hashedBinPrefix begins the base name of every hashed bin role
+	hashedBinPrefix = "bin-"
+	// MaxHashedBins is the largest number of hashed bins a role may be
+	// split into
+	MaxHashedBins = 1 << 16
+)
+
+// ErrInvalidBinCount - the number of hashed bins requested is not a power
+// of 2 between 1 and MaxHashedBins
+type ErrInvalidBinCount struct {
+	count int
+}
+
+func (err ErrInvalidBinCount) Error() string {
+	return fmt.Sprintf("invalid number of hashed bins %d, must be a power of 2 no larger than %d", err.count, MaxHashedBins)
+}
+
+// CreateHashedBins splits the targets of role into numBins delegated roles,
+// each responsible for an equal share of the possible target path hashes by
+// way of its PathHashPrefixes. The bins are delegated to by a single
+// delegation of role named "hashed-bins", which is reserved for them. It and
+// every bin are signed by the given keys with the given threshold. Targets
+// already in role, or in any bins it was previously split into, are moved
+// into the new bins, and any previous bins are removed. Once a role has been
+// split, AddTargets and RemoveTargets on it act on the appropriate bin.
+// Calling CreateHashedBins with the number of bins the role already has is
+// a no-op.
+//
+// Bin names are reused when a role is split again, so the new bins and
+// "hashed-bins" start from the highest version any of the previous ones
+// had. As "hashed-bins" is never removed this is at least the version any
+// bin of that name has ever had, and clients will not see a rollback.
+func (tr *Repo) CreateHashedBins(role string, numBins int, binKeys []data.PublicKey, threshold int) error {
+	if numBins < 1 || numBins > MaxHashedBins || numBins&(numBins-1) != 0 {
+		return ErrInvalidBinCount{count: numBins}
+	}
+	if threshold < 1 || threshold > len(binKeys) {
+		return keys.ErrInvalidThreshold
+	}
+	t, ok := tr.Targets[role]
+	if !ok {
+		return ErrNotLoaded{role: role}
+	}
+	old := tr.hashedBins(role)
+	if len(old) == numBins {
+		return nil
+	}
+	logrus.Debugf("splitting %s into %d hashed bins, replacing %d", role, numBins, len(old))
+
+	// gather every target currently held by the role and its bins, and the
+	// highest version of the bins' roles
+	moved := make(data.Files)
+	for p, meta := range t.Signed.Targets {
+		moved[p] = meta
+	}
+	version := 0
+	for _, b := range old {
+		bt, ok := tr.Targets[b.Name]
+		if !ok {
+			return ErrNotLoaded{role: b.Name}
+		}
+		for p, meta := range bt.Signed.Targets {
+			moved[p] = meta
+		}
+		if bt.Signed.Version > version {
+			version = bt.Signed.Version
+		}
+	}
+
+	parent, err := data.NewRole(path.Join(role, hashedBinsRole), threshold, nil, []string{""}, nil)
+	if err != nil {
+		return err
+	}
+	bins, err := hashedBinRoles(parent.Name, numBins, threshold)
+	if err != nil {
+		return err
+	}
+	ks := make([]data.Key, 0, len(binKeys))
+	for _, k := range binKeys {
+		ks = append(ks, k)
+	}
+
+	// the old bins are removed along with the delegation to them
+	if pt, ok := tr.Targets[parent.Name]; ok {
+		if pt.Signed.Version > version {
+			version = pt.Signed.Version
+		}
+		tr.removeDelegations(parent.Name, old)
+		tr.removeDelegations(role, []*data.Role{parent})
+	}
+	for _, r := range append([]*data.Role{parent}, bins...) {
+		if err := tr.updateDelegations(r, ks, ""); err != nil {
+			return err
+		}
+		tr.Targets[r.Name].Signed.Version = version
+	}
+	t.Signed.Targets = make(data.Files)
+	t.Dirty = true
+
+	// between them the bins cover every possible path hash
+	for p, meta := range moved {
+		pathDigest := sha256.Sum256([]byte(p))
+		bt := tr.binTargets(bins, hex.EncodeToString(pathDigest[:]))
+		bt.Signed.Targets[p] = meta
+	}
+	return nil
+}
+
+// hashedBins returns the hashed bins role was split into by
+// CreateHashedBins, in the order they are delegated.
+func (tr Repo) hashedBins(role string) []*data.Role {
+	t, ok := tr.Targets[path.Join(role, hashedBinsRole)]
+	if !ok {
+		return nil
+	}
+	var bins []*data.Role
+	for _, r := range t.Signed.Delegations.Roles {
+		if len(r.PathHashPrefixes) > 0 {
+			bins = append(bins, r)
+		}
+	}
+	return bins
+}
+
+// reservedRoleName indicates whether the name of the delegation is, or is
+// beneath, one reserved for the hashed bins of a role
+func reservedRoleName(name string) bool {
+	for _, seg := range strings.Split(name, "/") {
+		if seg == hashedBinsRole {
+			return true
+		}
+	}
+	return false
+}
+
+// binTargets returns the targets of the bin responsible for the given
+// path hash, or nil if there is no such bin or it is not loaded.
+func (tr Repo) binTargets(bins []*data.Role, pathHex string) *data.SignedTargets {
+	for _, b := range bins {
+		if b.CheckPrefixes(pathHex) {
+			return tr.Targets[b.Name]
+		}
+	}
+	return nil
+}
+
+// removeDelegations removes the given delegations of role along with their
+// targets, any snapshot meta recorded for them and their entries in the
+// keysDB. Keys no longer used by any remaining delegation of role are
+// removed from it.
+func (tr *Repo) removeDelegations(role string, remove []*data.Role) {
+	if len(remove) == 0 {
+		return
+	}
+	names := make(map[string]struct{}, len(remove))
+	for _, r := range remove {
+		names[r.Name] = struct{}{}
+		delete(tr.Targets, r.Name)
+		tr.keysDB.RemoveRole(r.Name)
+		if tr.Snapshot != nil {
+			delete(tr.Snapshot.Signed.Meta, r.Name)
+			tr.Snapshot.Dirty = true
+		}
+	}
+	p := tr.Targets[role]
+	keep := make([]*data.Role, 0, len(p.Signed.Delegations.Roles))
+	used := make(map[string]struct{})
+	for _, r := range p.Signed.Delegations.Roles {
+		if _, ok := names[r.Name]; !ok {
+			keep = append(keep, r)
+			for _, id := range r.KeyIDs {
+				used[id] = struct{}{}
+			}
+		}
+	}
+	for id := range p.Signed.Delegations.Keys {
+		if _, ok := used[id]; !ok {
+			delete(p.Signed.Delegations.Keys, id)
+		}
+	}
+	p.Signed.Delegations.Roles = keep
+	p.Dirty = true
+}
+
+// hashedBinRoles builds the roles for numBins bins beneath parent. The hex
+// prefixes used are the shortest that can be shared equally between the
+// bins, so each bin is given one or more consecutive prefixes of that
+// length. numBins must be a power of 2.
+func hashedBinRoles(parent string, numBins, threshold int) ([]*data.Role, error) {
+	prefixLen, numPrefixes := 1, 16
+	for numPrefixes < numBins {
+		prefixLen++
+		numPrefixes *= 16
+	}
+	perBin := numPrefixes / numBins
+
+	roles := make([]*data.Role, 0, numBins)
+	for i := 0; i < numBins; i++ {
+		prefixes := make([]string, 0, perBin)
+		for j := i * perBin; j < (i+1)*perBin; j++ {
+			prefixes = append(prefixes, fmt.Sprintf("%0*x", prefixLen, j))
+		}
+		name := hashedBinPrefix + prefixes[0]
+		if perBin > 1 {
+			name = fmt.Sprintf("%s-%s", name, prefixes[perBin-1])
+		}
+		r, err := data.NewRole(path.Join(parent, name), threshold, nil, nil, prefixes)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, r)
+	}
+	return roles, nil
+}
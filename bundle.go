@@ -0,0 +1,154 @@
+package tuf
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/keys"
+	"github.com/endophage/gotuf/signed"
+)
+
+// ErrWrongBundleRole - a signing request was imported for a role other
+// than the one the import is for
+type ErrWrongBundleRole struct {
+	expected string
+	actual   string
+}
+
+func (err ErrWrongBundleRole) Error() string {
+	return fmt.Sprintf("signing request is for %s, expected %s", err.actual, err.expected)
+}
+
+// SigningRequest is a bundle carrying metadata to be signed on an offline,
+// or air-gapped, machine and back again. It is serialized as JSON.
+//
+// Signed holds the exact canonical bytes to sign. Keys and Threshold
+// are the public keys, by key ID, expected to sign and how many of them must, as known to the
+// exporting repo, and Summary describes, one change per line, how the
+// metadata differs from what was previously published. Only Signed is
+// covered by the signatures, the rest is informational: a repo importing
+// the bundle verifies it against its own keys.
+type SigningRequest struct {
+	Role       string                  `json:"role"`
+	Signed     []byte                  `json:"signed"`
+	Keys       map[string]*data.TUFKey `json:"keys"`
+	Threshold  int                     `json:"threshold"`
+	Summary    []string                `json:"summary"`
+	Signatures []data.Signature        `json:"signatures,omitempty"`
+}
+
+// Sign adds a signature from each of the expected keys the CryptoService
+// holds, replacing any previous signature by the same key. As with all
+// signing, it goes through signed.Sign so that the CryptoService is asked
+// for the canonical ID of keys, such as x509 keys, that are scoped.
+func (r *SigningRequest) Sign(cryptoService signed.CryptoService) error {
+	keys := make([]data.PublicKey, 0, len(r.Keys))
+	for _, k := range r.Keys {
+		keys = append(keys, k)
+	}
+	s := &data.Signed{Signed: r.Signed, Signatures: r.Signatures}
+	if err := signed.Sign(cryptoService, s, keys...); err != nil {
+		return err
+	}
+	r.Signatures = s.Signatures
+	return nil
+}
+
+// ExportRootSigningRequest returns a SigningRequest for the root with the
+// next version and the given expiry. Unlike SignRoot, the repo's root is
+// left untouched; the new root is applied by ImportRootSigningRequest once
+// signed. previous is the root last published, to summarize the changes
+// against, and may be nil if there is none.
+func (tr *Repo) ExportRootSigningRequest(expires time.Time, previous *data.SignedRoot) (*SigningRequest, error) {
+	if tr.Root == nil {
+		return nil, ErrNotLoaded{role: "root"}
+	}
+	role := tr.keysDB.GetRole(data.ValidRoles["root"])
+	if role == nil {
+		return nil, keys.ErrInvalidRole
+	}
+	root := &data.SignedRoot{Signed: tr.Root.Signed}
+	root.Signed.Expires = expires
+	root.Signed.Version++
+	s, err := root.ToSigned()
+	if err != nil {
+		return nil, err
+	}
+	var prev *data.Root
+	if previous != nil {
+		prev = &previous.Signed
+	}
+	summary := []string{}
+	if d := DiffRoot(prev, &root.Signed); d != nil {
+		summary = d.Summary()
+	}
+	keys := make(map[string]*data.TUFKey)
+	for _, id := range role.KeyIDs {
+		k := tr.keysDB.GetKey(id)
+		if k == nil {
+			continue
+		}
+		keys[id] = data.NewPublicKey(k.Algorithm(), k.Public()).(*data.TUFKey)
+	}
+	return &SigningRequest{
+		Role:      data.ValidRoles["root"],
+		Signed:    s.Signed,
+		Keys:      keys,
+		Threshold: role.Threshold,
+		Summary:   summary,
+	}, nil
+}
+
+// ImportRootSigningRequest applies the root from a signed SigningRequest.
+// The root must be newer than the repo's root and be signed by a
+// threshold of the root keys in the repo's KeyDB, as well as by a
+// threshold of the root keys it declares itself so that it can verify its
+// own successor. Nothing is applied if any check fails. As with SignRoot,
+// the root must then be captured in the snapshot, and Publish writes it
+// as a versioned root.
+func (tr *Repo) ImportRootSigningRequest(req *SigningRequest) error {
+	if req.Role != data.ValidRoles["root"] {
+		return ErrWrongBundleRole{expected: data.ValidRoles["root"], actual: req.Role}
+	}
+	s := &data.Signed{Signed: req.Signed, Signatures: req.Signatures}
+	minVersion := 1
+	if tr.Root != nil {
+		minVersion = tr.Root.Signed.Version + 1
+	}
+	expiry := signed.ExpiryChecker{Clock: tr.clock}
+	if err := signed.VerifyWithExpiry(s, data.ValidRoles["root"], minVersion, tr.keysDB, expiry); err != nil {
+		return err
+	}
+	root, err := data.RootFromSigned(s)
+	if err != nil {
+		return err
+	}
+	db := keys.NewDB()
+	for _, k := range root.Signed.Keys {
+		db.AddKey(k)
+	}
+	for name, r := range root.Signed.Roles {
+		role, err := data.NewRole(name, r.Threshold, r.KeyIDs, nil, nil)
+		if err != nil {
+			return err
+		}
+		if err := db.AddRole(role); err != nil {
+			return err
+		}
+	}
+	if err := signed.VerifySignatures(s, data.ValidRoles["root"], db); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := tr.SetRoot(root); err != nil {
+		return err
+	}
+	tr.Root.Dirty = true
+	tr.signedRoots[tr.Root.Signed.Version] = raw
+	return nil
+}
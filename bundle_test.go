@@ -0,0 +1,202 @@
+package tuf
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/docker/notary/trustmanager"
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/keys"
+	"github.com/endophage/gotuf/signed"
+	"github.com/endophage/gotuf/store"
+	"github.com/endophage/gotuf/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRootSigningRequestRoundTrip(t *testing.T) {
+	offline := signed.NewEd25519()
+	repo := initRepo(t, offline, keys.NewDB())
+	published := *repo.Root
+	expires := time.Now().Add(24 * time.Hour).Round(time.Second)
+
+	req, err := repo.ExportRootSigningRequest(expires, &published)
+	assert.NoError(t, err)
+	// exporting has no side effects on the repo
+	assert.Equal(t, published.Signed.Version, repo.Root.Signed.Version)
+	assert.Equal(t, published.Signed.Expires, repo.Root.Signed.Expires)
+	assert.Equal(t, "root", req.Role)
+	rootKeyID := repo.keysDB.GetRole("root").KeyIDs[0]
+	assert.Len(t, req.Keys, 1)
+	assert.Equal(t, repo.keysDB.GetKey(rootKeyID).Public(), req.Keys[rootKeyID].Public())
+	assert.Equal(t, 1, req.Threshold)
+	assert.Len(t, req.Summary, 2)
+	assert.Equal(t, "version 0 -> 1", req.Summary[0])
+
+	// the bundle travels to the offline machine and back as JSON
+	raw, err := json.Marshal(req)
+	assert.NoError(t, err)
+	signedReq := &SigningRequest{}
+	assert.NoError(t, json.Unmarshal(raw, signedReq))
+	assert.NoError(t, signedReq.Sign(offline))
+	assert.NoError(t, signedReq.Sign(offline))
+	assert.Len(t, signedReq.Signatures, 1)
+
+	assert.NoError(t, repo.ImportRootSigningRequest(signedReq))
+	assert.Equal(t, 1, repo.Root.Signed.Version)
+	assert.True(t, expires.Equal(repo.Root.Signed.Expires))
+	assert.True(t, repo.Root.Dirty)
+	s, err := repo.Root.ToSigned()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(s.Signed), req.Signed)
+	assert.NoError(t, signed.Verify(s, "root", 1, repo.keysDB))
+
+	// the same bundle cannot be applied again
+	err = repo.ImportRootSigningRequest(signedReq)
+	assert.IsType(t, signed.ErrLowVersion{}, err)
+}
+
+func TestRootSigningRequestRejected(t *testing.T) {
+	offline := signed.NewEd25519()
+	repo := initRepo(t, offline, keys.NewDB())
+	published := *repo.Root
+	req, err := repo.ExportRootSigningRequest(data.DefaultExpires("root"), &published)
+	assert.NoError(t, err)
+
+	assert.Equal(t, signed.ErrNoSignatures, repo.ImportRootSigningRequest(req))
+
+	// signed by a key that is not a root key
+	other := signed.NewEd25519()
+	k, err := other.Create("root", data.ED25519Key)
+	assert.NoError(t, err)
+	wrongKey := *req
+	wrongKey.Keys = map[string]*data.TUFKey{k.ID(): k.(*data.TUFKey)}
+	assert.NoError(t, wrongKey.Sign(other))
+	err = repo.ImportRootSigningRequest(&wrongKey)
+	assert.IsType(t, signed.ErrRoleThreshold{}, err)
+	assert.Equal(t, signed.SignatureKeyNotInRole, err.(signed.ErrRoleThreshold).Report.Signatures[0].Outcome)
+
+	// the signed bytes were altered after signing
+	tampered := *req
+	tampered.Signatures = nil
+	assert.NoError(t, tampered.Sign(offline))
+	var root data.Root
+	assert.NoError(t, json.Unmarshal(tampered.Signed, &root))
+	root.ConsistentSnapshot = true
+	tampered.Signed, err = json.Marshal(root)
+	assert.NoError(t, err)
+	err = repo.ImportRootSigningRequest(&tampered)
+	assert.IsType(t, signed.ErrRoleThreshold{}, err)
+	assert.Equal(t, signed.SignatureInvalid, err.(signed.ErrRoleThreshold).Report.Signatures[0].Outcome)
+
+	wrongRole := *req
+	wrongRole.Role = "targets"
+	assert.IsType(t, ErrWrongBundleRole{}, repo.ImportRootSigningRequest(&wrongRole))
+
+	assert.Equal(t, 0, repo.Root.Signed.Version)
+	assert.False(t, repo.Root.Signed.ConsistentSnapshot)
+}
+
+func TestRootSigningRequestKeyRotation(t *testing.T) {
+	offline := signed.NewEd25519()
+	repo := initRepo(t, offline, keys.NewDB())
+	published := *repo.Root
+	published.Signed.Keys = map[string]*data.TUFKey{}
+	for id, k := range repo.Root.Signed.Keys {
+		published.Signed.Keys[id] = k
+	}
+	published.Signed.Roles = map[string]*data.RootRole{}
+	for name, role := range repo.Root.Signed.Roles {
+		r := *role
+		published.Signed.Roles[name] = &r
+	}
+
+	newKey, err := offline.Create("root", data.ED25519Key)
+	assert.NoError(t, err)
+	assert.NoError(t, repo.AddBaseKeys("root", newKey))
+
+	req, err := repo.ExportRootSigningRequest(data.DefaultExpires("root"), &published)
+	assert.NoError(t, err)
+	assert.Contains(t, req.Summary, "key added "+newKey.ID()+" (ed25519)")
+	assert.Contains(t, req.Summary, "root key added "+newKey.ID())
+
+	assert.NoError(t, req.Sign(offline))
+	assert.NoError(t, repo.ImportRootSigningRequest(req))
+	assert.Len(t, repo.Root.Signed.Roles["root"].KeyIDs, 2)
+}
+
+// canonicalOnlyCryptoService only signs with the canonical ID of its key
+type canonicalOnlyCryptoService struct {
+	signed.CryptoService
+	canonicalID string
+}
+
+func (c canonicalOnlyCryptoService) Sign(keyIDs []string, _ []byte) ([]data.Signature, error) {
+	sigs := []data.Signature{}
+	for _, id := range keyIDs {
+		if id == c.canonicalID {
+			sigs = append(sigs, data.Signature{KeyID: id, Method: data.RSAPSSSignature})
+		}
+	}
+	return sigs, nil
+}
+
+func TestSigningRequestSignScopedKey(t *testing.T) {
+	privKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+	template, err := trustmanager.NewCertificate("test")
+	assert.NoError(t, err)
+	derBytes, err := x509.CreateCertificate(
+		rand.Reader, template, template, &privKey.PublicKey, privKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(derBytes)
+	assert.NoError(t, err)
+	certKey := trustmanager.CertToKey(cert)
+	canonicalID, err := utils.CanonicalKeyID(certKey)
+	assert.NoError(t, err)
+	assert.NotEqual(t, certKey.ID(), canonicalID)
+
+	req := &SigningRequest{
+		Role:   "root",
+		Signed: []byte("{}"),
+		Keys:   map[string]*data.TUFKey{certKey.ID(): certKey.(*data.TUFKey)},
+	}
+	assert.NoError(t, req.Sign(canonicalOnlyCryptoService{canonicalID: canonicalID}))
+	assert.Len(t, req.Signatures, 1)
+	assert.Equal(t, certKey.ID(), req.Signatures[0].KeyID)
+}
+
+func TestRootSigningRequestPublished(t *testing.T) {
+	offline := signed.NewEd25519()
+	repo := initRepo(t, offline, keys.NewDB())
+	signAll(t, repo)
+	metaStore := store.NewMemoryStore(nil, nil)
+	_, err := repo.Publish(metaStore)
+	assert.NoError(t, err)
+
+	// a root imported but superseded before being published is written too
+	for i := 0; i < 2; i++ {
+		req, err := repo.ExportRootSigningRequest(data.DefaultExpires("root"), nil)
+		assert.NoError(t, err)
+		assert.NoError(t, req.Sign(offline))
+		assert.NoError(t, repo.ImportRootSigningRequest(req))
+	}
+	_, err = repo.SignSnapshot(data.DefaultExpires("snapshot"), nil)
+	assert.NoError(t, err)
+	_, err = repo.SignTimestamp(data.DefaultExpires("timestamp"), nil)
+	assert.NoError(t, err)
+	_, err = repo.Publish(metaStore)
+	assert.NoError(t, err)
+
+	for version := 1; version <= 3; version++ {
+		raw, err := metaStore.GetMeta(fmt.Sprintf("%d.root", version), 5<<20)
+		assert.NoError(t, err)
+		s := &data.Signed{}
+		assert.NoError(t, json.Unmarshal(raw, s))
+		assert.NoError(t, signed.Verify(s, "root", version, repo.keysDB))
+	}
+}
@@ -0,0 +1,258 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Sirupsen/logrus"
+	tuf "github.com/endophage/gotuf"
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/keys"
+	"github.com/endophage/gotuf/signed"
+	"github.com/endophage/gotuf/store"
+)
+
+// rootPinName is the name the root key pin made on first use is persisted
+// under in the client's cache
+const rootPinName = "root-pin"
+
+// BootstrapMode establishes trust in the first root a client sees, in place
+// of a KeyDB populated by hand. It is one of PinnedRootHash, PinnedRootKeys
+// or TrustOnFirstUse.
+type BootstrapMode interface {
+	// rootName is the name of the root file to fetch
+	rootName(c *Client) (string, error)
+	// check decides whether the root, which has already been verified
+	// against the root role it declares, is trusted
+	check(c *Client, raw []byte, s *data.Signed, root *data.SignedRoot) error
+	// accepted is called once the client has taken on the checked root
+	accepted(c *Client, root *data.SignedRoot) error
+}
+
+// PinnedRootHash trusts the root file with the given sha256 hash. If
+// Version is not 0 that version of the root is fetched, as
+// <Version>.root.json, so the pin remains valid after the root is rotated.
+// Otherwise the current root.json must match.
+type PinnedRootHash struct {
+	Version int
+	Sha256  []byte
+}
+
+func (p PinnedRootHash) rootName(c *Client) (string, error) {
+	return versionedRootName(p.Version), nil
+}
+
+func (p PinnedRootHash) check(c *Client, raw []byte, s *data.Signed, root *data.SignedRoot) error {
+	actual := sha256.Sum256(raw)
+	if !bytes.Equal(actual[:], p.Sha256) {
+		return ErrRootHashMismatch{Expected: p.Sha256, Actual: actual[:]}
+	}
+	return nil
+}
+
+func (p PinnedRootHash) accepted(c *Client, root *data.SignedRoot) error {
+	return nil
+}
+
+// PinnedRootKeys trusts the root if it is signed by Threshold of the root
+// keys with the given IDs. The keys themselves are taken from the root. If
+// Version is not 0 that version of the root is fetched, as
+// <Version>.root.json, and Update walks the published roots forward from it
+// so the pin remains valid after the root keys are rotated. Otherwise the
+// current root.json must be signed by the pinned keys.
+type PinnedRootKeys struct {
+	KeyIDs    []string `json:"keyids"`
+	Threshold int      `json:"threshold"`
+	Version   int      `json:"version,omitempty"`
+}
+
+func (p PinnedRootKeys) rootName(c *Client) (string, error) {
+	return versionedRootName(p.Version), nil
+}
+
+func (p PinnedRootKeys) check(c *Client, raw []byte, s *data.Signed, root *data.SignedRoot) error {
+	db := keys.NewDB()
+	ids := make([]string, 0, len(p.KeyIDs))
+	for _, id := range p.KeyIDs {
+		if k, ok := root.Signed.Keys[id]; ok {
+			db.AddKey(k)
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) < p.Threshold || p.Threshold < 1 {
+		return ErrRootKeysMismatch{KeyIDs: p.KeyIDs, Threshold: p.Threshold, Err: ErrInsufficientKeys}
+	}
+	role, err := data.NewRole(data.RoleName("root"), p.Threshold, ids, nil, nil)
+	if err != nil {
+		return err
+	}
+	if err := db.AddRole(role); err != nil {
+		return err
+	}
+	if err := signed.VerifySignatures(s, data.RoleName("root"), db); err != nil {
+		return ErrRootKeysMismatch{KeyIDs: p.KeyIDs, Threshold: p.Threshold, Err: err}
+	}
+	return nil
+}
+
+func (p PinnedRootKeys) accepted(c *Client, root *data.SignedRoot) error {
+	return nil
+}
+
+// TrustOnFirstUse trusts whichever root is served the first time the
+// client is bootstrapped, and pins that root's version, keys and threshold
+// in the client's cache. Later bootstraps behave as PinnedRootKeys with the
+// persisted pin, so they start from the pinned root and walk forward
+// through any rotations since.
+type TrustOnFirstUse struct{}
+
+// pin returns the persisted pin, or nil if there is none yet
+func (TrustOnFirstUse) pin(c *Client) (*PinnedRootKeys, error) {
+	b, err := c.cache.GetMeta(rootPinName, maxSize)
+	if err != nil {
+		if _, ok := err.(store.ErrMetaNotFound); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+	pin := &PinnedRootKeys{}
+	if err := json.Unmarshal(b, pin); err != nil {
+		return nil, ErrCorruptedCache{file: rootPinName}
+	}
+	return pin, nil
+}
+
+func (t TrustOnFirstUse) rootName(c *Client) (string, error) {
+	pin, err := t.pin(c)
+	if err != nil {
+		return "", err
+	}
+	if pin == nil {
+		return data.RoleName("root"), nil
+	}
+	return pin.rootName(c)
+}
+
+func (t TrustOnFirstUse) check(c *Client, raw []byte, s *data.Signed, root *data.SignedRoot) error {
+	pin, err := t.pin(c)
+	if err != nil || pin == nil {
+		return err
+	}
+	return pin.check(c, raw, s, root)
+}
+
+// accepted pins the root if there is no pin yet. It is only called once the
+// client has taken on the root, so a root the client rejects is never
+// pinned.
+func (t TrustOnFirstUse) accepted(c *Client, root *data.SignedRoot) error {
+	if pin, err := t.pin(c); err != nil || pin != nil {
+		return err
+	}
+	role := root.Signed.Roles[data.RoleName("root")]
+	logrus.Infof("trusting root version %d with keys %v on first use", root.Signed.Version, role.KeyIDs)
+	b, err := json.Marshal(PinnedRootKeys{KeyIDs: role.KeyIDs, Threshold: role.Threshold, Version: root.Signed.Version})
+	if err != nil {
+		return err
+	}
+	return c.cache.SetMeta(rootPinName, b)
+}
+
+// NewBootstrappedClient creates a Client for the mirrors whose trust in the
+// repo's root is established by the BootstrapMode, see
+// NewBootstrappedClientContext
+func NewBootstrappedClient(mirrors []Mirror, cache store.MetadataStore, mode BootstrapMode) (*Client, error) {
+	return NewBootstrappedClientContext(context.Background(), mirrors, cache, mode)
+}
+
+// NewBootstrappedClientContext creates a Client for the mirrors whose trust
+// in the repo's root is established by the BootstrapMode. If a root was
+// previously trusted by a client using the same cache, that root is used
+// instead, so the mode only applies the first time and the root may have
+// been rotated since. The returned Client is ready to Update.
+func NewBootstrappedClientContext(ctx context.Context, mirrors []Mirror, cache store.MetadataStore, mode BootstrapMode) (*Client, error) {
+	kdb := keys.NewDB()
+	c := NewMirroredClient(tuf.NewRepo(kdb, nil), mirrors, kdb, cache)
+	if root, ok := c.cachedTrustedRoot(); ok {
+		logrus.Debugf("resuming from trusted root version %d", root.Signed.Version)
+		if err := c.local.SetRoot(root); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+
+	name, err := mode.rootName(c)
+	if err != nil {
+		return nil, err
+	}
+	raw, s, err := c.downloadSigned(ctx, name, maxSize, nil)
+	if err != nil {
+		return nil, err
+	}
+	root, err := data.RootFromSigned(s)
+	if err != nil {
+		return nil, ErrDecodeFailed{File: name, Err: err}
+	}
+	if !data.ValidTUFType(root.Signed.Type, data.RoleName("root")) {
+		return nil, signed.ErrWrongType
+	}
+	// a root that cannot verify itself could never verify its successor.
+	// Expiry is not checked as Update fetches any newer root.
+	err = signed.VerifySignatures(s, data.RoleName("root"), rootKeyDB(root))
+	if err == nil {
+		err = mode.check(c, raw, s, root)
+	}
+	c.notify(MetaVerified{Role: name, Version: root.Signed.Version, Err: err})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.local.SetRoot(root); err != nil {
+		return nil, err
+	}
+	c.trust(data.RoleName("root"), s, raw, nil)
+	if err := mode.accepted(c, root); err != nil {
+		return nil, err
+	}
+	if err := cache.SetMeta(data.RoleName("root"), raw); err != nil {
+		logrus.Errorf("Failed to write root to local cache: %s", err.Error())
+	}
+	return c, nil
+}
+
+// versionedRootName is the name of the given version of the root, or of the
+// current root if version is 0
+func versionedRootName(version int) string {
+	if version != 0 {
+		return fmt.Sprintf("%d.%s", version, data.RoleName("root"))
+	}
+	return data.RoleName("root")
+}
+
+// cachedTrustedRoot returns the cached root if it is the root recorded in
+// the trusted state
+func (c *Client) cachedTrustedRoot() (*data.SignedRoot, bool) {
+	trusted, ok := c.TrustedState().Roles[data.RoleName("root")]
+	if !ok {
+		return nil, false
+	}
+	raw, err := c.cache.GetMeta(data.RoleName("root"), maxSize)
+	if err != nil {
+		return nil, false
+	}
+	hash := sha256.Sum256(raw)
+	if !bytes.Equal(hash[:], trusted.Sha256) {
+		logrus.Debug("cached root is not the trusted root")
+		return nil, false
+	}
+	s := &data.Signed{}
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, false
+	}
+	root, err := data.RootFromSigned(s)
+	if err != nil {
+		return nil, false
+	}
+	return root, true
+}
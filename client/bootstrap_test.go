@@ -0,0 +1,265 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	tuf "github.com/endophage/gotuf"
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/signed"
+	"github.com/endophage/gotuf/store"
+	"github.com/endophage/gotuf/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// publishedRepo signs a new empty repo and uploads it to a remote, returning
+// the repo, the remote and the serialized root
+func publishedRepo(t *testing.T) (*tuf.Repo, store.RemoteStore, []byte) {
+	_, repo, _ := testutils.EmptyRepo()
+	sRoot, sTargets, sSnapshot, sTimestamp, err := testutils.Sign(repo)
+	assert.NoError(t, err)
+	root, targets, snapshot, timestamp, err := testutils.Serialize(sRoot, sTargets, sSnapshot, sTimestamp)
+	assert.NoError(t, err)
+	remote := store.NewMemoryStore(nil, nil)
+	remote.SetMeta("1.root", root)
+	remote.SetMeta("root", root)
+	remote.SetMeta("targets", targets)
+	remote.SetMeta("snapshot", snapshot)
+	remote.SetMeta("timestamp", timestamp)
+	return repo, remote, root
+}
+
+func mirrorsFor(remote store.RemoteStore) []Mirror {
+	return []Mirror{{Name: "remote", Remote: remote, MetaPatterns: []string{"**"}, TargetPatterns: []string{"**"}}}
+}
+
+func TestBootstrapPinnedRootHash(t *testing.T) {
+	_, remote, root := publishedRepo(t)
+	hash := sha256.Sum256(root)
+
+	for _, version := range []int{0, 1} {
+		client, err := NewBootstrappedClient(mirrorsFor(remote), store.NewMemoryStore(nil, nil),
+			PinnedRootHash{Version: version, Sha256: hash[:]})
+		assert.NoError(t, err)
+		assert.NoError(t, client.Update())
+	}
+
+	wrong := sha256.Sum256([]byte("another root"))
+	_, err := NewBootstrappedClient(mirrorsFor(remote), store.NewMemoryStore(nil, nil),
+		PinnedRootHash{Sha256: wrong[:]})
+	assert.Equal(t, ErrRootHashMismatch{Expected: wrong[:], Actual: hash[:]}, err)
+}
+
+func TestBootstrapPinnedRootKeys(t *testing.T) {
+	repo, remote, _ := publishedRepo(t)
+	rootKeys := repo.Root.Signed.Roles["root"].KeyIDs
+
+	client, err := NewBootstrappedClient(mirrorsFor(remote), store.NewMemoryStore(nil, nil),
+		PinnedRootKeys{KeyIDs: rootKeys, Threshold: 1})
+	assert.NoError(t, err)
+	assert.NoError(t, client.Update())
+
+	// the threshold cannot be met with the pinned keys
+	_, err = NewBootstrappedClient(mirrorsFor(remote), store.NewMemoryStore(nil, nil),
+		PinnedRootKeys{KeyIDs: rootKeys, Threshold: 2})
+	assert.IsType(t, ErrRootKeysMismatch{}, err)
+
+	// the root is signed by keys other than those pinned
+	other, _, _ := publishedRepo(t)
+	_, err = NewBootstrappedClient(mirrorsFor(remote), store.NewMemoryStore(nil, nil),
+		PinnedRootKeys{KeyIDs: other.Root.Signed.Roles["root"].KeyIDs, Threshold: 1})
+	assert.IsType(t, ErrRootKeysMismatch{}, err)
+}
+
+func TestBootstrapTrustOnFirstUse(t *testing.T) {
+	repo, remote, _ := publishedRepo(t)
+	cache := store.NewMemoryStore(nil, nil)
+
+	client, err := NewBootstrappedClient(mirrorsFor(remote), cache, TrustOnFirstUse{})
+	assert.NoError(t, err)
+	assert.NoError(t, client.Update())
+
+	raw, err := cache.GetMeta(rootPinName, maxSize)
+	assert.NoError(t, err)
+	pin := PinnedRootKeys{}
+	assert.NoError(t, json.Unmarshal(raw, &pin))
+	assert.Equal(t, PinnedRootKeys{KeyIDs: repo.Root.Signed.Roles["root"].KeyIDs, Threshold: 1, Version: 1}, pin)
+
+	// with only the pin surviving, a root with other keys is refused
+	_, otherRemote, _ := publishedRepo(t)
+	pinOnly := store.NewMemoryStore(map[string][]byte{rootPinName: raw}, nil)
+	_, err = NewBootstrappedClient(mirrorsFor(otherRemote), pinOnly, TrustOnFirstUse{})
+	assert.IsType(t, ErrRootKeysMismatch{}, err)
+
+	// a root the client cannot take on is not pinned
+	repo, remote, _ = publishedRepo(t)
+	targets := repo.Root.Signed.Roles["targets"]
+	targets.KeyIDs = append(targets.KeyIDs, "unknown")
+	sRoot, err := repo.SignRoot(data.DefaultExpires("root"), nil)
+	assert.NoError(t, err)
+	badRoot, err := json.Marshal(sRoot)
+	assert.NoError(t, err)
+	assert.NoError(t, remote.(store.MetadataStore).SetMeta("root", badRoot))
+	cache = store.NewMemoryStore(nil, nil)
+	_, err = NewBootstrappedClient(mirrorsFor(remote), cache, TrustOnFirstUse{})
+	assert.Error(t, err)
+	_, err = cache.GetMeta(rootPinName, maxSize)
+	assert.IsType(t, store.ErrMetaNotFound{}, err)
+}
+
+func TestBootstrapTrustOnFirstUseRotated(t *testing.T) {
+	signer := signed.NewEd25519()
+	key1, err := signer.Create("root", data.ED25519Key)
+	assert.NoError(t, err)
+	key2, err := signer.Create("root", data.ED25519Key)
+	assert.NoError(t, err)
+	key3, err := signer.Create("root", data.ED25519Key)
+	assert.NoError(t, err)
+
+	remote := store.NewMemoryStore(nil, nil)
+	remote.SetMeta("1.root", rotatedRoot(t, signer, 1, key1, key1))
+	remote.SetMeta("root", rotatedRoot(t, signer, 1, key1, key1))
+	cache := store.NewMemoryStore(nil, nil)
+	_, err = NewBootstrappedClient(mirrorsFor(remote), cache, TrustOnFirstUse{})
+	assert.NoError(t, err)
+	pin, err := cache.GetMeta(rootPinName, maxSize)
+	assert.NoError(t, err)
+
+	// the root keys are rotated twice, so the latest root is not signed by
+	// the pinned key
+	remote.SetMeta("2.root", rotatedRoot(t, signer, 2, key2, key1, key2))
+	latest := rotatedRoot(t, signer, 3, key3, key2, key3)
+	remote.SetMeta("3.root", latest)
+	remote.SetMeta("root", latest)
+
+	// with only the pin surviving, the client starts from the pinned root
+	// and walks forward to the latest one
+	pinOnly := store.NewMemoryStore(map[string][]byte{rootPinName: pin}, nil)
+	client, err := NewBootstrappedClient(mirrorsFor(remote), pinOnly, TrustOnFirstUse{})
+	assert.NoError(t, err)
+	assert.NoError(t, client.downloadRoot(context.Background()))
+	assert.Equal(t, 3, client.local.Root.Signed.Version)
+	assert.Equal(t, []string{key3.ID()}, client.keysDB.GetRole("root").KeyIDs)
+}
+
+func TestBootstrapTrustOnFirstUseFilesystemCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotuf-cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cache, err := store.NewFilesystemStore(dir, "metadata", "json", "targets")
+	assert.NoError(t, err)
+
+	repo, remote, _ := publishedRepo(t)
+	client, err := NewBootstrappedClient(mirrorsFor(remote), cache, TrustOnFirstUse{})
+	assert.NoError(t, err)
+	assert.NoError(t, client.Update())
+	raw, err := cache.GetMeta(rootPinName, maxSize)
+	assert.NoError(t, err)
+	pin := PinnedRootKeys{}
+	assert.NoError(t, json.Unmarshal(raw, &pin))
+	assert.Equal(t, repo.Root.Signed.Roles["root"].KeyIDs, pin.KeyIDs)
+
+	// the persisted pin refuses a root with other keys
+	assert.NoError(t, cache.SetMeta(trustedStateName, []byte("{}")))
+	_, otherRemote, _ := publishedRepo(t)
+	_, err = NewBootstrappedClient(mirrorsFor(otherRemote), cache, TrustOnFirstUse{})
+	assert.IsType(t, ErrRootKeysMismatch{}, err)
+}
+
+func TestBootstrapResumesFromTrustedRoot(t *testing.T) {
+	_, remote, root := publishedRepo(t)
+	hash := sha256.Sum256(root)
+	cache := store.NewMemoryStore(nil, nil)
+	_, err := NewBootstrappedClient(mirrorsFor(remote), cache, PinnedRootHash{Sha256: hash[:]})
+	assert.NoError(t, err)
+
+	// the pin no longer applies once a root is trusted, so it may be rotated
+	wrong := sha256.Sum256([]byte("another root"))
+	client, err := NewBootstrappedClient(mirrorsFor(remote), cache, PinnedRootHash{Sha256: wrong[:]})
+	assert.NoError(t, err)
+	assert.NoError(t, client.Update())
+
+	// unless the cached root is not the trusted one
+	_, otherRemote, otherRoot := publishedRepo(t)
+	cache.SetMeta("root", otherRoot)
+	_, err = NewBootstrappedClient(mirrorsFor(otherRemote), cache, PinnedRootHash{Sha256: wrong[:]})
+	assert.IsType(t, ErrRootHashMismatch{}, err)
+}
+
+func TestUpdateWalksPublishedRootChain(t *testing.T) {
+	_, repo, _ := testutils.EmptyRepo()
+	remote := store.NewMemoryStore(nil, nil)
+	_, _, _, _, err := testutils.Sign(repo)
+	assert.NoError(t, err)
+	_, err = repo.Publish(remote)
+	assert.NoError(t, err)
+	first, err := remote.GetMeta("1.root", maxSize)
+	assert.NoError(t, err)
+	hash := sha256.Sum256(first)
+
+	// two further roots are signed, only the last of them being published
+	_, err = repo.SignRoot(data.DefaultExpires("root"), nil)
+	assert.NoError(t, err)
+	_, _, _, _, err = testutils.Sign(repo)
+	assert.NoError(t, err)
+	_, err = repo.Publish(remote)
+	assert.NoError(t, err)
+
+	client, err := NewBootstrappedClient(mirrorsFor(remote), store.NewMemoryStore(nil, nil),
+		PinnedRootHash{Version: 1, Sha256: hash[:]})
+	assert.NoError(t, err)
+	assert.NoError(t, client.Update())
+	assert.Equal(t, 3, client.local.Root.Signed.Version)
+}
+
+func TestUpdateConsistentSnapshot(t *testing.T) {
+	_, repo, _ := testutils.EmptyRepo()
+	repo.Root.Signed.ConsistentSnapshot = true
+	meta, err := data.NewFileMeta(bytes.NewReader([]byte("target content")), "sha256")
+	assert.NoError(t, err)
+	_, err = repo.AddTargets("targets", data.Files{"foo/bar.txt": meta})
+	assert.NoError(t, err)
+	_, _, _, _, err = testutils.Sign(repo)
+	assert.NoError(t, err)
+	remote := store.NewMemoryStore(nil, nil)
+	_, err = repo.Publish(remote)
+	assert.NoError(t, err)
+	root, err := remote.GetMeta("root", maxSize)
+	assert.NoError(t, err)
+	hash := sha256.Sum256(root)
+
+	client, err := NewBootstrappedClient(mirrorsFor(remote), store.NewMemoryStore(nil, nil),
+		PinnedRootHash{Sha256: hash[:]})
+	assert.NoError(t, err)
+	assert.NoError(t, client.Update())
+	found, err := client.TargetMeta("foo/bar.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, &meta, found)
+}
+
+func TestTargetMetaUpdateFailure(t *testing.T) {
+	repo, remote, root := publishedRepo(t)
+	hash := sha256.Sum256(root)
+	client, err := NewBootstrappedClient(mirrorsFor(remote), store.NewMemoryStore(nil, nil),
+		PinnedRootHash{Sha256: hash[:]})
+	assert.NoError(t, err)
+	meta, err := client.TargetMeta("missing")
+	assert.NoError(t, err)
+	assert.Nil(t, meta)
+
+	v1, err := remote.GetMeta("timestamp", maxSize)
+	assert.NoError(t, err)
+	publishTimestamp(t, repo, remote.(store.MetadataStore))
+	assert.NoError(t, client.Update())
+
+	// the rollback is reported rather than the target simply not being found
+	assert.NoError(t, remote.(store.MetadataStore).SetMeta("timestamp", v1))
+	meta, err = client.TargetMeta("missing")
+	assert.IsType(t, signed.ErrLowVersion{}, err)
+	assert.Nil(t, meta)
+}
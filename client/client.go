@@ -1,19 +1,22 @@
 package client
 
 import (
-	"bytes"
-	"crypto/sha256"
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
+	"os"
 	"path"
-	"path/filepath"
-	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	tuf "github.com/endophage/gotuf"
+	"github.com/endophage/gotuf/clock"
 	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/errors"
 	"github.com/endophage/gotuf/keys"
 	"github.com/endophage/gotuf/signed"
 	"github.com/endophage/gotuf/store"
@@ -22,26 +25,93 @@ import (
 
 const maxSize int64 = 5 << 20
 
+// maxRootRotations bounds how many roots the client will walk through in a
+// single update, so a mirror serving an endless chain of roots cannot keep
+// it downloading forever
+var maxRootRotations = 1024
+
 // Client is a usability wrapper around a raw TUF repo
 type Client struct {
-	local  *tuf.Repo
-	remote store.RemoteStore
-	keysDB *keys.KeyDB
-	cache  store.MetadataStore
+	local         *tuf.Repo
+	mirrors       []Mirror
+	keysDB        *keys.KeyDB
+	cache         store.MetadataStore
+	servedMeta    *servedBy
+	servedTargets *servedBy
+
+	requestTimeout time.Duration
+	observer       Observer
+	trusted        *TrustedState
+	freezeWindow   time.Duration
+	expiry         signed.ExpiryChecker
 }
 
 // NewClient initialized a Client with the given repo, remote source of content, key database, and cache
 func NewClient(local *tuf.Repo, remote store.RemoteStore, keysDB *keys.KeyDB, cache store.MetadataStore) *Client {
-	return &Client{
-		local:  local,
-		remote: remote,
-		keysDB: keysDB,
-		cache:  cache,
+	mirror := Mirror{
+		Name:           "remote",
+		Remote:         remote,
+		MetaPatterns:   []string{"**"},
+		TargetPatterns: []string{"**"},
 	}
+	return NewMirroredClient(local, []Mirror{mirror}, keysDB, cache)
+}
+
+// NewMirroredClient initializes a Client that downloads from a list of
+// mirrors. For each file the mirrors permitted to serve it are tried in
+// the order given, moving on to the next mirror if one is unavailable or
+// serves bad data.
+func NewMirroredClient(local *tuf.Repo, mirrors []Mirror, keysDB *keys.KeyDB, cache store.MetadataStore) *Client {
+	c := &Client{
+		local:         local,
+		mirrors:       mirrors,
+		keysDB:        keysDB,
+		cache:         cache,
+		servedMeta:    newServedBy(),
+		servedTargets: newServedBy(),
+	}
+	c.TrustedState()
+	return c
+}
+
+// SetRequestTimeout bounds the time allowed for each individual request
+// made to a mirror. A request that times out is retried against the next
+// mirror able to serve the file. A timeout of 0 disables the limit.
+func (c *Client) SetRequestTimeout(timeout time.Duration) {
+	c.requestTimeout = timeout
+}
+
+// SetClock sets the clock metadata expiry and the freeze window are
+// checked by. The system clock is used by default.
+func (c *Client) SetClock(clk clock.Clock) {
+	c.expiry.Clock = clk
+}
+
+// SetClockSkew tolerates the client's clock being wrong by up to skew,
+// for example on a device without a reliable real time clock. Metadata is
+// only considered expired once it expired more than skew ago.
+func (c *Client) SetClockSkew(skew time.Duration) {
+	c.expiry.Skew = skew
+}
+
+// requestContext derives the context for a single request from ctx
+func (c *Client) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.requestTimeout > 0 {
+		return context.WithTimeout(ctx, c.requestTimeout)
+	}
+	return context.WithCancel(ctx)
 }
 
 // Update performs an update to the TUF repo as defined by the TUF spec
 func (c *Client) Update() error {
+	return c.UpdateContext(context.Background())
+}
+
+// UpdateContext performs Update, abandoning it if ctx is done. A deadline
+// on ctx acts as a budget for the entire update, use SetRequestTimeout to
+// bound each request. Metadata is only written to the cache once it has
+// been verified, so an abandoned update leaves the cache consistent.
+func (c *Client) UpdateContext(ctx context.Context) error {
 	// 1. Get timestamp
 	//   a. If timestamp error (verification, expired, etc...) download new root and return to 1.
 	// 2. Check if local snapshot is up to date
@@ -51,28 +121,31 @@ func (c *Client) Update() error {
 	//   a. If incorrect, download new root and return to 1.
 	// 4. Iteratively download and search targets and delegations to find target meta
 	logrus.Debug("updating TUF client")
-	err := c.update()
+	err := c.update(ctx)
 	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		logrus.Debug("Error occurred. Root will be downloaded and another update attempted")
-		if err := c.downloadRoot(); err != nil {
+		if err := c.downloadRoot(ctx); err != nil {
 			logrus.Error("client Update (Root):", err)
 			return err
 		}
 		// If we error again, we now have the latest root and just want to fail
 		// out as there's no expectation the problem can be resolved automatically
 		logrus.Debug("retrying TUF client update")
-		return c.update()
+		return c.update(ctx)
 	}
 	return nil
 }
 
-func (c *Client) update() error {
-	err := c.downloadTimestamp()
+func (c *Client) update(ctx context.Context) error {
+	err := c.downloadTimestamp(ctx)
 	if err != nil {
 		logrus.Errorf("Client Update (Timestamp): %s", err.Error())
 		return err
 	}
-	err = c.downloadSnapshot()
+	err = c.downloadSnapshot(ctx)
 	if err != nil {
 		logrus.Errorf("Client Update (Snapshot): %s", err.Error())
 		return err
@@ -85,7 +158,7 @@ func (c *Client) update() error {
 		return tuf.ErrLocalRootExpired{}
 	}
 	// will always need top level targets at a minimum
-	err = c.downloadTargets("targets")
+	err = c.downloadTargets(ctx, "targets")
 	if err != nil {
 		logrus.Errorf("Client Update (Targets): %s", err.Error())
 		return err
@@ -99,21 +172,15 @@ func (c *Client) update() error {
 // there is little expectation that the situation can be remedied.
 func (c Client) checkRoot() error {
 	role := data.RoleName("root")
-	size := c.local.Snapshot.Signed.Meta[role].Length
-	hashSha256 := c.local.Snapshot.Signed.Meta[role].Hashes["sha256"]
+	meta := c.local.Snapshot.Signed.Meta[role]
 
-	raw, err := c.cache.GetMeta("root", size)
+	raw, err := c.cache.GetMeta("root", meta.Length)
 	if err != nil {
 		return err
 	}
 
-	hash := sha256.Sum256(raw)
-	if !bytes.Equal(hash[:], hashSha256) {
-		return fmt.Errorf("Cached root sha256 did not match snapshot root sha256")
-	}
-
-	if int64(len(raw)) != size {
-		return fmt.Errorf("Cached root size did not match snapshot size")
+	if err := utils.CheckHashes(raw, meta); err != nil {
+		return fmt.Errorf("Cached root did not match snapshot: %s", err)
 	}
 
 	root := &data.SignedRoot{}
@@ -122,20 +189,22 @@ func (c Client) checkRoot() error {
 		return ErrCorruptedCache{file: "root.json"}
 	}
 
-	if signed.IsExpired(root.Signed.Expires) {
+	if c.expiry.IsExpired(root.Signed.Expires) {
 		return tuf.ErrLocalRootExpired{}
 	}
 	return nil
 }
 
 // downloadRoot is responsible for downloading the root.json
-func (c *Client) downloadRoot() error {
+func (c *Client) downloadRoot(ctx context.Context) error {
 	role := data.RoleName("root")
 	size := maxSize
-	var expectedSha256 []byte
+	var expected *data.FileMeta
 	if c.local.Snapshot != nil {
-		size = c.local.Snapshot.Signed.Meta[role].Length
-		expectedSha256 = c.local.Snapshot.Signed.Meta[role].Hashes["sha256"]
+		if meta, ok := c.local.Snapshot.Signed.Meta[role]; ok {
+			size = meta.Length
+			expected = &meta
+		}
 	}
 
 	// if we're bootstrapping we may not have a cached root, an
@@ -146,9 +215,29 @@ func (c *Client) downloadRoot() error {
 	var cachedRoot []byte
 	old := &data.Signed{}
 	version := 0
+	if c.local.Root != nil {
+		version = c.local.Root.Signed.Version
+	}
+
+	// walk forward through any intermediate roots that have been published
+	// since the one we currently trust. Each must be signed by both the
+	// previous and the new root role, so a client that has missed several
+	// rotations can still establish trust in the latest keys.
+	trusted := version
+	version, err = c.downloadRootChain(ctx, version)
+	if err != nil {
+		return err
+	}
+	chained := version
+	if version > trusted {
+		// the snapshot we hold was produced under an older root so its
+		// checksum for root.json can no longer be relied upon.
+		size = maxSize
+		expected = nil
+	}
 
-	if expectedSha256 != nil {
-		// can only trust cache if we have an expected sha256 to trust
+	if expected != nil {
+		// can only trust cache if we have an expected checksum to trust
 		cachedRoot, err = c.cache.GetMeta(role, size)
 	}
 
@@ -156,15 +245,17 @@ func (c *Client) downloadRoot() error {
 		logrus.Debug("didn't find a cached root, must download")
 		download = true
 	} else {
-		hash := sha256.Sum256(cachedRoot)
-		if !bytes.Equal(hash[:], expectedSha256) {
+		if utils.CheckHashes(cachedRoot, *expected) != nil {
 			logrus.Debug("cached root's hash didn't match expected, must download")
 			download = true
 		}
 		err := json.Unmarshal(cachedRoot, old)
 		if err == nil {
 			root, err := data.RootFromSigned(old)
-			if err == nil {
+			if err == nil && root.Signed.Version < version {
+				logrus.Debug("cached root is older than the root chain, must download")
+				download = true
+			} else if err == nil {
 				version = root.Signed.Version
 			} else {
 				logrus.Debug("couldn't parse Signed part of cached root, must download")
@@ -178,17 +269,28 @@ func (c *Client) downloadRoot() error {
 	var s *data.Signed
 	var raw []byte
 	if download {
-		raw, s, err = c.downloadSigned(role, size, expectedSha256)
+		raw, s, err = c.downloadSigned(ctx, role, size, expected)
 		if err != nil {
 			return err
 		}
 	} else {
 		logrus.Debug("using cached root")
+		c.notify(MetaCacheHit{Role: role, Size: int64(len(cachedRoot)), Version: version})
 		s = old
+		raw = cachedRoot
+	}
+	err = c.verifyRoot(role, s, version)
+	if err == nil {
+		err = c.checkTrusted(role, s, raw)
 	}
-	if err := c.verifyRoot(role, s, version); err != nil {
+	c.notify(MetaVerified{Role: role, Version: signedVersion(s), Err: err})
+	if err != nil {
 		return err
 	}
+	c.trust(role, s, raw, nil)
+	if newVersion := c.local.Root.Signed.Version; newVersion > chained {
+		c.notify(RootRotated{FromVersion: chained, ToVersion: newVersion})
+	}
 	if download {
 		logrus.Debug("caching downloaded root")
 		// Now that we have accepted new root, write it to cache
@@ -199,13 +301,102 @@ func (c *Client) downloadRoot() error {
 	return nil
 }
 
+// downloadRootChain fetches <N>.root.json for each version N following the
+// given trusted version, verifying each against both the previous and the
+// new root role before accepting it. It stops at the first version the
+// remote does not have and returns the last version that was accepted.
+// Once maxRootRotations roots have been accepted no further root is
+// requested.
+func (c *Client) downloadRootChain(ctx context.Context, version int) (int, error) {
+	role := data.RoleName("root")
+	for rotations := 0; ; rotations++ {
+		if rotations >= maxRootRotations {
+			return version, ErrTooManyRootRotations{Max: maxRootRotations}
+		}
+		next := version + 1
+		name := fmt.Sprintf("%d.%s", next, role)
+		raw, s, err := c.downloadSigned(ctx, name, maxSize, nil)
+		if err != nil {
+			if _, ok := err.(store.ErrMetaNotFound); ok {
+				logrus.Debugf("no root version %d available, root chain ends at version %d", next, version)
+				return version, nil
+			}
+			return version, err
+		}
+		logrus.Debugf("verifying intermediate root version %d", next)
+		err = c.checkTrusted(role, s, raw)
+		if err == nil {
+			err = c.verifyIntermediateRoot(role, s, next)
+		}
+		c.notify(MetaVerified{Role: name, Version: signedVersion(s), Err: err})
+		if err != nil {
+			return version, err
+		}
+		c.trust(role, s, raw, nil)
+		c.notify(RootRotated{FromVersion: version, ToVersion: next})
+		// cache each accepted root so progress through the chain survives
+		// a failure further along it
+		if err := c.cache.SetMeta(role, raw); err != nil {
+			logrus.Errorf("Failed to write root to local cache: %s", err.Error())
+		}
+		version = next
+	}
+}
+
+// verifyIntermediateRoot checks a root from the rotation chain is exactly the
+// expected version and is signed by a threshold of both the currently trusted
+// root role and the root role it declares. Expiry is deliberately not checked
+// as older roots in the chain are expected to have expired. The local repo is
+// only updated once all checks have passed.
+func (c *Client) verifyIntermediateRoot(role string, s *data.Signed, expectedVersion int) error {
+	root, err := data.RootFromSigned(s)
+	if err != nil {
+		return err
+	}
+	if root.Signed.Version != expectedVersion {
+		return ErrWrongRootVersion{Expected: expectedVersion, Actual: root.Signed.Version}
+	}
+	if !data.ValidTUFType(root.Signed.Type, role) {
+		return signed.ErrWrongType
+	}
+	logrus.Debug("verifying intermediate root with existing keys")
+	if err := signed.VerifySignatures(s, role, c.keysDB); err != nil {
+		logrus.Debug("intermediate root did not verify with existing keys")
+		return err
+	}
+	logrus.Debug("verifying intermediate root with its own keys")
+	if err := signed.VerifySignatures(s, role, rootKeyDB(root)); err != nil {
+		logrus.Debug("intermediate root did not verify with its own keys")
+		return err
+	}
+	return c.local.SetRoot(root)
+}
+
+// rootKeyDB builds a standalone KeyDB containing only the keys and roles
+// declared in the given root.
+func rootKeyDB(root *data.SignedRoot) *keys.KeyDB {
+	db := keys.NewDB()
+	for _, key := range root.Signed.Keys {
+		db.AddKey(key)
+	}
+	for name, r := range root.Signed.Roles {
+		role, err := data.NewRole(name, r.Threshold, r.KeyIDs, nil, nil)
+		if err != nil {
+			logrus.Debugf("skipping invalid role %s in root: %s", name, err)
+			continue
+		}
+		db.AddRole(role)
+	}
+	return db
+}
+
 func (c Client) verifyRoot(role string, s *data.Signed, minVersion int) error {
 	// this will confirm that the root has been signed by the old root role
 	// as c.keysDB contains the root keys we bootstrapped with.
 	// Still need to determine if there has been a root key update and
 	// confirm signature with new root key
 	logrus.Debug("verifying root with existing keys")
-	err := signed.Verify(s, role, minVersion, c.keysDB)
+	err := signed.VerifyWithExpiry(s, role, minVersion, c.keysDB, c.expiry)
 	if err != nil {
 		logrus.Debug("root did not verify with existing keys")
 		return err
@@ -228,7 +419,7 @@ func (c Client) verifyRoot(role string, s *data.Signed, minVersion int) error {
 	// TODO(endophage): be more intelligent and only re-verify if we detect
 	//                  there has been a change in root keys
 	logrus.Debug("verifying root with updated keys")
-	err = signed.Verify(s, role, minVersion, c.keysDB)
+	err = signed.VerifyWithExpiry(s, role, minVersion, c.keysDB, c.expiry)
 	if err != nil {
 		logrus.Debug("root did not verify with new keys")
 		return err
@@ -240,7 +431,7 @@ func (c Client) verifyRoot(role string, s *data.Signed, minVersion int) error {
 // downloadTimestamp is responsible for downloading the timestamp.json
 // Timestamps are special in that we ALWAYS attempt to download and only
 // use cache if the download fails (and the cache is still valid).
-func (c *Client) downloadTimestamp() error {
+func (c *Client) downloadTimestamp(ctx context.Context) error {
 	logrus.Debug("downloadTimestamp")
 	role := data.RoleName("timestamp")
 
@@ -264,11 +455,14 @@ func (c *Client) downloadTimestamp() error {
 	}
 	// unlike root, targets and snapshot, always try and download timestamps
 	// from remote, only using the cache one if we couldn't reach remote.
-	raw, s, err := c.downloadSigned(role, maxSize, nil)
+	raw, s, err := c.downloadSigned(ctx, role, maxSize, nil)
 	if err != nil || len(raw) == 0 {
 		if err, ok := err.(store.ErrMetaNotFound); ok {
 			return err
 		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		if old == nil {
 			if err == nil {
 				// couldn't retrieve data from server and don't have valid
@@ -278,11 +472,20 @@ func (c *Client) downloadTimestamp() error {
 			return err
 		}
 		logrus.Debug("using cached timestamp")
+		c.notify(MetaCacheHit{Role: role, Size: int64(len(cachedTS)), Version: version})
 		s = old
+		raw = cachedTS
 	} else {
 		download = true
 	}
-	err = signed.Verify(s, role, version, c.keysDB)
+	err = signed.VerifyWithExpiry(s, role, version, c.keysDB, c.expiry)
+	if err == nil {
+		err = c.checkTrusted(role, s, raw)
+	}
+	if err == nil {
+		err = c.checkFreeze(signedVersion(s))
+	}
+	c.notify(MetaVerified{Role: role, Version: signedVersion(s), Err: err})
 	if err != nil {
 		return err
 	}
@@ -294,34 +497,33 @@ func (c *Client) downloadTimestamp() error {
 	if err != nil {
 		return err
 	}
+	c.trust(role, s, raw, ts.Signed.Meta)
 	c.local.SetTimestamp(ts)
 	return nil
 }
 
 // downloadSnapshot is responsible for downloading the snapshot.json
-func (c *Client) downloadSnapshot() error {
+func (c *Client) downloadSnapshot(ctx context.Context) error {
 	logrus.Debug("downloadSnapshot")
 	role := data.RoleName("snapshot")
 	if c.local.Timestamp == nil {
 		return ErrMissingMeta{role: "snapshot"}
 	}
-	size := c.local.Timestamp.Signed.Meta[role].Length
-	expectedSha256, ok := c.local.Timestamp.Signed.Meta[role].Hashes["sha256"]
-	if !ok {
+	expected := c.local.Timestamp.Signed.Meta[role]
+	if _, ok := data.StrongestHash(expected.Hashes); !ok {
 		return ErrMissingMeta{role: "snapshot"}
 	}
 
 	var download bool
 	old := &data.Signed{}
 	version := 0
-	raw, err := c.cache.GetMeta(role, size)
+	raw, err := c.cache.GetMeta(role, expected.Length)
 	if raw == nil || err != nil {
 		logrus.Debug("no snapshot in cache, must download")
 		download = true
 	} else {
 		// file may have been tampered with on disk. Always check the hash!
-		genHash := sha256.Sum256(raw)
-		if !bytes.Equal(genHash[:], expectedSha256) {
+		if utils.CheckHashes(raw, expected) != nil {
 			logrus.Debug("hash of snapshot in cache did not match expected hash, must download")
 			download = true
 		}
@@ -341,16 +543,27 @@ func (c *Client) downloadSnapshot() error {
 	}
 	var s *data.Signed
 	if download {
-		raw, s, err = c.downloadSigned(role, size, expectedSha256)
+		raw, s, err = c.downloadSigned(ctx, role, expected.Length, &expected)
 		if err != nil {
 			return err
 		}
 	} else {
 		logrus.Debug("using cached snapshot")
+		c.notify(MetaCacheHit{Role: role, Size: int64(len(raw)), Version: version})
 		s = old
 	}
 
-	err = signed.Verify(s, role, version, c.keysDB)
+	err = signed.VerifyWithExpiry(s, role, version, c.keysDB, c.expiry)
+	if err == nil {
+		err = checkDeclaredVersion(role, c.local.Timestamp.Signed.Meta[role], s)
+	}
+	if err == nil {
+		err = c.checkTrusted(role, s, raw)
+	}
+	if err == nil {
+		err = c.checkDeclared(role, s, raw)
+	}
+	c.notify(MetaVerified{Role: role, Version: signedVersion(s), Err: err})
 	if err != nil {
 		return err
 	}
@@ -359,6 +572,7 @@ func (c *Client) downloadSnapshot() error {
 	if err != nil {
 		return err
 	}
+	c.trust(role, s, raw, snap.Signed.Meta)
 	c.local.SetSnapshot(snap)
 	if download {
 		err = c.cache.SetMeta(role, raw)
@@ -371,7 +585,7 @@ func (c *Client) downloadSnapshot() error {
 
 // downloadTargets is responsible for downloading any targets file
 // including delegates roles.
-func (c *Client) downloadTargets(role string) error {
+func (c *Client) downloadTargets(ctx context.Context, role string) error {
 	role = data.RoleName(role) // this will really only do something for base targets role
 	if c.local.Snapshot == nil {
 		return ErrMissingMeta{role: role}
@@ -383,7 +597,7 @@ func (c *Client) downloadTargets(role string) error {
 		return fmt.Errorf("Invalid role: %s", role)
 	}
 	keyIDs := r.KeyIDs
-	s, err := c.getTargetsFile(role, keyIDs, snap.Meta, root.ConsistentSnapshot, r.Threshold)
+	s, err := c.getTargetsFile(ctx, role, keyIDs, snap.Meta, root.ConsistentSnapshot, r.Threshold)
 	if err != nil {
 		logrus.Error("Error getting targets file:", err)
 		return err
@@ -400,15 +614,54 @@ func (c *Client) downloadTargets(role string) error {
 	return nil
 }
 
-func (c *Client) downloadSigned(role string, size int64, expectedSha256 []byte) ([]byte, *data.Signed, error) {
-	raw, err := c.remote.GetMeta(role, size)
+// checkDeclaredVersion ensures s has the version declared for it in meta by
+// the metadata referencing it. Meta without a version, as written by older
+// repositories, declares no version and is not checked.
+func checkDeclaredVersion(role string, meta data.FileMeta, s *data.Signed) error {
+	if meta.Version == 0 {
+		return nil
+	}
+	if version := signedVersion(s); version != meta.Version {
+		return ErrWrongMetaVersion{Role: role, Declared: meta.Version, Actual: version}
+	}
+	return nil
+}
+
+// downloadSigned downloads the named metadata, of at most size bytes. If
+// expected is not nil the metadata must match it.
+func (c *Client) downloadSigned(ctx context.Context, role string, size int64, expected *data.FileMeta) ([]byte, *data.Signed, error) {
+	c.notify(MetaFetchStarted{Role: role, MaxSize: size})
+	raw, s, err := c.fetchSigned(ctx, role, size, expected)
+	var mirror string
+	if err == nil {
+		mirror, _ = c.servedMeta.get(role)
+	}
+	c.notify(MetaFetchFinished{
+		Role:    role,
+		Mirror:  mirror,
+		Size:    int64(len(raw)),
+		Version: signedVersion(s),
+		Err:     err,
+	})
+	return raw, s, err
+}
+
+func (c *Client) fetchSigned(ctx context.Context, role string, size int64, expected *data.FileMeta) ([]byte, *data.Signed, error) {
+	var raw []byte
+	err := c.tryMirrors(ctx, c.servedMeta, role, Mirror.ServesMeta, shouldFailover, func(ctx context.Context, m Mirror) error {
+		var err error
+		raw, err = store.RemoteWithContext(m.Remote).GetMetaContext(ctx, role, size)
+		if err != nil {
+			return err
+		}
+		if expected != nil && utils.CheckHashes(raw, *expected) != nil {
+			return ErrChecksumMismatch{role: role}
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, nil, err
 	}
-	genHash := sha256.Sum256(raw)
-	if expectedSha256 != nil && !bytes.Equal(genHash[:], expectedSha256) {
-		return nil, nil, ErrChecksumMismatch{role: role}
-	}
 	s := &data.Signed{}
 	err = json.Unmarshal(raw, s)
 	if err != nil {
@@ -417,13 +670,13 @@ func (c *Client) downloadSigned(role string, size int64, expectedSha256 []byte)
 	return raw, s, nil
 }
 
-func (c Client) getTargetsFile(role string, keyIDs []string, snapshotMeta data.Files, consistent bool, threshold int) (*data.Signed, error) {
+func (c Client) getTargetsFile(ctx context.Context, role string, keyIDs []string, snapshotMeta data.Files, consistent bool, threshold int) (*data.Signed, error) {
 	// require role exists in snapshots
 	roleMeta, ok := snapshotMeta[role]
 	if !ok {
-		return nil, ErrMissingMeta{role: role}
+		return nil, errors.ErrMissingMetadata{Name: role}
 	}
-	expectedSha256, ok := snapshotMeta[role].Hashes["sha256"]
+	hashAlgorithm, ok := data.StrongestHash(roleMeta.Hashes)
 	if !ok {
 		return nil, ErrMissingMeta{role: role}
 	}
@@ -438,8 +691,7 @@ func (c Client) getTargetsFile(role string, keyIDs []string, snapshotMeta data.F
 		download = true
 	} else {
 		// file may have been tampered with on disk. Always check the hash!
-		genHash := sha256.Sum256(raw)
-		if !bytes.Equal(genHash[:], expectedSha256) {
+		if utils.CheckHashes(raw, roleMeta) != nil {
 			download = true
 		}
 		err := json.Unmarshal(raw, old)
@@ -455,26 +707,37 @@ func (c Client) getTargetsFile(role string, keyIDs []string, snapshotMeta data.F
 		}
 	}
 
-	size := snapshotMeta[role].Length
 	var s *data.Signed
 	if download {
-		rolePath, err := c.RoleTargetsPath(role, hex.EncodeToString(expectedSha256), consistent)
+		rolePath, err := c.RoleTargetsPath(role, hex.EncodeToString(roleMeta.Hashes[hashAlgorithm]), consistent)
 		if err != nil {
 			return nil, err
 		}
-		raw, s, err = c.downloadSigned(rolePath, size, expectedSha256)
+		raw, s, err = c.downloadSigned(ctx, rolePath, roleMeta.Length, &roleMeta)
 		if err != nil {
 			return nil, err
 		}
 	} else {
 		logrus.Debug("using cached ", role)
+		c.notify(MetaCacheHit{Role: role, Size: int64(len(raw)), Version: version})
 		s = old
 	}
 
-	err = signed.Verify(s, role, version, c.keysDB)
+	err = signed.VerifyWithExpiry(s, role, version, c.keysDB, c.expiry)
+	if err == nil {
+		err = checkDeclaredVersion(role, roleMeta, s)
+	}
+	if err == nil {
+		err = c.checkTrusted(role, s, raw)
+	}
+	if err == nil {
+		err = c.checkDeclared(role, s, raw)
+	}
+	c.notify(MetaVerified{Role: role, Version: signedVersion(s), Err: err})
 	if err != nil {
 		return nil, err
 	}
+	c.trust(role, s, raw, nil)
 	logrus.Debugf("successfully verified %s", role)
 	if download {
 		// if we error when setting meta, we should continue.
@@ -487,63 +750,95 @@ func (c Client) getTargetsFile(role string, keyIDs []string, snapshotMeta data.F
 }
 
 // RoleTargetsPath generates the appropriate filename for the targets file,
-// based on whether the repo is marked as consistent.
-func (c Client) RoleTargetsPath(role string, hashSha256 string, consistent bool) (string, error) {
+// based on whether the repo is marked as consistent. Consistent names are
+// those tuf.Repo.Publish writes, see utils.HashedPaths.
+func (c Client) RoleTargetsPath(role string, hash string, consistent bool) (string, error) {
 	if consistent {
-		dir := filepath.Dir(role)
-		if strings.Contains(role, "/") {
-			lastSlashIdx := strings.LastIndex(role, "/")
-			role = role[lastSlashIdx+1:]
-		}
-		role = path.Join(
-			dir,
-			fmt.Sprintf("%s.%s.json", hashSha256, role),
-		)
+		role = path.Join(path.Dir(role), fmt.Sprintf("%s.%s", hash, path.Base(role)))
 	}
 	return role, nil
 }
 
 // TargetMeta ensures the repo is up to date, downloading the minimum
-// necessary metadata files
+// necessary metadata files. Delegations are searched in the order
+// described by tuf.Repo.WalkTargets.
 func (c Client) TargetMeta(path string) (*data.FileMeta, error) {
-	c.Update()
-	var meta *data.FileMeta
-
-	pathDigest := sha256.Sum256([]byte(path))
-	pathHex := hex.EncodeToString(pathDigest[:])
-
-	// FIFO list of targets delegations to inspect for target
-	roles := []string{data.ValidRoles["targets"]}
-	var role string
-	for len(roles) > 0 {
-		// have to do these lines here because of order of execution in for statement
-		role = roles[0]
-		roles = roles[1:]
-
-		// Download the target role file if necessary
-		err := c.downloadTargets(role)
-		if err != nil {
-			// as long as we find a valid target somewhere we're happy.
-			// continue and search other delegated roles if any
-			continue
+	return c.TargetMetaContext(context.Background(), path)
+}
+
+// TargetMetaContext is TargetMeta, abandoning the search if ctx is done
+func (c Client) TargetMetaContext(ctx context.Context, path string) (*data.FileMeta, error) {
+	if err := c.UpdateContext(ctx); err != nil {
+		return nil, err
+	}
+	meta, _, err := c.local.WalkTargets(path, func(role string) error {
+		err := c.downloadTargets(ctx, role)
+		if _, ok := err.(store.ErrMetaNotFound); ok {
+			// the walk skips roles that do not exist
+			return errors.ErrMissingMetadata{Name: role}
+		}
+		return err
+	})
+	// a failed download may not report the cancellation that caused it
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return meta, err
+}
+
+// DownloadTarget downloads the target to dst from the first mirror able to
+// serve it. As a target can only be known to be good once it has been read
+// in full, when more than one mirror may serve the target it is spooled to
+// a temporary file and only copied to dst once it has been validated.
+func (c Client) DownloadTarget(dst io.Writer, path string, meta *data.FileMeta) error {
+	return c.DownloadTargetContext(context.Background(), dst, path, meta)
+}
+
+// DownloadTargetContext is DownloadTarget, abandoning the download if ctx
+// is done
+func (c Client) DownloadTargetContext(ctx context.Context, dst io.Writer, path string, meta *data.FileMeta) error {
+	candidates := 0
+	for _, m := range c.mirrors {
+		if m.ServesTarget(path) {
+			candidates++
 		}
+	}
+	if candidates <= 1 {
+		return c.tryMirrors(ctx, c.servedTargets, path, Mirror.ServesTarget, shouldFailoverTarget, func(ctx context.Context, m Mirror) error {
+			return downloadTarget(ctx, m.Remote, c.progress(dst, m, path, meta, 0), path, meta)
+		})
+	}
 
-		meta = c.local.TargetMeta(role, path)
-		if meta != nil {
-			// we found the target!
-			return meta, nil
+	spool, err := ioutil.TempFile("", "tuf-target-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+	err = c.tryMirrors(ctx, c.servedTargets, path, Mirror.ServesTarget, shouldFailoverTarget, func(ctx context.Context, m Mirror) error {
+		if _, err := spool.Seek(0, 0); err != nil {
+			return err
 		}
-		delegations := c.local.TargetDelegations(role, path, pathHex)
-		for _, d := range delegations {
-			roles = append(roles, d.Name)
+		if err := spool.Truncate(0); err != nil {
+			return err
 		}
+		return downloadTarget(ctx, m.Remote, c.progress(spool, m, path, meta, 0), path, meta)
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := spool.Seek(0, 0); err != nil {
+		return err
 	}
-	return meta, nil
+	_, err = io.Copy(dst, spool)
+	return err
 }
 
-// DownloadTarget downloads the target to dst from the remote
-func (c Client) DownloadTarget(dst io.Writer, path string, meta *data.FileMeta) error {
-	reader, err := c.remote.GetTarget(path)
+// downloadTarget copies the target from remote to dst, validating it
+// against meta. Any failure to validate the data read is reported as an
+// ErrChecksumMismatch.
+func downloadTarget(ctx context.Context, remote store.RemoteStore, dst io.Writer, path string, meta *data.FileMeta) error {
+	reader, err := store.RemoteWithContext(remote).GetTargetContext(ctx, path)
 	if err != nil {
 		return err
 	}
@@ -552,6 +847,15 @@ func (c Client) DownloadTarget(dst io.Writer, path string, meta *data.FileMeta)
 		io.LimitReader(reader, meta.Length),
 		dst,
 	)
-	err = utils.ValidateTarget(r, meta)
-	return err
+	if err := utils.ValidateTarget(r, meta); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if _, ok := err.(net.Error); ok {
+			return err
+		}
+		logrus.Debugf("target %s failed validation: %s", path, err)
+		return ErrChecksumMismatch{role: path}
+	}
+	return nil
 }
@@ -1,8 +1,15 @@
 package client
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
 	"testing"
 	"time"
 
@@ -230,6 +237,12 @@ func TestCheckRootExpired(t *testing.T) {
 	assert.IsType(t, tuf.ErrLocalRootExpired{}, err)
 }
 
+// sha256Meta generates the sha256 only FileMeta for raw
+func sha256Meta(raw []byte) *data.FileMeta {
+	hash := sha256.Sum256(raw)
+	return &data.FileMeta{Length: int64(len(raw)), Hashes: data.Hashes{"sha256": hash[:]}}
+}
+
 func TestChecksumMismatch(t *testing.T) {
 	repo := tuf.NewRepo(nil, nil)
 	localStorage := store.NewMemoryStore(nil, nil)
@@ -238,13 +251,13 @@ func TestChecksumMismatch(t *testing.T) {
 
 	sampleTargets := data.NewTargets()
 	orig, err := json.Marshal(sampleTargets)
-	origSha256 := sha256.Sum256(orig)
+	origMeta := sha256Meta(orig)
 	orig[0] = '}' // corrupt data, should be a {
 	assert.NoError(t, err)
 
 	remoteStorage.SetMeta("targets", orig)
 
-	_, _, err = client.downloadSigned("targets", int64(len(orig)), origSha256[:])
+	_, _, err = client.downloadSigned(context.Background(), "targets", int64(len(orig)), origMeta)
 	assert.IsType(t, ErrChecksumMismatch{}, err)
 }
 
@@ -256,12 +269,12 @@ func TestChecksumMatch(t *testing.T) {
 
 	sampleTargets := data.NewTargets()
 	orig, err := json.Marshal(sampleTargets)
-	origSha256 := sha256.Sum256(orig)
+	origMeta := sha256Meta(orig)
 	assert.NoError(t, err)
 
 	remoteStorage.SetMeta("targets", orig)
 
-	_, _, err = client.downloadSigned("targets", int64(len(orig)), origSha256[:])
+	_, _, err = client.downloadSigned(context.Background(), "targets", int64(len(orig)), origMeta)
 	assert.NoError(t, err)
 }
 
@@ -273,7 +286,7 @@ func TestSizeMismatchLong(t *testing.T) {
 
 	sampleTargets := data.NewTargets()
 	orig, err := json.Marshal(sampleTargets)
-	origSha256 := sha256.Sum256(orig)
+	origMeta := sha256Meta(orig)
 	assert.NoError(t, err)
 	l := int64(len(orig))
 
@@ -282,7 +295,7 @@ func TestSizeMismatchLong(t *testing.T) {
 
 	remoteStorage.SetMeta("targets", orig)
 
-	_, _, err = client.downloadSigned("targets", l, origSha256[:])
+	_, _, err = client.downloadSigned(context.Background(), "targets", l, origMeta)
 	// size just limits the data received, the error is caught
 	// either during checksum verification or during json deserialization
 	assert.IsType(t, ErrChecksumMismatch{}, err)
@@ -296,7 +309,7 @@ func TestSizeMismatchShort(t *testing.T) {
 
 	sampleTargets := data.NewTargets()
 	orig, err := json.Marshal(sampleTargets)
-	origSha256 := sha256.Sum256(orig)
+	origMeta := sha256Meta(orig)
 	assert.NoError(t, err)
 	l := int64(len(orig))
 
@@ -304,7 +317,7 @@ func TestSizeMismatchShort(t *testing.T) {
 
 	remoteStorage.SetMeta("targets", orig)
 
-	_, _, err = client.downloadSigned("targets", l, origSha256[:])
+	_, _, err = client.downloadSigned(context.Background(), "targets", l, origMeta)
 	// size just limits the data received, the error is caught
 	// either during checksum verification or during json deserialization
 	assert.IsType(t, ErrChecksumMismatch{}, err)
@@ -326,7 +339,7 @@ func TestDownloadTargetsHappy(t *testing.T) {
 	// call repo.SignSnapshot to update the targets role in the snapshot
 	repo.SignSnapshot(data.DefaultExpires("snapshot"), nil)
 
-	err = client.downloadTargets("targets")
+	err = client.downloadTargets(context.Background(), "targets")
 	assert.NoError(t, err)
 }
 
@@ -364,7 +377,63 @@ func TestDownloadTargetChecksumMismatch(t *testing.T) {
 
 	repo.Snapshot = &snap
 
-	err = client.downloadTargets("targets")
+	err = client.downloadTargets(context.Background(), "targets")
+	assert.IsType(t, ErrChecksumMismatch{}, err)
+}
+
+func TestDownloadTargetsWrongVersion(t *testing.T) {
+	kdb, repo, _ := testutils.EmptyRepo()
+	localStorage := store.NewMemoryStore(nil, nil)
+	remoteStorage := store.NewMemoryStore(nil, nil)
+	client := NewClient(repo, remoteStorage, kdb, localStorage)
+
+	signedOrig, err := repo.SignTargets("targets", data.DefaultExpires("targets"), nil)
+	assert.NoError(t, err)
+	orig, err := json.Marshal(signedOrig)
+	assert.NoError(t, err)
+	err = remoteStorage.SetMeta("targets", orig)
+	assert.NoError(t, err)
+	_, err = repo.SignSnapshot(data.DefaultExpires("snapshot"), nil)
+	assert.NoError(t, err)
+
+	meta := repo.Snapshot.Signed.Meta["targets"]
+	assert.Equal(t, 1, meta.Version)
+	meta.Version = 2
+	repo.Snapshot.Signed.Meta["targets"] = meta
+
+	err = client.downloadTargets(context.Background(), "targets")
+	assert.Equal(t, ErrWrongMetaVersion{Role: "targets", Declared: 2, Actual: 1}, err)
+
+	// meta without a version is not checked
+	meta.Version = 0
+	repo.Snapshot.Signed.Meta["targets"] = meta
+	err = client.downloadTargets(context.Background(), "targets")
+	assert.NoError(t, err)
+}
+
+func TestDownloadTargetsStrongestHash(t *testing.T) {
+	kdb, repo, _ := testutils.EmptyRepo()
+	remoteStorage := store.NewMemoryStore(nil, nil)
+	assert.NoError(t, repo.SetMetaHashAlgorithms("sha256", "blake2b"))
+
+	signedOrig, err := repo.SignTargets("targets", data.DefaultExpires("targets"), nil)
+	assert.NoError(t, err)
+	orig, err := json.Marshal(signedOrig)
+	assert.NoError(t, err)
+	err = remoteStorage.SetMeta("targets", orig)
+	assert.NoError(t, err)
+	_, err = repo.SignSnapshot(data.DefaultExpires("snapshot"), nil)
+	assert.NoError(t, err)
+
+	// only blake2b, the strongest hash, is checked
+	repo.Snapshot.Signed.Meta["targets"].Hashes["sha256"] = []byte("wrong")
+	client := NewClient(repo, remoteStorage, kdb, store.NewMemoryStore(nil, nil))
+	err = client.downloadTargets(context.Background(), "targets")
+	assert.NoError(t, err)
+
+	repo.Snapshot.Signed.Meta["targets"].Hashes["blake2b"] = []byte("wrong")
+	client = NewClient(repo, remoteStorage, kdb, store.NewMemoryStore(nil, nil))
+	err = client.downloadTargets(context.Background(), "targets")
 	assert.IsType(t, ErrChecksumMismatch{}, err)
 }
 
@@ -386,7 +455,7 @@ func TestDownloadTargetsNoChecksum(t *testing.T) {
 
 	delete(repo.Snapshot.Signed.Meta["targets"].Hashes, "sha256")
 
-	err = client.downloadTargets("targets")
+	err = client.downloadTargets(context.Background(), "targets")
 	assert.IsType(t, ErrMissingMeta{}, err)
 }
 
@@ -408,7 +477,7 @@ func TestDownloadTargetsNoSnapshot(t *testing.T) {
 
 	repo.Snapshot = nil
 
-	err = client.downloadTargets("targets")
+	err = client.downloadTargets(context.Background(), "targets")
 	assert.IsType(t, ErrMissingMeta{}, err)
 }
 
@@ -429,7 +498,7 @@ func TestBootstrapDownloadRootHappy(t *testing.T) {
 	// unset snapshot as if we're bootstrapping from nothing
 	repo.Snapshot = nil
 
-	err = client.downloadRoot()
+	err = client.downloadRoot(context.Background())
 	assert.NoError(t, err)
 }
 
@@ -450,7 +519,7 @@ func TestUpdateDownloadRootHappy(t *testing.T) {
 	// sign snapshot to make root meta in snapshot get updated
 	signedOrig, err = repo.SignSnapshot(data.DefaultExpires("snapshot"), nil)
 
-	err = client.downloadRoot()
+	err = client.downloadRoot(context.Background())
 	assert.NoError(t, err)
 }
 
@@ -474,7 +543,7 @@ func TestUpdateDownloadRootBadChecksum(t *testing.T) {
 
 	// don't sign snapshot again to ensure checksum is out of date (bad)
 
-	err = client.downloadRoot()
+	err = client.downloadRoot(context.Background())
 	assert.IsType(t, ErrChecksumMismatch{}, err)
 }
 
@@ -492,7 +561,7 @@ func TestDownloadTimestampHappy(t *testing.T) {
 	err = remoteStorage.SetMeta("timestamp", orig)
 	assert.NoError(t, err)
 
-	err = client.downloadTimestamp()
+	err = client.downloadTimestamp(context.Background())
 	assert.NoError(t, err)
 }
 
@@ -517,7 +586,7 @@ func TestDownloadSnapshotHappy(t *testing.T) {
 	err = remoteStorage.SetMeta("timestamp", orig)
 	assert.NoError(t, err)
 
-	err = client.downloadSnapshot()
+	err = client.downloadSnapshot(context.Background())
 	assert.NoError(t, err)
 }
 
@@ -539,7 +608,7 @@ func TestDownloadSnapshotNoTimestamp(t *testing.T) {
 
 	repo.Timestamp = nil
 
-	err = client.downloadSnapshot()
+	err = client.downloadSnapshot(context.Background())
 	assert.IsType(t, ErrMissingMeta{}, err)
 }
 
@@ -559,7 +628,7 @@ func TestDownloadSnapshotNoChecksum(t *testing.T) {
 
 	delete(repo.Timestamp.Signed.Meta["snapshot"].Hashes, "sha256")
 
-	err = client.downloadSnapshot()
+	err = client.downloadSnapshot(context.Background())
 	assert.IsType(t, ErrMissingMeta{}, err)
 }
 
@@ -583,6 +652,378 @@ func TestDownloadSnapshotBadChecksum(t *testing.T) {
 
 	// by not signing timestamp again we ensure it has the wrong checksum
 
-	err = client.downloadSnapshot()
+	err = client.downloadSnapshot(context.Background())
 	assert.IsType(t, ErrChecksumMismatch{}, err)
 }
+
+// rotatedRoot generates a root of the given version containing only the
+// given root key, signed by each of the signing keys.
+func rotatedRoot(t *testing.T, cs signed.CryptoService, version int, key data.PublicKey, signers ...data.PublicKey) []byte {
+	role, err := data.NewRole("root", 1, []string{key.ID()}, nil, nil)
+	assert.NoError(t, err)
+	root, err := data.NewRoot(
+		map[string]data.PublicKey{key.ID(): key},
+		map[string]*data.RootRole{"root": &role.RootRole},
+		false,
+	)
+	assert.NoError(t, err)
+	root.Signed.Version = version
+	s, err := root.ToSigned()
+	assert.NoError(t, err)
+	err = signed.Sign(cs, s, signers...)
+	assert.NoError(t, err)
+	raw, err := json.Marshal(s)
+	assert.NoError(t, err)
+	return raw
+}
+
+func TestDownloadRootChain(t *testing.T) {
+	kdb := keys.NewDB()
+	signer := signed.NewEd25519()
+	repo := tuf.NewRepo(kdb, signer)
+	remote := store.NewMemoryStore(nil, nil)
+	cache := store.NewMemoryStore(nil, nil)
+	client := NewClient(repo, remote, kdb, cache)
+
+	key1, err := signer.Create("root", data.ED25519Key)
+	assert.NoError(t, err)
+	key2, err := signer.Create("root", data.ED25519Key)
+	assert.NoError(t, err)
+	key3, err := signer.Create("root", data.ED25519Key)
+	assert.NoError(t, err)
+
+	// the client bootstraps trust with only the first root key
+	rootRole, err := data.NewRole("root", 1, []string{key1.ID()}, nil, nil)
+	assert.NoError(t, err)
+	kdb.AddKey(key1)
+	assert.NoError(t, kdb.AddRole(rootRole))
+
+	// each rotation is signed by the previous and the new key
+	remote.SetMeta("1.root", rotatedRoot(t, signer, 1, key1, key1))
+	remote.SetMeta("2.root", rotatedRoot(t, signer, 2, key2, key1, key2))
+	latest := rotatedRoot(t, signer, 3, key3, key2, key3)
+	remote.SetMeta("3.root", latest)
+	remote.SetMeta("root", latest)
+
+	err = client.downloadRoot(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, repo.Root.Signed.Version)
+	assert.Equal(t, []string{key3.ID()}, kdb.GetRole("root").KeyIDs)
+
+	cached, err := cache.GetMeta("root", maxSize)
+	assert.NoError(t, err)
+	assert.Equal(t, latest, cached)
+}
+
+func TestDownloadRootChainSkippedRotation(t *testing.T) {
+	kdb := keys.NewDB()
+	signer := signed.NewEd25519()
+	repo := tuf.NewRepo(kdb, signer)
+	remote := store.NewMemoryStore(nil, nil)
+	cache := store.NewMemoryStore(nil, nil)
+	client := NewClient(repo, remote, kdb, cache)
+
+	key1, err := signer.Create("root", data.ED25519Key)
+	assert.NoError(t, err)
+	key2, err := signer.Create("root", data.ED25519Key)
+	assert.NoError(t, err)
+
+	rootRole, err := data.NewRole("root", 1, []string{key1.ID()}, nil, nil)
+	assert.NoError(t, err)
+	kdb.AddKey(key1)
+	assert.NoError(t, kdb.AddRole(rootRole))
+
+	// version 2 is not signed by the version 1 key so must be rejected
+	remote.SetMeta("1.root", rotatedRoot(t, signer, 1, key1, key1))
+	remote.SetMeta("2.root", rotatedRoot(t, signer, 2, key2, key2))
+
+	err = client.downloadRoot(context.Background())
+	assert.IsType(t, signed.ErrRoleThreshold{}, err)
+	assert.Equal(t, 1, repo.Root.Signed.Version)
+	assert.Equal(t, []string{key1.ID()}, kdb.GetRole("root").KeyIDs)
+}
+
+func TestDownloadRootChainWrongVersion(t *testing.T) {
+	kdb := keys.NewDB()
+	signer := signed.NewEd25519()
+	repo := tuf.NewRepo(kdb, signer)
+	remote := store.NewMemoryStore(nil, nil)
+	cache := store.NewMemoryStore(nil, nil)
+	client := NewClient(repo, remote, kdb, cache)
+
+	key1, err := signer.Create("root", data.ED25519Key)
+	assert.NoError(t, err)
+	rootRole, err := data.NewRole("root", 1, []string{key1.ID()}, nil, nil)
+	assert.NoError(t, err)
+	kdb.AddKey(key1)
+	assert.NoError(t, kdb.AddRole(rootRole))
+
+	remote.SetMeta("1.root", rotatedRoot(t, signer, 5, key1, key1))
+
+	err = client.downloadRoot(context.Background())
+	assert.IsType(t, ErrWrongRootVersion{}, err)
+}
+
+func TestDownloadRootChainTooLong(t *testing.T) {
+	defer func(max int) { maxRootRotations = max }(maxRootRotations)
+	maxRootRotations = 2
+
+	kdb := keys.NewDB()
+	signer := signed.NewEd25519()
+	repo := tuf.NewRepo(kdb, signer)
+	remote := store.NewMemoryStore(nil, nil)
+	var requested []string
+	client := NewClient(repo, recordingStore{RemoteStore: remote, requested: &requested}, kdb, store.NewMemoryStore(nil, nil))
+
+	key, err := signer.Create("root", data.ED25519Key)
+	assert.NoError(t, err)
+	rootRole, err := data.NewRole("root", 1, []string{key.ID()}, nil, nil)
+	assert.NoError(t, err)
+	kdb.AddKey(key)
+	assert.NoError(t, kdb.AddRole(rootRole))
+	for version := 1; version <= 3; version++ {
+		remote.SetMeta(fmt.Sprintf("%d.root", version), rotatedRoot(t, signer, version, key, key))
+	}
+
+	version, err := client.downloadRootChain(context.Background(), 0)
+	assert.Equal(t, ErrTooManyRootRotations{Max: 2}, err)
+	assert.Equal(t, 2, version)
+	assert.Equal(t, 2, repo.Root.Signed.Version)
+	// the root beyond the limit is never requested
+	assert.Equal(t, []string{"1.root", "2.root"}, requested)
+}
+
+// recordingStore is a RemoteStore recording the metadata it is asked for
+type recordingStore struct {
+	store.RemoteStore
+	requested *[]string
+}
+
+func (r recordingStore) GetMeta(name string, size int64) ([]byte, error) {
+	*r.requested = append(*r.requested, name)
+	return r.RemoteStore.GetMeta(name, size)
+}
+
+// failingStore is a RemoteStore that always returns err
+type failingStore struct {
+	store.RemoteStore
+	err error
+}
+
+func (f failingStore) GetMeta(name string, size int64) ([]byte, error) {
+	return nil, f.err
+}
+
+func (f failingStore) GetTarget(path string) (io.ReadCloser, error) {
+	return nil, f.err
+}
+
+func TestMirrorFailoverMeta(t *testing.T) {
+	good := []byte(`{"signed":{},"signatures":[]}`)
+	goodMeta := sha256Meta(good)
+	central := store.NewMemoryStore(map[string][]byte{"timestamp": good}, nil)
+	all := []string{"**"}
+
+	failures := []store.RemoteStore{
+		failingStore{err: store.ErrServerUnavailable{}},
+		failingStore{err: store.ErrMaliciousServer{}},
+		failingStore{err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}},
+		store.NewMemoryStore(map[string][]byte{"timestamp": []byte(`{"signed":{"x":1},"signatures":[]}`)}, nil),
+	}
+	for _, edge := range failures {
+		client := NewMirroredClient(nil, []Mirror{
+			{Name: "edge", Remote: edge, MetaPatterns: all},
+			{Name: "central", Remote: central, MetaPatterns: all},
+		}, nil, nil)
+		raw, _, err := client.downloadSigned(context.Background(), "timestamp", maxSize, goodMeta)
+		assert.NoError(t, err)
+		assert.Equal(t, good, raw)
+		mirror, ok := client.MetaServedBy("timestamp")
+		assert.True(t, ok)
+		assert.Equal(t, "central", mirror)
+	}
+
+	// a mirror not having the file is authoritative
+	client := NewMirroredClient(nil, []Mirror{
+		{Name: "edge", Remote: store.NewMemoryStore(nil, nil), MetaPatterns: all},
+		{Name: "central", Remote: central, MetaPatterns: all},
+	}, nil, nil)
+	_, _, err := client.downloadSigned(context.Background(), "timestamp", maxSize, goodMeta)
+	assert.IsType(t, store.ErrMetaNotFound{}, err)
+
+	// mirrors are only asked for metadata matching their patterns
+	client = NewMirroredClient(nil, []Mirror{
+		{Name: "edge", Remote: failingStore{err: errors.New("should not be called")}, TargetPatterns: all},
+		{Name: "central", Remote: central, MetaPatterns: []string{"time*"}},
+	}, nil, nil)
+	_, _, err = client.downloadSigned(context.Background(), "timestamp", maxSize, goodMeta)
+	assert.NoError(t, err)
+	_, _, err = client.downloadSigned(context.Background(), "snapshot", maxSize, nil)
+	assert.Equal(t, ErrNoMirror{File: "snapshot"}, err)
+}
+
+func TestMirrorFailoverTarget(t *testing.T) {
+	content := []byte("target contents")
+	meta, err := data.NewFileMeta(bytes.NewReader(content), "sha256")
+	assert.NoError(t, err)
+	edge := store.NewMemoryStore(nil, map[string][]byte{"a/b": []byte("corrupt contents")})
+	central := store.NewMemoryStore(nil, map[string][]byte{"a/b": content})
+
+	client := NewMirroredClient(nil, []Mirror{
+		{Name: "edge", Remote: edge, TargetPatterns: []string{"a/*"}},
+		{Name: "central", Remote: central, TargetPatterns: []string{"**"}},
+	}, nil, nil)
+	dst := &bytes.Buffer{}
+	err = client.DownloadTarget(dst, "a/b", &meta)
+	assert.NoError(t, err)
+	assert.Equal(t, content, dst.Bytes())
+	mirror, ok := client.TargetServedBy("a/b")
+	assert.True(t, ok)
+	assert.Equal(t, "central", mirror)
+
+	// a mirror not having the target is not authoritative
+	client = NewMirroredClient(nil, []Mirror{
+		{Name: "edge", Remote: failingStore{err: store.ErrMetaNotFound{}}, TargetPatterns: []string{"**"}},
+		{Name: "central", Remote: central, TargetPatterns: []string{"**"}},
+	}, nil, nil)
+	dst = &bytes.Buffer{}
+	assert.NoError(t, client.DownloadTarget(dst, "a/b", &meta))
+	assert.Equal(t, content, dst.Bytes())
+	mirror, _ = client.TargetServedBy("a/b")
+	assert.Equal(t, "central", mirror)
+
+	// with a single mirror the failure is reported
+	client = NewClient(nil, edge, nil, nil)
+	err = client.DownloadTarget(&bytes.Buffer{}, "a/b", &meta)
+	assert.Equal(t, ErrChecksumMismatch{role: "a/b"}, err)
+}
+
+func TestMirrorServedConcurrent(t *testing.T) {
+	files := make(map[string][]byte)
+	metas := make(map[string]data.FileMeta)
+	for i := 0; i < 10; i++ {
+		path := fmt.Sprintf("target-%d", i)
+		files[path] = []byte(path)
+		meta, err := data.NewFileMeta(bytes.NewReader(files[path]), "sha256")
+		assert.NoError(t, err)
+		metas[path] = meta
+	}
+	client := NewClient(nil, store.NewMemoryStore(nil, files), nil, nil)
+
+	wg := sync.WaitGroup{}
+	for path := range files {
+		meta := metas[path]
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			assert.NoError(t, client.DownloadTarget(&bytes.Buffer{}, path, &meta))
+		}(path)
+	}
+	wg.Wait()
+	for path := range files {
+		mirror, ok := client.TargetServedBy(path)
+		assert.True(t, ok)
+		assert.Equal(t, "remote", mirror)
+	}
+}
+
+// stalledStore is a RemoteStore whose metadata requests never complete
+type stalledStore struct {
+	store.RemoteStore
+}
+
+func (s stalledStore) GetMeta(name string, size int64) ([]byte, error) {
+	select {}
+}
+
+func TestMirrorRequestTimeout(t *testing.T) {
+	good := []byte(`{"signed":{},"signatures":[]}`)
+	all := []string{"**"}
+	client := NewMirroredClient(nil, []Mirror{
+		{Name: "edge", Remote: stalledStore{}, MetaPatterns: all},
+		{Name: "central", Remote: store.NewMemoryStore(map[string][]byte{"timestamp": good}, nil), MetaPatterns: all},
+	}, nil, nil)
+	client.SetRequestTimeout(10 * time.Millisecond)
+
+	raw, _, err := client.downloadSigned(context.Background(), "timestamp", maxSize, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, good, raw)
+	mirror, _ := client.MetaServedBy("timestamp")
+	assert.Equal(t, "central", mirror)
+}
+
+func TestUpdateBudget(t *testing.T) {
+	kdb := keys.NewDB()
+	repo := tuf.NewRepo(kdb, nil)
+	cache := store.NewMemoryStore(nil, nil)
+	client := NewClient(repo, stalledStore{}, kdb, cache)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := client.UpdateContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// nothing was written to the cache
+	_, err = cache.GetMeta("timestamp", maxSize)
+	assert.IsType(t, store.ErrMetaNotFound{}, err)
+	_, err = cache.GetMeta("root", maxSize)
+	assert.IsType(t, store.ErrMetaNotFound{}, err)
+}
+
+func TestObserverEvents(t *testing.T) {
+	kdb := keys.NewDB()
+	signer := signed.NewEd25519()
+	repo := tuf.NewRepo(kdb, signer)
+	remote := store.NewMemoryStore(nil, nil)
+	client := NewMirroredClient(repo, []Mirror{
+		{Name: "edge", Remote: failingStore{err: store.ErrServerUnavailable{}}, MetaPatterns: []string{"root"}},
+		{Name: "central", Remote: remote, MetaPatterns: []string{"**"}},
+	}, kdb, store.NewMemoryStore(nil, nil))
+	var events []Event
+	client.SetObserver(ObserverFunc(func(e Event) {
+		events = append(events, e)
+	}))
+
+	key1, err := signer.Create("root", data.ED25519Key)
+	assert.NoError(t, err)
+	key2, err := signer.Create("root", data.ED25519Key)
+	assert.NoError(t, err)
+	rootRole, err := data.NewRole("root", 1, []string{key1.ID()}, nil, nil)
+	assert.NoError(t, err)
+	kdb.AddKey(key1)
+	assert.NoError(t, kdb.AddRole(rootRole))
+
+	remote.SetMeta("1.root", rotatedRoot(t, signer, 1, key1, key1))
+	latest := rotatedRoot(t, signer, 2, key2, key1, key2)
+	remote.SetMeta("2.root", latest)
+	remote.SetMeta("root", latest)
+
+	err = client.downloadRoot(context.Background())
+	assert.NoError(t, err)
+
+	var rotations []RootRotated
+	var failovers []MirrorFailover
+	finished := make(map[string]MetaFetchFinished)
+	verified := make(map[string]MetaVerified)
+	for _, e := range events {
+		switch e := e.(type) {
+		case RootRotated:
+			rotations = append(rotations, e)
+		case MirrorFailover:
+			failovers = append(failovers, e)
+		case MetaFetchFinished:
+			finished[e.Role] = e
+		case MetaVerified:
+			verified[e.Role] = e
+		}
+	}
+	assert.Equal(t, []RootRotated{{0, 1}, {1, 2}}, rotations)
+	assert.Equal(t, []MirrorFailover{{File: "root", Mirror: "edge", Err: store.ErrServerUnavailable{}}}, failovers)
+
+	assert.Equal(t, MetaFetchFinished{Role: "root", Mirror: "central", Size: int64(len(latest)), Version: 2}, finished["root"])
+	assert.Equal(t, "2.root", finished["2.root"].Role)
+	assert.Equal(t, 2, finished["2.root"].Version)
+	assert.IsType(t, store.ErrMetaNotFound{}, finished["3.root"].Err)
+	assert.Equal(t, MetaVerified{Role: "root", Version: 2}, verified["root"])
+	assert.Equal(t, MetaVerified{Role: "1.root", Version: 1}, verified["1.root"])
+}
@@ -0,0 +1,173 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/store"
+)
+
+// partialSuffix is appended to the destination path of DownloadTargetTo
+// to name the file the target is downloaded into before it is verified
+const partialSuffix = ".part"
+
+// DownloadTargetTo downloads the target at path to the file dst. The target
+// is first written to dst with ".part" appended, and only moved to dst once
+// it has been verified against meta. If a download is interrupted, the next
+// call resumes from the end of the partial file, requesting only the
+// remaining bytes from mirrors that support ranges. The same applies when
+// failing over between mirrors part way through a target.
+func (c Client) DownloadTargetTo(dst, path string, meta *data.FileMeta) error {
+	return c.DownloadTargetToContext(context.Background(), dst, path, meta)
+}
+
+// DownloadTargetToContext is DownloadTargetTo, abandoning the download if
+// ctx is done. The partial file is kept so the download can be resumed.
+func (c Client) DownloadTargetToContext(ctx context.Context, dst, path string, meta *data.FileMeta) error {
+	hashAlgorithm, ok := data.StrongestHash(meta.Hashes)
+	if !ok {
+		return ErrMissingMeta{role: path}
+	}
+	expected := meta.Hashes[hashAlgorithm]
+	alg, _ := data.GetHashAlgorithm(hashAlgorithm)
+	partial, err := openPartial(dst+partialSuffix, meta.Length, alg)
+	if err != nil {
+		return err
+	}
+	defer partial.Close()
+
+	err = c.tryMirrors(ctx, c.servedTargets, path, Mirror.ServesTarget, shouldFailoverTarget, func(ctx context.Context, m Mirror) error {
+		for {
+			resumed := partial.offset > 0
+			progress := c.progress(ioutil.Discard, m, path, meta, partial.offset)
+			err := partial.fetch(ctx, m.Remote, path, progress)
+			if _, ok := err.(store.ErrRangeMismatch); ok && resumed {
+				// the mirror cannot be relied on to resume the download
+				logrus.Debugf("mirror %s could not resume %s, restarting it: %s", m.Name, path, err)
+				if err := partial.reset(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if bytes.Equal(partial.hash.Sum(nil), expected) {
+				return nil
+			}
+			if err := partial.reset(); err != nil {
+				return err
+			}
+			if !resumed {
+				logrus.Debugf("target %s from mirror %s failed validation, discarding it", path, m.Name)
+				return ErrChecksumMismatch{role: path}
+			}
+			// the bytes we resumed from may belong to a different version
+			// of the target, so try once more from the beginning
+			logrus.Debugf("resumed download of %s failed validation, restarting it", path)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if err := partial.file.Sync(); err != nil {
+		return err
+	}
+	if err := partial.Close(); err != nil {
+		return err
+	}
+	return os.Rename(partial.file.Name(), dst)
+}
+
+// partialTarget is a target that has been partially downloaded to disk,
+// along with the running hash of the bytes downloaded so far
+type partialTarget struct {
+	file   *os.File
+	hash   hash.Hash
+	offset int64
+	length int64
+	closed bool
+}
+
+// openPartial opens, or creates, the partial file for a target of the given
+// length, hashing any bytes already downloaded with alg. A partial file
+// longer than the target cannot be a prefix of it and is discarded.
+func openPartial(name string, length int64, alg data.HashAlgorithm) (*partialTarget, error) {
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	p := &partialTarget{file: file, hash: alg.New(), length: length}
+	n, err := io.Copy(p.hash, file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	p.offset = n
+	if n > length {
+		logrus.Debugf("partial download %s is longer than the target, discarding it", name)
+		if err := p.reset(); err != nil {
+			file.Close()
+			return nil, err
+		}
+	} else if n > 0 {
+		logrus.Debugf("resuming download into %s from offset %d", name, n)
+	}
+	return p, nil
+}
+
+// fetch downloads the remainder of the target from remote, appending it to
+// the partial file and copying it to progress. Bytes successfully written
+// are kept even if an error occurs, so a subsequent fetch continues where
+// this one stopped. At most length bytes are ever accepted.
+func (p *partialTarget) fetch(ctx context.Context, remote store.RemoteStore, path string, progress io.Writer) error {
+	if p.offset == p.length {
+		return nil
+	}
+	r, err := store.RemoteWithContext(remote).GetTargetRange(ctx, path, p.offset)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if _, err := p.file.Seek(p.offset, io.SeekStart); err != nil {
+		return err
+	}
+	n, err := io.Copy(io.MultiWriter(p.file, p.hash, progress), io.LimitReader(r, p.length-p.offset))
+	p.offset += n
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	if p.offset < p.length {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// reset discards everything downloaded so far
+func (p *partialTarget) reset() error {
+	if err := p.file.Truncate(0); err != nil {
+		return err
+	}
+	p.hash.Reset()
+	p.offset = 0
+	return nil
+}
+
+// Close closes the partial file. Closing it again does nothing, so Close
+// may be deferred as well as called once the download is complete.
+func (p *partialTarget) Close() error {
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	return p.file.Close()
+}
@@ -0,0 +1,162 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/store"
+	"github.com/endophage/gotuf/utils"
+)
+
+// rangeStore serves a single target, recording the offset of every
+// request and optionally dropping the connection after limit bytes or
+// refusing to serve from any offset but 0
+type rangeStore struct {
+	store.RemoteStore
+	content    []byte
+	offsets    []int64
+	limit      int
+	wrongRange bool
+}
+
+func (r *rangeStore) GetTargetRange(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	r.offsets = append(r.offsets, offset)
+	if r.wrongRange && offset > 0 {
+		return nil, store.ErrRangeMismatch{Path: path, Offset: offset}
+	}
+	body := r.content[offset:]
+	if r.limit > 0 && len(body) > r.limit {
+		body = body[:r.limit]
+	}
+	return &utils.NoopCloser{Reader: bytes.NewReader(body)}, nil
+}
+
+func TestDownloadTargetToResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tuf-download")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "target")
+
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	meta, err := data.NewFileMeta(bytes.NewReader(content), "sha256")
+	assert.NoError(t, err)
+	remote := &rangeStore{content: content, limit: 300}
+	client := NewClient(nil, remote, nil, nil)
+
+	// the connection drops part way through, leaving a partial download
+	err = client.DownloadTargetTo(dst, "target", &meta)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	partial, err := ioutil.ReadFile(dst + partialSuffix)
+	assert.NoError(t, err)
+	assert.Equal(t, content[:300], partial)
+
+	// later attempts resume from where the last stopped
+	remote.limit = 0
+	err = client.DownloadTargetTo(dst, "target", &meta)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{0, 300}, remote.offsets)
+	downloaded, err := ioutil.ReadFile(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, content, downloaded)
+	_, err = os.Stat(dst + partialSuffix)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadTargetToRangeMismatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tuf-download")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "target")
+
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	meta, err := data.NewFileMeta(bytes.NewReader(content), "sha256")
+	assert.NoError(t, err)
+	remote := &rangeStore{content: content, limit: 300}
+	client := NewClient(nil, remote, nil, nil)
+	err = client.DownloadTargetTo(dst, "target", &meta)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	// the partial download is discarded and the target fetched in full
+	remote.limit = 0
+	remote.wrongRange = true
+	err = client.DownloadTargetTo(dst, "target", &meta)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{0, 300, 0}, remote.offsets)
+	downloaded, err := ioutil.ReadFile(dst)
+	assert.NoError(t, err)
+	assert.Equal(t, content, downloaded)
+}
+
+func TestDownloadTargetToBadPartial(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tuf-download")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "target")
+
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	meta, err := data.NewFileMeta(bytes.NewReader(content), "sha256")
+	assert.NoError(t, err)
+
+	for _, partial := range [][]byte{
+		// not a prefix of the target, restarted once the mismatch is found
+		bytes.Repeat([]byte("x"), 500),
+		// longer than the target, discarded before downloading
+		bytes.Repeat([]byte("x"), 2000),
+	} {
+		assert.NoError(t, ioutil.WriteFile(dst+partialSuffix, partial, 0600))
+		remote := &rangeStore{content: content}
+		client := NewClient(nil, remote, nil, nil)
+		err = client.DownloadTargetTo(dst, "target", &meta)
+		assert.NoError(t, err)
+		downloaded, err := ioutil.ReadFile(dst)
+		assert.NoError(t, err)
+		assert.Equal(t, content, downloaded)
+	}
+
+	// a target that never validates is reported and not kept
+	os.Remove(dst)
+	remote := &rangeStore{content: bytes.Repeat([]byte("y"), 1000)}
+	client := NewClient(nil, remote, nil, nil)
+	err = client.DownloadTargetTo(dst, "target", &meta)
+	assert.Equal(t, ErrChecksumMismatch{role: "target"}, err)
+	_, err = os.Stat(dst)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadTargetToProgress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tuf-download")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "target")
+
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	meta, err := data.NewFileMeta(bytes.NewReader(content), "sha256")
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(dst+partialSuffix, content[:400], 0600))
+
+	client := NewClient(nil, &rangeStore{content: content}, nil, nil)
+	var progress []TargetProgress
+	client.SetObserver(ObserverFunc(func(e Event) {
+		if p, ok := e.(TargetProgress); ok {
+			progress = append(progress, p)
+		}
+	}))
+	err = client.DownloadTargetTo(dst, "target", &meta)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, progress)
+	for _, p := range progress {
+		assert.Equal(t, "target", p.Path)
+		assert.Equal(t, "remote", p.Mirror)
+		assert.Equal(t, int64(1000), p.Total)
+		assert.True(t, p.Transferred > 400)
+	}
+	assert.Equal(t, int64(1000), progress[len(progress)-1].Transferred)
+}
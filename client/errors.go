@@ -3,6 +3,8 @@ package client
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 )
 
 // Simple client errors
@@ -20,13 +22,103 @@ func (e ErrChecksumMismatch) Error() string {
 	return fmt.Sprintf("tuf: checksum for %s did not match", e.role)
 }
 
+// ErrWrongRootVersion - a root in the rotation chain did not have the
+// version its file name claimed
+type ErrWrongRootVersion struct {
+	Expected int
+	Actual   int
+}
+
+func (e ErrWrongRootVersion) Error() string {
+	return fmt.Sprintf("tuf: expected root version %d, got version %d", e.Expected, e.Actual)
+}
+
+// ErrTooManyRootRotations - the remote served more roots in the rotation
+// chain than a single update will accept
+type ErrTooManyRootRotations struct {
+	Max int
+}
+
+func (e ErrTooManyRootRotations) Error() string {
+	return fmt.Sprintf("tuf: more than %d root rotations in a single update", e.Max)
+}
+
+// ErrWrongMetaVersion - metadata did not have the version declared for it
+// by the metadata referencing it
+type ErrWrongMetaVersion struct {
+	Role     string
+	Declared int
+	Actual   int
+}
+
+func (e ErrWrongMetaVersion) Error() string {
+	return fmt.Sprintf("tuf: %s version %d was declared, got version %d", e.Role, e.Declared, e.Actual)
+}
+
+// ErrRollback - metadata older than the version previously trusted
+// was received
+type ErrRollback struct {
+	Role     string
+	Trusted  int
+	Received int
+}
+
+func (e ErrRollback) Error() string {
+	return fmt.Sprintf("tuf: rollback attack detected, received %s version %d but version %d is already trusted", e.Role, e.Received, e.Trusted)
+}
+
+// ErrMixAndMatch - metadata conflicting with what was previously trusted
+// was received, either differing from the same version already trusted or
+// not being what the trusted metadata referencing it declared
+type ErrMixAndMatch struct {
+	Role    string
+	Version int
+}
+
+func (e ErrMixAndMatch) Error() string {
+	return fmt.Sprintf("tuf: mix-and-match attack detected, received %s version %d which conflicts with the metadata already trusted", e.Role, e.Version)
+}
+
+// ErrFreeze - no newer timestamp has been seen within the freeze window
+type ErrFreeze struct {
+	LastAdvanced time.Time
+	Window       time.Duration
+}
+
+func (e ErrFreeze) Error() string {
+	return fmt.Sprintf("tuf: freeze attack suspected, timestamp has not advanced since %s (window %s)", e.LastAdvanced.Format(time.RFC3339), e.Window)
+}
+
+// ErrRootHashMismatch - the root served during bootstrap did not have
+// the pinned hash
+type ErrRootHashMismatch struct {
+	Expected []byte
+	Actual   []byte
+}
+
+func (e ErrRootHashMismatch) Error() string {
+	return fmt.Sprintf("tuf: root does not match pinned sha256 %x, got %x", e.Expected, e.Actual)
+}
+
+// ErrRootKeysMismatch - the root served during bootstrap was not signed
+// by a threshold of the pinned root keys
+type ErrRootKeysMismatch struct {
+	KeyIDs    []string
+	Threshold int
+	Err       error
+}
+
+func (e ErrRootKeysMismatch) Error() string {
+	return fmt.Sprintf("tuf: root is not signed by %d of the pinned root keys %s: %s", e.Threshold, strings.Join(e.KeyIDs, ", "), e.Err)
+}
+
 // ErrMissingMeta - couldn't find the FileMeta object for a role or target
 type ErrMissingMeta struct {
 	role string
 }
 
 func (e ErrMissingMeta) Error() string {
-	return fmt.Sprintf("tuf: sha256 checksum required for %s", e.role)
+	return fmt.Sprintf("tuf: checksum using a supported hash algorithm required for %s", e.role)
 }
 
 // ErrMissingRemoteMetadata - remote didn't have requested metadata
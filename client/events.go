@@ -0,0 +1,154 @@
+package client
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/endophage/gotuf/data"
+)
+
+// Observer receives events describing the progress of a Client. OnEvent is
+// called synchronously from the goroutine doing the work, so it should
+// return promptly.
+type Observer interface {
+	OnEvent(e Event)
+}
+
+// ObserverFunc allows a plain function to be used as an Observer
+type ObserverFunc func(e Event)
+
+// OnEvent calls f(e)
+func (f ObserverFunc) OnEvent(e Event) {
+	f(e)
+}
+
+// Event is implemented by each of the event types passed to an Observer
+type Event interface {
+	event()
+}
+
+// MetaFetchStarted - a metadata file is about to be downloaded. MaxSize is
+// the largest the file is permitted to be.
+type MetaFetchStarted struct {
+	Role    string
+	MaxSize int64
+}
+
+// MetaFetchFinished - a metadata file download completed. Mirror is the
+// mirror that served it and is empty if Err is set. Version is 0 if the
+// file could not be parsed.
+type MetaFetchFinished struct {
+	Role    string
+	Mirror  string
+	Size    int64
+	Version int
+	Err     error
+}
+
+// MetaCacheHit - a metadata file was loaded from the cache rather than
+// being downloaded
+type MetaCacheHit struct {
+	Role    string
+	Size    int64
+	Version int
+}
+
+// MetaVerified - a metadata file's signatures, version and expiry were
+// checked. Err is nil if it was accepted.
+type MetaVerified struct {
+	Role    string
+	Version int
+	Err     error
+}
+
+// RootRotated - a newer root was accepted
+type RootRotated struct {
+	FromVersion int
+	ToVersion   int
+}
+
+// TargetProgress - more of a target has been downloaded. Transferred
+// includes any bytes downloaded by an earlier, resumed, attempt.
+type TargetProgress struct {
+	Path        string
+	Mirror      string
+	Transferred int64
+	Total       int64
+}
+
+// MirrorFailover - a mirror failed to serve a file and the next mirror
+// will be tried
+type MirrorFailover struct {
+	File   string
+	Mirror string
+	Err    error
+}
+
+func (MetaFetchStarted) event()  {}
+func (MetaFetchFinished) event() {}
+func (MetaCacheHit) event()      {}
+func (MetaVerified) event()      {}
+func (RootRotated) event()       {}
+func (TargetProgress) event()    {}
+func (MirrorFailover) event()    {}
+
+// SetObserver registers the observer to be notified of the client's
+// progress. Only one observer is supported, a nil observer disables
+// notifications.
+func (c *Client) SetObserver(o Observer) {
+	c.observer = o
+}
+
+func (c Client) notify(e Event) {
+	if c.observer != nil {
+		c.observer.OnEvent(e)
+	}
+}
+
+// signedVersion returns the version of the signed metadata, or 0 if it
+// can't be determined
+func signedVersion(s *data.Signed) int {
+	if s == nil {
+		return 0
+	}
+	common := data.SignedCommon{}
+	if err := json.Unmarshal(s.Signed, &common); err != nil {
+		return 0
+	}
+	return common.Version
+}
+
+// progress wraps w so that writes to it are reported as TargetProgress
+// events, starting from offset bytes already transferred
+func (c Client) progress(w io.Writer, m Mirror, path string, meta *data.FileMeta, offset int64) io.Writer {
+	if c.observer == nil {
+		return w
+	}
+	return io.MultiWriter(w, &progressWriter{
+		c:           c,
+		path:        path,
+		mirror:      m.Name,
+		transferred: offset,
+		total:       meta.Length,
+	})
+}
+
+// progressWriter reports the bytes written through it as TargetProgress
+type progressWriter struct {
+	c           Client
+	path        string
+	mirror      string
+	transferred int64
+	total       int64
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	w.transferred += int64(len(b))
+	w.c.notify(TargetProgress{
+		Path:        w.path,
+		Mirror:      w.mirror,
+		Transferred: w.transferred,
+		Total:       w.total,
+	})
+	return len(b), nil
+}
@@ -0,0 +1,152 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/store"
+)
+
+// Mirror is a remote source of TUF metadata and targets. MetaPatterns and
+// TargetPatterns restrict which metadata names and target paths may be
+// requested from the mirror, and are matched with data.MatchPath. A mirror
+// with no patterns of a kind is never asked for files of that kind, use
+// "**" to allow everything.
+type Mirror struct {
+	Name           string
+	Remote         store.RemoteStore
+	MetaPatterns   []string
+	TargetPatterns []string
+}
+
+// ServesMeta checks if the mirror may be asked for the named metadata
+func (m Mirror) ServesMeta(name string) bool {
+	return matchAny(m.MetaPatterns, name)
+}
+
+// ServesTarget checks if the mirror may be asked for the target path
+func (m Mirror) ServesTarget(path string) bool {
+	return matchAny(m.TargetPatterns, path)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if data.MatchPath(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrNoMirror - no configured mirror may serve the requested file
+type ErrNoMirror struct {
+	File string
+}
+
+func (e ErrNoMirror) Error() string {
+	return "tuf: no mirror configured to serve " + e.File
+}
+
+// shouldFailover determines if an error from a mirror means the same file
+// should be requested from the next mirror. Errors such as the metadata not
+// existing are authoritative and returned to the caller immediately.
+func shouldFailover(err error) bool {
+	if err == io.ErrUnexpectedEOF {
+		// the connection was dropped part way through the file
+		return true
+	}
+	switch err.(type) {
+	case store.ErrServerUnavailable, store.ErrMaliciousServer, ErrChecksumMismatch:
+		return true
+	case net.Error:
+		return true
+	}
+	return false
+}
+
+// shouldFailoverTarget determines if an error from a mirror means the same
+// target should be requested from the next mirror. Unlike metadata, a
+// mirror not having a target is not authoritative, as mirrors may only
+// hold some of the targets they are permitted to serve.
+func shouldFailoverTarget(err error) bool {
+	if _, ok := err.(store.ErrMetaNotFound); ok {
+		return true
+	}
+	return shouldFailover(err)
+}
+
+// servedBy records the mirror each file was most recently downloaded from.
+// It is shared by every copy of a Client, so may be written concurrently.
+type servedBy struct {
+	mu    sync.Mutex
+	files map[string]string
+}
+
+func newServedBy() *servedBy {
+	return &servedBy{files: make(map[string]string)}
+}
+
+func (s *servedBy) set(file, mirror string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[file] = mirror
+}
+
+func (s *servedBy) get(file string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mirror, ok := s.files[file]
+	return mirror, ok
+}
+
+// tryMirrors calls fetch with each mirror in turn, for which serves returns
+// true for file, until one succeeds or returns an error for which failover
+// returns false. The mirror that succeeded is recorded in served as having
+// served file. If every mirror fails, the error from the last one is
+// returned.
+// Each call to fetch is given its own context, derived from ctx, bounded by
+// the client's request timeout. Once ctx itself is done no further mirrors
+// are tried.
+func (c *Client) tryMirrors(ctx context.Context, served *servedBy, file string, serves func(Mirror, string) bool, failover func(error) bool, fetch func(context.Context, Mirror) error) error {
+	var err error = ErrNoMirror{File: file}
+	for _, m := range c.mirrors {
+		if !serves(m, file) {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		reqCtx, cancel := c.requestContext(ctx)
+		err = fetch(reqCtx, m)
+		cancel()
+		if err == nil {
+			served.set(file, m.Name)
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !failover(err) {
+			return err
+		}
+		logrus.Debugf("mirror %s failed to serve %s, trying next mirror: %s", m.Name, file, err)
+		c.notify(MirrorFailover{File: file, Mirror: m.Name, Err: err})
+	}
+	return err
+}
+
+// MetaServedBy returns the name of the mirror the named metadata file was
+// most recently downloaded from.
+func (c *Client) MetaServedBy(name string) (string, bool) {
+	return c.servedMeta.get(name)
+}
+
+// TargetServedBy returns the name of the mirror the target at path was
+// most recently downloaded from.
+func (c *Client) TargetServedBy(path string) (string, bool) {
+	return c.servedTargets.get(path)
+}
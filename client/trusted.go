@@ -0,0 +1,175 @@
+package client
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/store"
+	"github.com/endophage/gotuf/utils"
+)
+
+// trustedStateName is the name the TrustedState is persisted under in the
+// client's cache
+const trustedStateName = "trusted-state"
+
+// TrustedRole is what the client has accepted for a single role
+type TrustedRole struct {
+	Version int    `json:"version"`
+	Sha256  []byte `json:"sha256"`
+}
+
+// TrustedState records the metadata a client has previously accepted so
+// that it can detect being served older, or conflicting, metadata later.
+// Unlike the metadata in the cache, it is never replaced by anything older
+// than what it already holds.
+type TrustedState struct {
+	// Roles is the highest version of each role that has been accepted
+	Roles map[string]TrustedRole `json:"roles"`
+	// Declared is the meta most recently declared for each role by the
+	// role that references it, i.e. snapshot by timestamp and each targets
+	// role by snapshot
+	Declared map[string]data.FileMeta `json:"declared"`
+	// TimestampAdvanced is when a timestamp with a higher version than any
+	// previously accepted was last seen
+	TimestampAdvanced time.Time `json:"timestamp_advanced"`
+}
+
+// NewTrustedState creates an empty TrustedState
+func NewTrustedState() *TrustedState {
+	return &TrustedState{
+		Roles:    make(map[string]TrustedRole),
+		Declared: make(map[string]data.FileMeta),
+	}
+}
+
+// SetFreezeWindow sets how long the client will go without seeing a newer
+// timestamp before deciding it is the victim of a freeze attack, i.e. it
+// is being served stale metadata that has yet to expire. A window of 0
+// disables the check.
+func (c *Client) SetFreezeWindow(window time.Duration) {
+	c.freezeWindow = window
+}
+
+// TrustedState returns the client's trusted state, loading it from the
+// cache if necessary
+func (c *Client) TrustedState() *TrustedState {
+	if c.trusted != nil {
+		return c.trusted
+	}
+	c.trusted = NewTrustedState()
+	if c.cache == nil {
+		return c.trusted
+	}
+	raw, err := c.cache.GetMeta(trustedStateName, maxSize)
+	if err != nil {
+		if _, ok := err.(store.ErrMetaNotFound); !ok {
+			logrus.Errorf("Failed to read trusted state from local cache: %s", err.Error())
+		}
+		return c.trusted
+	}
+	if err := json.Unmarshal(raw, c.trusted); err != nil {
+		// a damaged record can only make us trust less, so start over
+		logrus.Errorf("Failed to parse trusted state, discarding it: %s", err.Error())
+		c.trusted = NewTrustedState()
+	}
+	if c.trusted.Roles == nil {
+		c.trusted.Roles = make(map[string]TrustedRole)
+	}
+	if c.trusted.Declared == nil {
+		c.trusted.Declared = make(map[string]data.FileMeta)
+	}
+	return c.trusted
+}
+
+// checkTrusted ensures the verified metadata for role is not older than,
+// and does not conflict with, the metadata previously accepted for role.
+// Root files are only checked for rollback as the same root version may
+// legitimately be published with different signatures.
+func (c *Client) checkTrusted(role string, s *data.Signed, raw []byte) error {
+	trusted, ok := c.TrustedState().Roles[role]
+	if !ok {
+		return nil
+	}
+	version := signedVersion(s)
+	if version < trusted.Version {
+		return ErrRollback{Role: role, Trusted: trusted.Version, Received: version}
+	}
+	if version == trusted.Version && role != data.RoleName("root") {
+		hash := sha256.Sum256(raw)
+		if !bytes.Equal(hash[:], trusted.Sha256) {
+			return ErrMixAndMatch{Role: role, Version: version}
+		}
+	}
+	return nil
+}
+
+// checkDeclared ensures the verified metadata for role is exactly what
+// was most recently declared for it by the trusted metadata referencing
+// it, so that metadata the client has not itself accepted, such as a
+// snapshot held locally alongside a cached timestamp, cannot vouch for it.
+func (c *Client) checkDeclared(role string, s *data.Signed, raw []byte) error {
+	declared, ok := c.TrustedState().Declared[role]
+	if !ok {
+		return nil
+	}
+	version := signedVersion(s)
+	if declared.Version != 0 && version < declared.Version {
+		return ErrRollback{Role: role, Trusted: declared.Version, Received: version}
+	}
+	if declared.Version != 0 && version != declared.Version {
+		return ErrMixAndMatch{Role: role, Version: version}
+	}
+	if len(declared.Hashes) > 0 && utils.CheckHashes(raw, declared) != nil {
+		return ErrMixAndMatch{Role: role, Version: version}
+	}
+	return nil
+}
+
+// checkFreeze ensures a newer timestamp has been seen within the freeze
+// window. version is the version of the timestamp about to be accepted.
+func (c *Client) checkFreeze(version int) error {
+	state := c.TrustedState()
+	trusted, ok := state.Roles[data.RoleName("timestamp")]
+	if !ok || version > trusted.Version {
+		return nil
+	}
+	if c.freezeWindow > 0 && c.expiry.Now().Sub(state.TimestampAdvanced) > c.freezeWindow {
+		return ErrFreeze{LastAdvanced: state.TimestampAdvanced, Window: c.freezeWindow}
+	}
+	return nil
+}
+
+// trust records the verified metadata for role in the trusted state,
+// along with the meta it declares for other roles, and persists it
+func (c *Client) trust(role string, s *data.Signed, raw []byte, declared data.Files) {
+	state := c.TrustedState()
+	version := signedVersion(s)
+	if trusted, ok := state.Roles[role]; ok && trusted.Version > version {
+		return
+	}
+	if role == data.RoleName("timestamp") {
+		if trusted, ok := state.Roles[role]; !ok || version > trusted.Version {
+			state.TimestampAdvanced = c.expiry.Now()
+		}
+	}
+	hash := sha256.Sum256(raw)
+	state.Roles[role] = TrustedRole{Version: version, Sha256: hash[:]}
+	for name, meta := range declared {
+		state.Declared[name] = meta
+	}
+
+	if c.cache == nil {
+		return
+	}
+	b, err := json.Marshal(state)
+	if err == nil {
+		err = c.cache.SetMeta(trustedStateName, b)
+	}
+	if err != nil {
+		logrus.Errorf("Failed to write trusted state to local cache: %s", err.Error())
+	}
+}
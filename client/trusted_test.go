@@ -0,0 +1,211 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	tuf "github.com/endophage/gotuf"
+	"github.com/endophage/gotuf/clock"
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/signed"
+	"github.com/endophage/gotuf/store"
+	"github.com/endophage/gotuf/testutils"
+)
+
+// publishTimestamp signs a new timestamp and makes it the one served by remote
+func publishTimestamp(t *testing.T, repo *tuf.Repo, remote store.MetadataStore) []byte {
+	signedTS, err := repo.SignTimestamp(data.DefaultExpires("timestamp"), nil)
+	assert.NoError(t, err)
+	raw, err := json.Marshal(signedTS)
+	assert.NoError(t, err)
+	assert.NoError(t, remote.SetMeta("timestamp", raw))
+	return raw
+}
+
+func TestTrustedStateRollback(t *testing.T) {
+	kdb, repo, _ := testutils.EmptyRepo()
+	cache := store.NewMemoryStore(nil, nil)
+	remote := store.NewMemoryStore(nil, nil)
+
+	v1 := publishTimestamp(t, repo, remote)
+	publishTimestamp(t, repo, remote)
+	client := NewClient(repo, remote, kdb, cache)
+	assert.NoError(t, client.downloadTimestamp(context.Background()))
+
+	// the trusted state is persisted and survives the cache being rolled
+	// back along with the remote
+	client = NewClient(repo, remote, kdb, cache)
+	assert.Equal(t, 2, client.TrustedState().Roles["timestamp"].Version)
+	_, ok := client.TrustedState().Declared["snapshot"]
+	assert.True(t, ok)
+
+	assert.NoError(t, remote.SetMeta("timestamp", v1))
+	assert.NoError(t, cache.SetMeta("timestamp", v1))
+	err := client.downloadTimestamp(context.Background())
+	assert.Equal(t, ErrRollback{Role: "timestamp", Trusted: 2, Received: 1}, err)
+}
+
+func TestTrustedStateFilesystemCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotuf-cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cache, err := store.NewFilesystemStore(dir, "metadata", "json", "targets")
+	assert.NoError(t, err)
+	kdb, repo, _ := testutils.EmptyRepo()
+	remote := store.NewMemoryStore(nil, nil)
+	publishTimestamp(t, repo, remote)
+
+	// loading the trusted state logs nothing, whether or not it exists yet
+	load := func() *Client {
+		logs := &bytes.Buffer{}
+		logrus.SetOutput(logs)
+		defer logrus.SetOutput(os.Stderr)
+		client := NewClient(repo, remote, kdb, cache)
+		assert.Equal(t, "", logs.String())
+		return client
+	}
+
+	client := load()
+	assert.Equal(t, 0, len(client.TrustedState().Roles))
+	assert.NoError(t, client.downloadTimestamp(context.Background()))
+
+	client = load()
+	assert.Equal(t, 1, client.TrustedState().Roles["timestamp"].Version)
+	_, ok := client.TrustedState().Declared["snapshot"]
+	assert.True(t, ok)
+}
+
+func TestTrustedStateMixAndMatch(t *testing.T) {
+	kdb, repo, _ := testutils.EmptyRepo()
+	remote := store.NewMemoryStore(nil, nil)
+	client := NewClient(repo, remote, kdb, store.NewMemoryStore(nil, nil))
+
+	publishTimestamp(t, repo, remote)
+	assert.NoError(t, client.downloadTimestamp(context.Background()))
+
+	// a different timestamp claiming the same version
+	repo.Timestamp.Signed.Version--
+	repo.Timestamp.Signed.Meta["snapshot"] = data.FileMeta{Length: 1, Hashes: data.Hashes{"sha256": []byte("x")}}
+	publishTimestamp(t, repo, remote)
+	err := client.downloadTimestamp(context.Background())
+	assert.Equal(t, ErrMixAndMatch{Role: "timestamp", Version: 1}, err)
+}
+
+func TestTrustedStateFreeze(t *testing.T) {
+	kdb, repo, _ := testutils.EmptyRepo()
+	remote := store.NewMemoryStore(nil, nil)
+	client := NewClient(repo, remote, kdb, store.NewMemoryStore(nil, nil))
+	client.SetFreezeWindow(time.Hour)
+
+	publishTimestamp(t, repo, remote)
+	assert.NoError(t, client.downloadTimestamp(context.Background()))
+	// the same timestamp is acceptable within the window
+	assert.NoError(t, client.downloadTimestamp(context.Background()))
+
+	stale := time.Now().Add(-2 * time.Hour)
+	client.TrustedState().TimestampAdvanced = stale
+	err := client.downloadTimestamp(context.Background())
+	assert.Equal(t, ErrFreeze{LastAdvanced: stale, Window: time.Hour}, err)
+
+	// a newer timestamp resets the window
+	publishTimestamp(t, repo, remote)
+	assert.NoError(t, client.downloadTimestamp(context.Background()))
+	assert.True(t, client.TrustedState().TimestampAdvanced.After(stale))
+	assert.NoError(t, client.downloadTimestamp(context.Background()))
+}
+
+func TestClientClock(t *testing.T) {
+	kdb, repo, _ := testutils.EmptyRepo()
+	remote := store.NewMemoryStore(nil, nil)
+	client := NewClient(repo, remote, kdb, store.NewMemoryStore(nil, nil))
+	publishTimestamp(t, repo, remote)
+	expires := repo.Timestamp.Signed.Expires
+
+	fake := clock.NewFake(expires.Add(time.Hour))
+	client.SetClock(fake)
+	err := client.downloadTimestamp(context.Background())
+	assert.IsType(t, signed.ErrExpired{}, err)
+
+	// within the tolerated skew the timestamp has yet to expire
+	client.SetClockSkew(3 * time.Hour)
+	assert.NoError(t, client.downloadTimestamp(context.Background()))
+	assert.Equal(t, fake.Now(), client.TrustedState().TimestampAdvanced)
+
+	// the freeze window is measured by the client's clock too
+	client.SetFreezeWindow(time.Hour)
+	fake.Advance(30 * time.Minute)
+	assert.NoError(t, client.downloadTimestamp(context.Background()))
+	fake.Advance(time.Hour)
+	err = client.downloadTimestamp(context.Background())
+	assert.Equal(t, ErrFreeze{LastAdvanced: expires.Add(time.Hour), Window: time.Hour}, err)
+}
+
+// unavailableStore is a RemoteStore that cannot serve the named metadata
+type unavailableStore struct {
+	store.RemoteStore
+	name string
+}
+
+func (u unavailableStore) GetMeta(name string, size int64) ([]byte, error) {
+	if name == u.name {
+		return nil, store.ErrServerUnavailable{}
+	}
+	return u.RemoteStore.GetMeta(name, size)
+}
+
+func TestTrustedStateDeclared(t *testing.T) {
+	kdb, repo, _ := testutils.EmptyRepo()
+	cache := store.NewMemoryStore(nil, nil)
+	remote := store.NewMemoryStore(nil, nil)
+	publish := func() {
+		signedTargets, err := repo.SignTargets("targets", data.DefaultExpires("targets"), nil)
+		assert.NoError(t, err)
+		raw, err := json.Marshal(signedTargets)
+		assert.NoError(t, err)
+		assert.NoError(t, remote.SetMeta("targets", raw))
+		signedSnapshot, err := repo.SignSnapshot(data.DefaultExpires("snapshot"), nil)
+		assert.NoError(t, err)
+		raw, err = json.Marshal(signedSnapshot)
+		assert.NoError(t, err)
+		assert.NoError(t, remote.SetMeta("snapshot", raw))
+		publishTimestamp(t, repo, remote)
+	}
+
+	ctx := context.Background()
+	publish()
+	client := NewClient(repo, remote, kdb, cache)
+	assert.NoError(t, client.downloadTimestamp(ctx))
+	assert.NoError(t, client.downloadSnapshot(ctx))
+	assert.NoError(t, client.downloadTargets(ctx, "targets"))
+
+	// newer metadata is published but the timestamp cannot be reached, so
+	// a client reopened from the cache falls back to the cached timestamp
+	publish()
+	newTimestamp := repo.Timestamp
+	client = NewClient(repo, unavailableStore{RemoteStore: remote, name: "timestamp"}, kdb, cache)
+	client.SetFreezeWindow(time.Hour)
+	assert.NoError(t, client.downloadTimestamp(ctx))
+	assert.Equal(t, 1, repo.Timestamp.Signed.Version)
+
+	// neither the snapshot nor the timestamp declaring the newer metadata
+	// were accepted, so the newer metadata is not trusted
+	assert.Equal(t, 2, repo.Snapshot.Signed.Version)
+	err := client.downloadTargets(ctx, "targets")
+	assert.Equal(t, ErrMixAndMatch{Role: "targets", Version: 2}, err)
+	repo.SetTimestamp(newTimestamp)
+	err = client.downloadSnapshot(ctx)
+	assert.Equal(t, ErrMixAndMatch{Role: "snapshot", Version: 2}, err)
+
+	// the metadata declared by the cached timestamp is still accepted
+	assert.NoError(t, client.downloadTimestamp(ctx))
+	assert.NoError(t, client.downloadSnapshot(ctx))
+	assert.NoError(t, client.downloadTargets(ctx, "targets"))
+}
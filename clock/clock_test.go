@@ -0,0 +1,28 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeAfter(t *testing.T) {
+	start := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+	assert.Equal(t, start, f.Now())
+
+	soon := f.After(time.Minute)
+	later := f.After(time.Hour)
+	f.BlockUntil(2)
+
+	f.Advance(30 * time.Second)
+	assert.Len(t, soon, 0)
+	f.Advance(30 * time.Second)
+	assert.Equal(t, start.Add(time.Minute), <-soon)
+	assert.Len(t, later, 0)
+
+	f.Set(start.Add(2 * time.Hour))
+	assert.Equal(t, start.Add(2*time.Hour), <-later)
+	assert.Equal(t, start.Add(2*time.Hour), <-f.After(0))
+}
@@ -0,0 +1,99 @@
+package data
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"sync"
+
+	"github.com/dchest/blake2b"
+)
+
+// HashAlgorithm is a hash function that may be used to generate, and
+// verify, the hashes recorded in a FileMeta
+type HashAlgorithm struct {
+	// Name is the key the algorithm's digests are stored under in Hashes
+	Name string
+	// Strength is the collision resistance of the algorithm in bits and is
+	// used to choose between the hashes available for a file
+	Strength int
+	New      func() hash.Hash
+
+	// order breaks ties between algorithms of equal strength, preferring
+	// the one registered first
+	order int
+}
+
+var (
+	hashAlgorithmsMutex sync.RWMutex
+	hashAlgorithms      = make(map[string]HashAlgorithm)
+)
+
+func init() {
+	for _, alg := range []HashAlgorithm{
+		{Name: "sha256", Strength: 128, New: sha256.New},
+		{Name: "sha512/256", Strength: 128, New: sha512.New512_256},
+		{Name: "sha384", Strength: 192, New: sha512.New384},
+		{Name: "sha512", Strength: 256, New: sha512.New},
+		{Name: "blake2b", Strength: 256, New: blake2b.New512},
+	} {
+		RegisterHashAlgorithm(alg)
+	}
+}
+
+// RegisterHashAlgorithm makes a hash algorithm available for use in
+// FileMeta, replacing any algorithm already registered under the same name
+func RegisterHashAlgorithm(alg HashAlgorithm) {
+	hashAlgorithmsMutex.Lock()
+	defer hashAlgorithmsMutex.Unlock()
+	if existing, ok := hashAlgorithms[alg.Name]; ok {
+		alg.order = existing.order
+	} else {
+		alg.order = len(hashAlgorithms)
+	}
+	hashAlgorithms[alg.Name] = alg
+}
+
+// GetHashAlgorithm returns the registered hash algorithm with the given name
+func GetHashAlgorithm(name string) (HashAlgorithm, bool) {
+	hashAlgorithmsMutex.RLock()
+	defer hashAlgorithmsMutex.RUnlock()
+	alg, ok := hashAlgorithms[name]
+	return alg, ok
+}
+
+// StrongestHash returns the name of the strongest registered hash algorithm
+// that has a digest in every one of the given Hashes. Unregistered
+// algorithms are ignored.
+func StrongestHash(hashes ...Hashes) (string, bool) {
+	if len(hashes) == 0 {
+		return "", false
+	}
+	hashAlgorithmsMutex.RLock()
+	defer hashAlgorithmsMutex.RUnlock()
+	var best *HashAlgorithm
+	for name := range hashes[0] {
+		alg, ok := hashAlgorithms[name]
+		if !ok {
+			continue
+		}
+		common := true
+		for _, h := range hashes[1:] {
+			if _, ok := h[name]; !ok {
+				common = false
+				break
+			}
+		}
+		if !common {
+			continue
+		}
+		if best == nil || alg.Strength > best.Strength ||
+			(alg.Strength == best.Strength && alg.order < best.order) {
+			best = &alg
+		}
+	}
+	if best == nil {
+		return "", false
+	}
+	return best.Name, true
+}
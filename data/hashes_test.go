@@ -0,0 +1,77 @@
+package data
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"hash"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewFileMetaAllHashes(t *testing.T) {
+	sizes := map[string]int{
+		"sha256":     32,
+		"sha512/256": 32,
+		"sha384":     48,
+		"sha512":     64,
+		"blake2b":    64,
+	}
+	algs := make([]string, 0, len(sizes))
+	for alg := range sizes {
+		algs = append(algs, alg)
+	}
+	meta, err := NewFileMeta(bytes.NewReader([]byte("foo")), algs...)
+	assert.NoError(t, err)
+	assert.Len(t, meta.Hashes, len(sizes))
+	for alg, size := range sizes {
+		assert.Len(t, meta.Hashes[alg], size, alg)
+	}
+
+	_, err = NewFileMeta(bytes.NewReader([]byte("foo")), "md5")
+	assert.Error(t, err)
+}
+
+func TestStrongestHash(t *testing.T) {
+	d := []byte{1}
+	tests := []struct {
+		hashes   []Hashes
+		expected string
+	}{
+		{[]Hashes{{"sha256": d, "sha512": d}}, "sha512"},
+		{[]Hashes{{"sha256": d, "sha384": d, "md5": d}}, "sha384"},
+		{[]Hashes{{"sha512": d, "blake2b": d}}, "sha512"},
+		{[]Hashes{{"sha256": d, "sha512/256": d}}, "sha256"},
+		{[]Hashes{{"sha256": d, "sha512": d}, {"sha256": d, "blake2b": d}}, "sha256"},
+		{[]Hashes{{"md5": d}}, ""},
+		{[]Hashes{{"sha256": d}, {"sha512": d}}, ""},
+		{nil, ""},
+	}
+	for _, test := range tests {
+		alg, ok := StrongestHash(test.hashes...)
+		assert.Equal(t, test.expected, alg)
+		assert.Equal(t, test.expected != "", ok)
+	}
+}
+
+func TestRegisterHashAlgorithm(t *testing.T) {
+	_, ok := GetHashAlgorithm("test-hash")
+	assert.False(t, ok)
+
+	RegisterHashAlgorithm(HashAlgorithm{
+		Name:     "test-hash",
+		Strength: 512,
+		New:      func() hash.Hash { return sha256.New() },
+	})
+	defer func() {
+		hashAlgorithmsMutex.Lock()
+		delete(hashAlgorithms, "test-hash")
+		hashAlgorithmsMutex.Unlock()
+	}()
+
+	meta, err := NewFileMeta(bytes.NewReader([]byte("foo")), "sha512", "test-hash")
+	assert.NoError(t, err)
+	alg, ok := StrongestHash(meta.Hashes)
+	assert.True(t, ok)
+	assert.Equal(t, "test-hash", alg)
+}
@@ -2,6 +2,7 @@ package data
 
 import (
 	"fmt"
+	"path"
 	"strings"
 
 	"github.com/endophage/gotuf/errors"
@@ -101,6 +102,10 @@ type Role struct {
 	Paths            []string `json:"paths,omitempty"`
 	PathHashPrefixes []string `json:"path_hash_prefixes,omitempty"`
 	Email            string   `json:"email,omitempty"`
+	// Terminating indicates that if this role matches a target path, but
+	// the target is not found in it or its delegations, the search for
+	// the target should go no further.
+	Terminating bool `json:"terminating,omitempty"`
 }
 
 // NewRole creates a new Role object from the given parameters
@@ -114,6 +119,11 @@ func NewRole(name string, threshold int, keyIDs, paths, pathHashPrefixes []strin
 	if !ValidRole(name) {
 		return nil, errors.ErrInvalidRole{}
 	}
+	for _, p := range paths {
+		if !ValidPathPattern(p) {
+			return nil, errors.ErrInvalidRole{Role: name}
+		}
+	}
 	return &Role{
 		RootRole: RootRole{
 			KeyIDs:    keyIDs,
@@ -127,9 +137,17 @@ func NewRole(name string, threshold int, keyIDs, paths, pathHashPrefixes []strin
 }
 
 // IsValid checks if the role has defined both paths and path hash prefixes,
-// having both is invalid
+// having both is invalid, and that all its paths are valid patterns
 func (r Role) IsValid() bool {
-	return !(len(r.Paths) > 0 && len(r.PathHashPrefixes) > 0)
+	if len(r.Paths) > 0 && len(r.PathHashPrefixes) > 0 {
+		return false
+	}
+	for _, p := range r.Paths {
+		if !ValidPathPattern(p) {
+			return false
+		}
+	}
+	return true
 }
 
 // ValidKey checks if the given id is a recognized signing key for the role
@@ -142,16 +160,127 @@ func (r Role) ValidKey(id string) bool {
 	return false
 }
 
-// CheckPaths checks if a given path is valid for the role
+// CheckPaths checks if a given path is valid for the role. The role's
+// paths are patterns as described by MatchPath.
 func (r Role) CheckPaths(path string) bool {
 	for _, p := range r.Paths {
-		if strings.HasPrefix(path, p) {
+		if MatchPath(p, path) {
 			return true
 		}
 	}
 	return false
 }
 
+// ValidPathPattern checks the pattern is well formed. A "**" must make up
+// a whole path segment, and any character classes must be terminated.
+func ValidPathPattern(pattern string) bool {
+	for _, seg := range strings.Split(pattern, "/") {
+		if strings.Contains(seg, "**") && seg != "**" {
+			return false
+		}
+		if !validSegmentSyntax(seg) {
+			return false
+		}
+	}
+	return true
+}
+
+// validSegmentSyntax checks the escapes and character classes of a pattern
+// segment against the syntax of path.Match, extended with "[!...]". The
+// syntax is checked directly as older versions of path.Match stop checking
+// once the name fails to match.
+func validSegmentSyntax(seg string) bool {
+	for i := 0; i < len(seg); i++ {
+		switch seg[i] {
+		case '\\':
+			i++
+			if i >= len(seg) {
+				return false
+			}
+		case '[':
+			i++
+			if i < len(seg) && (seg[i] == '^' || seg[i] == '!') {
+				i++
+			}
+			for first := true; i >= len(seg) || seg[i] != ']' || first; first = false {
+				var ok bool
+				if i, ok = classChar(seg, i); !ok {
+					return false
+				}
+				if i < len(seg) && seg[i] == '-' {
+					if i, ok = classChar(seg, i+1); !ok {
+						return false
+					}
+				}
+			}
+		}
+	}
+	return true
+}
+
+// classChar checks there is a valid, possibly escaped, character at seg[i]
+// within a character class, returning the index following it
+func classChar(seg string, i int) (int, bool) {
+	if i >= len(seg) || seg[i] == '-' || seg[i] == ']' {
+		return i, false
+	}
+	if seg[i] == '\\' {
+		i++
+		if i >= len(seg) {
+			return i, false
+		}
+	}
+	return i + 1, true
+}
+
+// MatchPath checks if the target path matches the pattern. Patterns are
+// matched one "/" separated segment at a time. Within a segment "*" matches
+// any sequence of characters, "?" any single character and "[...]" a class
+// of characters, as for path.Match, except that a class may also be negated
+// with "[!...]" as in fnmatch. A segment consisting solely of "**"
+// matches zero or more whole segments.
+// A pattern containing none of these special characters matches the path
+// of the same name and, treating it as a directory, every path beneath it.
+// The empty pattern matches every path.
+func MatchPath(pattern, target string) bool {
+	if !strings.ContainsAny(pattern, "*?[\\") {
+		if pattern == "" || pattern == target {
+			return true
+		}
+		return strings.HasPrefix(target, strings.TrimSuffix(pattern, "/")+"/")
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(target, "/"))
+}
+
+// matchSegments matches the pattern segments against the target segments.
+// As a "**" may match any number of segments, the result for each pair of
+// remaining pattern and target segments is memoized to avoid repeating
+// work on patterns containing many of them.
+func matchSegments(pattern, target []string) bool {
+	memo := make(map[[2]int]bool)
+	var match func(p, t int) bool
+	match = func(p, t int) bool {
+		key := [2]int{p, t}
+		if res, ok := memo[key]; ok {
+			return res
+		}
+		var res bool
+		switch {
+		case p == len(pattern):
+			res = t == len(target)
+		case pattern[p] == "**":
+			// either "**" matches no more segments, or it consumes one
+			res = match(p+1, t) || (t < len(target) && match(p, t+1))
+		case t < len(target):
+			ok, err := path.Match(fnmatchSegment(pattern[p]), target[t])
+			res = err == nil && ok && match(p+1, t+1)
+		}
+		memo[key] = res
+		return res
+	}
+	return match(0, 0)
+}
+
 // CheckPrefixes checks if a given hash matches the prefixes for the role
 func (r Role) CheckPrefixes(hash string) bool {
 	for _, p := range r.PathHashPrefixes {
@@ -167,3 +296,28 @@ func (r Role) IsDelegation() bool {
 	targetsBase := fmt.Sprintf("%s/", ValidRoles[CanonicalTargetsRole])
 	return strings.HasPrefix(r.Name, targetsBase)
 }
+
+// fnmatchSegment rewrites fnmatch style "[!...]" negated character classes
+// in a pattern segment to the "[^...]" form understood by path.Match.
+func fnmatchSegment(seg string) string {
+	if !strings.Contains(seg, "[!") {
+		return seg
+	}
+	b := []byte(seg)
+	inClass := false
+	for i := 0; i < len(b); i++ {
+		switch {
+		case b[i] == '\\':
+			i++
+		case b[i] == '[' && !inClass:
+			inClass = true
+			if i+1 < len(b) && b[i+1] == '!' {
+				b[i+1] = '^'
+				i++
+			}
+		case b[i] == ']' && inClass:
+			inClass = false
+		}
+	}
+	return string(b)
+}
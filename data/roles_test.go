@@ -1,6 +1,7 @@
 package data
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -50,3 +51,78 @@ func TestCanonicalRole(t *testing.T) {
 		CanonicalTimestampRole: CanonicalTimestampRole,
 	}
 }
+
+func TestMatchPath(t *testing.T) {
+	matches := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		// literal patterns match the path and anything beneath it
+		{"", "anything/at/all", true},
+		{"foo", "foo", true},
+		{"foo", "foo/bar", true},
+		{"foo/", "foo/bar", true},
+		{"foo", "foobar", false},
+		{"foo", "foobar/baz", false},
+
+		// wildcards do not cross segments
+		{"releases/*/linux-*.tar.gz", "releases/1.0/linux-amd64.tar.gz", true},
+		{"releases/*/linux-*.tar.gz", "releases/1.0/darwin-amd64.tar.gz", false},
+		{"releases/*/linux-*.tar.gz", "releases/1.0/rc/linux-amd64.tar.gz", false},
+		{"releases/*", "releases/1.0/linux.tar.gz", false},
+		{"v?", "v1", true},
+		{"v?", "v10", false},
+		{"v?/x", "v//x", false},
+		{"v[0-9]", "v5", true},
+		{"v[!0-9]", "v5", false},
+		{"v[!0-9]", "va", true},
+		{"v[^0-9]", "va", true},
+		{"\\*", "*", true},
+		{"\\*", "a", false},
+
+		// ** matches zero or more whole segments
+		{"releases/**", "releases/1.0/linux.tar.gz", true},
+		{"releases/**", "releases", true},
+		{"releases/**/*.sig", "releases/a.sig", true},
+		{"releases/**/*.sig", "releases/1.0/rc/a.sig", true},
+		{"releases/**/*.sig", "releases/1.0/rc/a.tar", false},
+		{"**/a/**/b", "x/a/y/a/z/b", true},
+		{"**/a/**/b", "x/a/y/z/c", false},
+		{"**", "any/thing", true},
+	}
+	for _, m := range matches {
+		assert.Equal(t, m.match, MatchPath(m.pattern, m.path), "%q against %q", m.pattern, m.path)
+	}
+}
+
+func TestMatchPathManyDoubleStars(t *testing.T) {
+	pattern := strings.Repeat("**/", 50) + "x"
+	target := strings.Repeat("a/", 50) + "y"
+	assert.False(t, MatchPath(pattern, target))
+}
+
+func TestValidPathPattern(t *testing.T) {
+	valid := []string{"", "foo", "foo/*", "foo/**", "**/bar", "v[0-9]", "\\*", "[!a-z]x", "[\\]]", "[z-a]"}
+	for _, p := range valid {
+		assert.True(t, ValidPathPattern(p), p)
+	}
+	invalid := []string{"foo**", "**bar/baz", "a/***", "v[0-9", "v[]", "trailing\\", "[!]", "[a-]", "[-a]", "[\\", "a[b", "a[b-c-]", "[]]"}
+	for _, p := range invalid {
+		assert.False(t, ValidPathPattern(p), p)
+	}
+}
+
+func TestNewRoleInvalidPattern(t *testing.T) {
+	_, err := NewRole("targets/bad", 1, []string{"abc"}, []string{"ok/*", "v[0-9"}, nil)
+	assert.Error(t, err)
+
+	r, err := NewRole("targets/good", 1, []string{"abc"}, []string{"ok/*", "v[0-9]/**"}, nil)
+	assert.NoError(t, err)
+	assert.True(t, r.CheckPaths("ok/thing"))
+	assert.True(t, r.CheckPaths("v1/a/b"))
+	assert.False(t, r.CheckPaths("ok/thing/deeper"))
+
+	r.Paths = append(r.Paths, "x**")
+	assert.False(t, r.IsValid())
+}
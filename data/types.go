@@ -1,8 +1,6 @@
 package data
 
 import (
-	"crypto/sha256"
-	"crypto/sha512"
 	"fmt"
 	"hash"
 	"io"
@@ -127,30 +125,29 @@ type Files map[string]FileMeta
 type Hashes map[string][]byte
 
 // FileMeta contains the size and hashes for a metadata or target file. Custom
-// data can be optionally added.
+// data can be optionally added. Version is only set for metadata files, where
+// it is the version of the role the meta describes, and is omitted when 0.
 type FileMeta struct {
-	Length int64           `json:"length"`
-	Hashes Hashes          `json:"hashes"`
-	Custom json.RawMessage `json:"custom,omitempty"`
+	Length  int64           `json:"length"`
+	Hashes  Hashes          `json:"hashes"`
+	Version int             `json:"version,omitempty"`
+	Custom  json.RawMessage `json:"custom,omitempty"`
 }
 
 // NewFileMeta generates a FileMeta object from the reader, using the
-// hash algorithms provided
+// hash algorithms provided, each of which must have been registered
+// with RegisterHashAlgorithm
 func NewFileMeta(r io.Reader, hashAlgorithms ...string) (FileMeta, error) {
 	if len(hashAlgorithms) == 0 {
 		hashAlgorithms = []string{defaultHashAlgorithm}
 	}
 	hashes := make(map[string]hash.Hash, len(hashAlgorithms))
 	for _, hashAlgorithm := range hashAlgorithms {
-		var h hash.Hash
-		switch hashAlgorithm {
-		case "sha256":
-			h = sha256.New()
-		case "sha512":
-			h = sha512.New()
-		default:
+		alg, ok := GetHashAlgorithm(hashAlgorithm)
+		if !ok {
 			return FileMeta{}, fmt.Errorf("Unknown Hash Algorithm: %s", hashAlgorithm)
 		}
+		h := alg.New()
 		hashes[hashAlgorithm] = h
 		r = io.TeeReader(r, h)
 	}
@@ -171,6 +168,27 @@ type Delegations struct {
 	Roles []*Role              `json:"roles"`
 }
 
+// UnmarshalJSON decodes the delegated keys as TUFKeys, as json cannot
+// decode into the PublicKey interface
+func (d *Delegations) UnmarshalJSON(b []byte) error {
+	raw := struct {
+		Keys  map[string]*TUFKey `json:"keys"`
+		Roles []*Role            `json:"roles"`
+	}{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	d.Keys = make(map[string]PublicKey, len(raw.Keys))
+	for id, k := range raw.Keys {
+		d.Keys[id] = k
+	}
+	d.Roles = raw.Roles
+	if d.Roles == nil {
+		d.Roles = make([]*Role, 0)
+	}
+	return nil
+}
+
 // NewDelegations initializes an empty Delegations object
 func NewDelegations() *Delegations {
 	return &Delegations{
@@ -200,9 +218,15 @@ func SetDefaultExpiryTimes(times map[string]int) {
 
 // DefaultExpires gets the default expiry time for the given role
 func DefaultExpires(role string) time.Time {
+	return DefaultExpiresAt(role, time.Now())
+}
+
+// DefaultExpiresAt gets the default expiry time for the given role,
+// counting from now
+func DefaultExpiresAt(role string, now time.Time) time.Time {
 	var t time.Time
 	if t, ok := defaultExpiryTimes[role]; ok {
-		return time.Now().AddDate(0, 0, t)
+		return now.AddDate(0, 0, t)
 	}
 	return t.UTC().Round(time.Second)
 }
@@ -43,6 +43,22 @@ func TestGenerateFileMetaExplicit(t *testing.T) {
 	}
 }
 
+func TestFileMetaVersionOmitted(t *testing.T) {
+	meta := FileMeta{Length: 1, Hashes: Hashes{"sha256": []byte{1}}}
+	b, err := json.MarshalCanonical(meta)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "version")
+
+	meta.Version = 3
+	b, err = json.MarshalCanonical(meta)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"version":3`)
+
+	decoded := FileMeta{}
+	assert.NoError(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, 3, decoded.Version)
+}
+
 func TestSignatureUnmarshalJSON(t *testing.T) {
 	signatureJSON := `{"keyid":"97e8e1b51b6e7cf8720a56b5334bd8692ac5b28233c590b89fab0b0cd93eeedc","method":"RSA","sig":"2230cba525e4f5f8fc744f234221ca9a92924da4cc5faf69a778848882fcf7a20dbb57296add87f600891f2569a9c36706314c240f9361c60fd36f5a915a0e9712fc437b761e8f480868d7a4444724daa0d29a2669c0edbd4046046649a506b3d711d0aa5e70cb9d09dec7381e7de27a3168e77731e08f6ed56fcce2478855e837816fb69aff53412477748cd198dce783850080d37aeb929ad0f81460ebd31e61b772b6c7aa56977c787d4281fa45dbdefbb38d449eb5bccb2702964a52c78811545939712c8280dee0b23b2fa9fbbdd6a0c42476689ace655eba0745b4a21ba108bcd03ad00fdefff416dc74e08486a0538f8fd24989e1b9fc89e675141b7c"}`
 
@@ -53,3 +69,21 @@ func TestSignatureUnmarshalJSON(t *testing.T) {
 	// Check that the method string is lowercased
 	assert.Equal(t, sig.Method.String(), "rsa")
 }
+
+func TestDelegationsUnmarshalJSON(t *testing.T) {
+	key := NewPublicKey(ED25519Key, []byte("public"))
+	role, err := NewRole("targets/level1", 1, []string{key.ID()}, []string{"level1/**"}, nil)
+	assert.NoError(t, err)
+	delegations := NewDelegations()
+	delegations.Keys[key.ID()] = key
+	delegations.Roles = append(delegations.Roles, role)
+	b, err := json.MarshalCanonical(delegations)
+	assert.NoError(t, err)
+
+	decoded := &Delegations{}
+	assert.NoError(t, json.Unmarshal(b, decoded))
+	assert.Equal(t, key.ID(), decoded.Keys[key.ID()].ID())
+	assert.Equal(t, []byte("public"), decoded.Keys[key.ID()].Public())
+	assert.Len(t, decoded.Roles, 1)
+	assert.Equal(t, []string{"level1/**"}, decoded.Roles[0].Paths)
+}
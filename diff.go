@@ -0,0 +1,559 @@
+package tuf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/endophage/gotuf/data"
+)
+
+// ChangeType is the kind of change made to an item between two states of
+// a repo
+type ChangeType string
+
+// The kinds of change
+const (
+	Added   ChangeType = "added"
+	Removed ChangeType = "removed"
+	Changed ChangeType = "changed"
+)
+
+// RepoDiff describes how one state of a repo differs from another, role
+// by role. It serializes to JSON as is.
+type RepoDiff struct {
+	// Roles holds a RoleDiff for each role that differs, sorted by name
+	Roles []RoleDiff `json:"roles"`
+}
+
+// RoleDiff describes how the metadata for a single role differs. Only the
+// fields relevant to the role are ever set: Keys and Roles describe the
+// root's keys and roles for the root, and the delegation keys and roles for
+// a targets role.
+type RoleDiff struct {
+	Role               string       `json:"role"`
+	Change             ChangeType   `json:"change"`
+	Version            *IntChange   `json:"version,omitempty"`
+	Expires            *TimeChange  `json:"expires,omitempty"`
+	ConsistentSnapshot *BoolChange  `json:"consistent_snapshot,omitempty"`
+	Keys               []KeyChange  `json:"keys,omitempty"`
+	Roles              []RoleChange `json:"roles,omitempty"`
+	Targets            []FileChange `json:"targets,omitempty"`
+	Meta               []FileChange `json:"meta,omitempty"`
+}
+
+// IntChange is a changed integer, such as a version or threshold
+type IntChange struct {
+	Before int `json:"before"`
+	After  int `json:"after"`
+}
+
+// TimeChange is a changed time, such as an expiry
+type TimeChange struct {
+	Before time.Time `json:"before"`
+	After  time.Time `json:"after"`
+}
+
+// BoolChange is a changed flag
+type BoolChange struct {
+	Before bool `json:"before"`
+	After  bool `json:"after"`
+}
+
+// KeyChange is a key added to, or removed from, the root or a delegation
+type KeyChange struct {
+	ID        string            `json:"keyid"`
+	Algorithm data.KeyAlgorithm `json:"keytype"`
+	Change    ChangeType        `json:"change"`
+}
+
+// RoleChange describes how a role declared in the root, or a delegated
+// role, differs
+type RoleChange struct {
+	Name                    string      `json:"name"`
+	Change                  ChangeType  `json:"change"`
+	Threshold               *IntChange  `json:"threshold,omitempty"`
+	KeysAdded               []string    `json:"keys_added,omitempty"`
+	KeysRemoved             []string    `json:"keys_removed,omitempty"`
+	PathsAdded              []string    `json:"paths_added,omitempty"`
+	PathsRemoved            []string    `json:"paths_removed,omitempty"`
+	PathHashPrefixesAdded   []string    `json:"path_hash_prefixes_added,omitempty"`
+	PathHashPrefixesRemoved []string    `json:"path_hash_prefixes_removed,omitempty"`
+	Terminating             *BoolChange `json:"terminating,omitempty"`
+}
+
+// FileChange is a target, or a meta entry in the snapshot or timestamp,
+// that was added, removed or changed. Before and After are set when the
+// file existed in that state.
+type FileChange struct {
+	Path   string         `json:"path"`
+	Change ChangeType     `json:"change"`
+	Before *data.FileMeta `json:"before,omitempty"`
+	After  *data.FileMeta `json:"after,omitempty"`
+}
+
+// repoState is the metadata of a repo, unpacked, for diffing
+type repoState struct {
+	root      *data.Root
+	targets   map[string]*data.Targets
+	snapshot  *data.Snapshot
+	timestamp *data.Timestamp
+}
+
+// Diff compares two states of a repo, for example the published repo and
+// one about to be published. Either may be nil, meaning a repo with no
+// metadata.
+func Diff(before, after *Repo) *RepoDiff {
+	return diffStates(repoStateOf(before), repoStateOf(after))
+}
+
+// DiffSigned compares two sets of signed metadata, keyed by role name. The
+// signatures are not verified.
+func DiffSigned(before, after map[string]*data.Signed) (*RepoDiff, error) {
+	b, err := repoStateFromSigned(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := repoStateFromSigned(after)
+	if err != nil {
+		return nil, err
+	}
+	return diffStates(b, a), nil
+}
+
+// Empty returns true if the two states did not differ
+func (d *RepoDiff) Empty() bool {
+	return len(d.Roles) == 0
+}
+
+// JSON serializes the diff
+func (d *RepoDiff) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+func repoStateOf(r *Repo) repoState {
+	state := repoState{targets: make(map[string]*data.Targets)}
+	if r == nil {
+		return state
+	}
+	if r.Root != nil {
+		state.root = &r.Root.Signed
+	}
+	for role, t := range r.Targets {
+		state.targets[role] = &t.Signed
+	}
+	if r.Snapshot != nil {
+		state.snapshot = &r.Snapshot.Signed
+	}
+	if r.Timestamp != nil {
+		state.timestamp = &r.Timestamp.Signed
+	}
+	return state
+}
+
+func repoStateFromSigned(metas map[string]*data.Signed) (repoState, error) {
+	state := repoState{targets: make(map[string]*data.Targets)}
+	for role, s := range metas {
+		switch data.CanonicalRole(role) {
+		case data.CanonicalRootRole:
+			r, err := data.RootFromSigned(s)
+			if err != nil {
+				return state, err
+			}
+			state.root = &r.Signed
+		case data.CanonicalSnapshotRole:
+			sn, err := data.SnapshotFromSigned(s)
+			if err != nil {
+				return state, err
+			}
+			state.snapshot = &sn.Signed
+		case data.CanonicalTimestampRole:
+			ts, err := data.TimestampFromSigned(s)
+			if err != nil {
+				return state, err
+			}
+			state.timestamp = &ts.Signed
+		default:
+			t, err := data.TargetsFromSigned(s)
+			if err != nil {
+				return state, err
+			}
+			state.targets[role] = &t.Signed
+		}
+	}
+	return state, nil
+}
+
+func diffStates(before, after repoState) *RepoDiff {
+	d := &RepoDiff{Roles: []RoleDiff{}}
+	add := func(rd *RoleDiff) {
+		if rd != nil {
+			d.Roles = append(d.Roles, *rd)
+		}
+	}
+	add(DiffRoot(before.root, after.root))
+	names := make(map[string]bool)
+	for role := range before.targets {
+		names[role] = true
+	}
+	for role := range after.targets {
+		names[role] = true
+	}
+	for role := range names {
+		add(diffTargets(role, before.targets[role], after.targets[role]))
+	}
+	add(diffMeta(data.RoleName(data.CanonicalSnapshotRole), snapshotMeta(before.snapshot), snapshotMeta(after.snapshot)))
+	add(diffMeta(data.RoleName(data.CanonicalTimestampRole), timestampMeta(before.timestamp), timestampMeta(after.timestamp)))
+	sort.Sort(roleDiffs(d.Roles))
+	return d
+}
+
+type roleDiffs []RoleDiff
+
+func (r roleDiffs) Len() int           { return len(r) }
+func (r roleDiffs) Less(i, j int) bool { return r[i].Role < r[j].Role }
+func (r roleDiffs) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+// DiffRoot compares two roots, either of which may be nil. It returns nil
+// if they do not differ.
+func DiffRoot(before, after *data.Root) *RoleDiff {
+	rd := &RoleDiff{Role: data.RoleName(data.CanonicalRootRole)}
+	if !presence(rd, before != nil, after != nil) {
+		return nil
+	}
+	if before == nil {
+		before = &data.Root{}
+	}
+	if after == nil {
+		after = &data.Root{}
+	}
+	common(rd, before.Version, after.Version, before.Expires, after.Expires)
+	if before.ConsistentSnapshot != after.ConsistentSnapshot {
+		rd.ConsistentSnapshot = &BoolChange{Before: before.ConsistentSnapshot, After: after.ConsistentSnapshot}
+	}
+
+	beforeKeys := make(map[string]data.PublicKey)
+	for id, k := range before.Keys {
+		beforeKeys[id] = k
+	}
+	afterKeys := make(map[string]data.PublicKey)
+	for id, k := range after.Keys {
+		afterKeys[id] = k
+	}
+	rd.Keys = diffKeys(beforeKeys, afterKeys)
+
+	names := []string{}
+	for name := range before.Roles {
+		names = append(names, name)
+	}
+	for name := range after.Roles {
+		if _, ok := before.Roles[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var b, a *data.Role
+		if r, ok := before.Roles[name]; ok {
+			b = &data.Role{Name: name, RootRole: *r}
+		}
+		if r, ok := after.Roles[name]; ok {
+			a = &data.Role{Name: name, RootRole: *r}
+		}
+		if rc := diffRole(name, b, a); rc != nil {
+			rd.Roles = append(rd.Roles, *rc)
+		}
+	}
+	return finish(rd)
+}
+
+func diffTargets(role string, before, after *data.Targets) *RoleDiff {
+	rd := &RoleDiff{Role: role}
+	if !presence(rd, before != nil, after != nil) {
+		return nil
+	}
+	if before == nil {
+		before = &data.Targets{}
+	}
+	if after == nil {
+		after = &data.Targets{}
+	}
+	common(rd, before.Version, after.Version, before.Expires, after.Expires)
+	rd.Targets = diffFiles(before.Targets, after.Targets)
+	rd.Keys = diffKeys(before.Delegations.Keys, after.Delegations.Keys)
+
+	beforeRoles := make(map[string]*data.Role)
+	for _, r := range before.Delegations.Roles {
+		beforeRoles[r.Name] = r
+	}
+	afterRoles := make(map[string]*data.Role)
+	names := []string{}
+	for _, r := range after.Delegations.Roles {
+		afterRoles[r.Name] = r
+		names = append(names, r.Name)
+	}
+	for _, r := range before.Delegations.Roles {
+		if _, ok := afterRoles[r.Name]; !ok {
+			names = append(names, r.Name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if rc := diffRole(name, beforeRoles[name], afterRoles[name]); rc != nil {
+			rd.Roles = append(rd.Roles, *rc)
+		}
+	}
+	return finish(rd)
+}
+
+// metaState is the part of a snapshot or timestamp that is diffed
+type metaState struct {
+	version int
+	expires time.Time
+	meta    data.Files
+}
+
+func snapshotMeta(sn *data.Snapshot) *metaState {
+	if sn == nil {
+		return nil
+	}
+	return &metaState{version: sn.Version, expires: sn.Expires, meta: sn.Meta}
+}
+
+func timestampMeta(ts *data.Timestamp) *metaState {
+	if ts == nil {
+		return nil
+	}
+	return &metaState{version: ts.Version, expires: ts.Expires, meta: ts.Meta}
+}
+
+func diffMeta(role string, before, after *metaState) *RoleDiff {
+	rd := &RoleDiff{Role: role}
+	if !presence(rd, before != nil, after != nil) {
+		return nil
+	}
+	if before == nil {
+		before = &metaState{}
+	}
+	if after == nil {
+		after = &metaState{}
+	}
+	common(rd, before.version, after.version, before.expires, after.expires)
+	rd.Meta = diffFiles(before.meta, after.meta)
+	return finish(rd)
+}
+
+// presence sets the change for a role existing in one or both states,
+// returning false if it exists in neither
+func presence(rd *RoleDiff, before, after bool) bool {
+	switch {
+	case !before && !after:
+		return false
+	case !before:
+		rd.Change = Added
+	case !after:
+		rd.Change = Removed
+	default:
+		rd.Change = Changed
+	}
+	return true
+}
+
+func common(rd *RoleDiff, bVersion, aVersion int, bExpires, aExpires time.Time) {
+	if bVersion != aVersion {
+		rd.Version = &IntChange{Before: bVersion, After: aVersion}
+	}
+	if !bExpires.Equal(aExpires) {
+		rd.Expires = &TimeChange{Before: bExpires, After: aExpires}
+	}
+}
+
+// finish returns nil if a role present in both states did not change
+func finish(rd *RoleDiff) *RoleDiff {
+	if rd.Change == Changed && rd.Version == nil && rd.Expires == nil && rd.ConsistentSnapshot == nil &&
+		len(rd.Keys) == 0 && len(rd.Roles) == 0 && len(rd.Targets) == 0 && len(rd.Meta) == 0 {
+		return nil
+	}
+	return rd
+}
+
+func diffKeys(before, after map[string]data.PublicKey) []KeyChange {
+	changes := []KeyChange{}
+	for id, k := range after {
+		if _, ok := before[id]; !ok {
+			changes = append(changes, KeyChange{ID: id, Algorithm: k.Algorithm(), Change: Added})
+		}
+	}
+	for id, k := range before {
+		if _, ok := after[id]; !ok {
+			changes = append(changes, KeyChange{ID: id, Algorithm: k.Algorithm(), Change: Removed})
+		}
+	}
+	sort.Sort(keyChanges(changes))
+	return changes
+}
+
+type keyChanges []KeyChange
+
+func (k keyChanges) Len() int { return len(k) }
+func (k keyChanges) Less(i, j int) bool {
+	if k[i].Change != k[j].Change {
+		return k[i].Change == Added
+	}
+	return k[i].ID < k[j].ID
+}
+func (k keyChanges) Swap(i, j int) { k[i], k[j] = k[j], k[i] }
+
+// diffRole compares two versions of a role, either of which may be nil. It
+// returns nil if they do not differ.
+func diffRole(name string, before, after *data.Role) *RoleChange {
+	rc := &RoleChange{Name: name, Change: Changed}
+	switch {
+	case before == nil && after == nil:
+		return nil
+	case before == nil:
+		rc.Change, before = Added, &data.Role{}
+	case after == nil:
+		rc.Change, after = Removed, &data.Role{}
+	}
+	if before.Threshold != after.Threshold {
+		rc.Threshold = &IntChange{Before: before.Threshold, After: after.Threshold}
+	}
+	rc.KeysAdded, rc.KeysRemoved = diffStrings(before.KeyIDs, after.KeyIDs)
+	rc.PathsAdded, rc.PathsRemoved = diffStrings(before.Paths, after.Paths)
+	rc.PathHashPrefixesAdded, rc.PathHashPrefixesRemoved = diffStrings(before.PathHashPrefixes, after.PathHashPrefixes)
+	if before.Terminating != after.Terminating {
+		rc.Terminating = &BoolChange{Before: before.Terminating, After: after.Terminating}
+	}
+	if rc.Change == Changed && rc.Threshold == nil && rc.Terminating == nil &&
+		len(rc.KeysAdded)+len(rc.KeysRemoved)+len(rc.PathsAdded)+len(rc.PathsRemoved)+
+			len(rc.PathHashPrefixesAdded)+len(rc.PathHashPrefixesRemoved) == 0 {
+		return nil
+	}
+	return rc
+}
+
+// diffStrings returns the sorted strings in after but not before, and in
+// before but not after
+func diffStrings(before, after []string) (added, removed []string) {
+	seen := make(map[string]bool)
+	for _, s := range before {
+		seen[s] = true
+	}
+	for _, s := range after {
+		if !seen[s] {
+			added = append(added, s)
+		}
+		delete(seen, s)
+	}
+	for s := range seen {
+		removed = append(removed, s)
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+func diffFiles(before, after data.Files) []FileChange {
+	paths := []string{}
+	for p := range before {
+		paths = append(paths, p)
+	}
+	for p := range after {
+		if _, ok := before[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	changes := []FileChange{}
+	for _, p := range paths {
+		b, inBefore := before[p]
+		a, inAfter := after[p]
+		switch {
+		case !inBefore:
+			changes = append(changes, FileChange{Path: p, Change: Added, After: &a})
+		case !inAfter:
+			changes = append(changes, FileChange{Path: p, Change: Removed, Before: &b})
+		case !fileMetaIdentical(b, a):
+			changes = append(changes, FileChange{Path: p, Change: Changed, Before: &b, After: &a})
+		}
+	}
+	return changes
+}
+
+// fileMetaIdentical compares every field, unlike utils.FileMetaEqual which
+// only compares what is needed to verify a file
+func fileMetaIdentical(a, b data.FileMeta) bool {
+	if a.Length != b.Length || a.Version != b.Version || !bytes.Equal(a.Custom, b.Custom) || len(a.Hashes) != len(b.Hashes) {
+		return false
+	}
+	for alg, h := range a.Hashes {
+		if !bytes.Equal(h, b.Hashes[alg]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Summary describes the changes to the role, one per line
+func (rd RoleDiff) Summary() []string {
+	lines := []string{}
+	if rd.Change != Changed {
+		lines = append(lines, fmt.Sprintf("%s %s", rd.Role, rd.Change))
+	}
+	if rd.Version != nil {
+		lines = append(lines, fmt.Sprintf("version %d -> %d", rd.Version.Before, rd.Version.After))
+	}
+	if rd.Expires != nil {
+		lines = append(lines, fmt.Sprintf("expires %s -> %s",
+			rd.Expires.Before.UTC().Format(time.RFC3339), rd.Expires.After.UTC().Format(time.RFC3339)))
+	}
+	if rd.ConsistentSnapshot != nil {
+		lines = append(lines, fmt.Sprintf("consistent_snapshot %t -> %t", rd.ConsistentSnapshot.Before, rd.ConsistentSnapshot.After))
+	}
+	for _, k := range rd.Keys {
+		lines = append(lines, fmt.Sprintf("key %s %s (%s)", k.Change, k.ID, k.Algorithm))
+	}
+	for _, r := range rd.Roles {
+		if r.Change != Changed {
+			lines = append(lines, fmt.Sprintf("%s %s", r.Name, r.Change))
+		}
+		if r.Threshold != nil {
+			lines = append(lines, fmt.Sprintf("%s threshold %d -> %d", r.Name, r.Threshold.Before, r.Threshold.After))
+		}
+		for _, id := range r.KeysAdded {
+			lines = append(lines, fmt.Sprintf("%s key added %s", r.Name, id))
+		}
+		for _, id := range r.KeysRemoved {
+			lines = append(lines, fmt.Sprintf("%s key removed %s", r.Name, id))
+		}
+		for _, p := range r.PathsAdded {
+			lines = append(lines, fmt.Sprintf("%s path added %s", r.Name, p))
+		}
+		for _, p := range r.PathsRemoved {
+			lines = append(lines, fmt.Sprintf("%s path removed %s", r.Name, p))
+		}
+		for _, p := range r.PathHashPrefixesAdded {
+			lines = append(lines, fmt.Sprintf("%s path hash prefix added %s", r.Name, p))
+		}
+		for _, p := range r.PathHashPrefixesRemoved {
+			lines = append(lines, fmt.Sprintf("%s path hash prefix removed %s", r.Name, p))
+		}
+		if r.Terminating != nil {
+			lines = append(lines, fmt.Sprintf("%s terminating %t -> %t", r.Name, r.Terminating.Before, r.Terminating.After))
+		}
+	}
+	for _, f := range append(append([]FileChange{}, rd.Targets...), rd.Meta...) {
+		switch f.Change {
+		case Added:
+			lines = append(lines, fmt.Sprintf("%s added (%d bytes)", f.Path, f.After.Length))
+		case Removed:
+			lines = append(lines, fmt.Sprintf("%s removed", f.Path))
+		default:
+			lines = append(lines, fmt.Sprintf("%s changed (%d -> %d bytes)", f.Path, f.Before.Length, f.After.Length))
+		}
+	}
+	return lines
+}
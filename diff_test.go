@@ -0,0 +1,145 @@
+package tuf
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/keys"
+	"github.com/endophage/gotuf/signed"
+	"github.com/stretchr/testify/assert"
+)
+
+// signedMetas signs every role in the repo, as it would be published
+func signedMetas(t *testing.T, repo *Repo) map[string]*data.Signed {
+	metas := make(map[string]*data.Signed)
+	s, err := repo.SignRoot(data.DefaultExpires("root"), nil)
+	assert.NoError(t, err)
+	metas["root"] = s
+	for role := range repo.Targets {
+		s, err := repo.SignTargets(role, data.DefaultExpires("targets"), nil)
+		assert.NoError(t, err)
+		metas[role] = s
+	}
+	metas["snapshot"], err = repo.SignSnapshot(data.DefaultExpires("snapshot"), nil)
+	assert.NoError(t, err)
+	metas["timestamp"], err = repo.SignTimestamp(data.DefaultExpires("timestamp"), nil)
+	assert.NoError(t, err)
+	return metas
+}
+
+func findRole(d *RepoDiff, role string) *RoleDiff {
+	for i := range d.Roles {
+		if d.Roles[i].Role == role {
+			return &d.Roles[i]
+		}
+	}
+	return nil
+}
+
+func TestDiffSigned(t *testing.T) {
+	cs := signed.NewEd25519()
+	repo := initRepo(t, cs, keys.NewDB())
+	_, err := repo.AddTargets("targets", data.Files{
+		"changed": {Length: 1, Hashes: data.Hashes{"sha256": []byte{1}}},
+		"removed": {Length: 2, Hashes: data.Hashes{"sha256": []byte{2}}},
+	})
+	assert.NoError(t, err)
+	before := signedMetas(t, repo)
+
+	_, err = repo.AddTargets("targets", data.Files{
+		"changed": {Length: 3, Hashes: data.Hashes{"sha256": []byte{3}}},
+		"added":   {Length: 4, Hashes: data.Hashes{"sha256": []byte{4}}},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, repo.RemoveTargets("targets", "removed"))
+	delegationKey, err := cs.Create("targets/level1", data.ED25519Key)
+	assert.NoError(t, err)
+	role, err := data.NewRole("targets/level1", 1, nil, []string{"level1/**"}, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, repo.UpdateDelegations(role, []data.Key{delegationKey}, ""))
+	rootKey, err := cs.Create("root", data.ED25519Key)
+	assert.NoError(t, err)
+	assert.NoError(t, repo.AddBaseKeys("root", rootKey))
+	after := signedMetas(t, repo)
+
+	d, err := DiffSigned(before, after)
+	assert.NoError(t, err)
+	assert.Len(t, d.Roles, 5)
+
+	root := findRole(d, "root")
+	assert.Equal(t, Changed, root.Change)
+	assert.Equal(t, &IntChange{Before: 1, After: 2}, root.Version)
+	assert.Equal(t, []KeyChange{{ID: rootKey.ID(), Algorithm: data.ED25519Key, Change: Added}}, root.Keys)
+	assert.Equal(t, []RoleChange{{Name: "root", Change: Changed, KeysAdded: []string{rootKey.ID()}}}, root.Roles)
+
+	targets := findRole(d, "targets")
+	assert.Equal(t, &IntChange{Before: 1, After: 2}, targets.Version)
+	assert.Len(t, targets.Targets, 3)
+	assert.Equal(t, FileChange{Path: "added", Change: Added,
+		After: &data.FileMeta{Length: 4, Hashes: data.Hashes{"sha256": []byte{4}}}}, targets.Targets[0])
+	assert.Equal(t, FileChange{Path: "changed", Change: Changed,
+		Before: &data.FileMeta{Length: 1, Hashes: data.Hashes{"sha256": []byte{1}}},
+		After:  &data.FileMeta{Length: 3, Hashes: data.Hashes{"sha256": []byte{3}}}}, targets.Targets[1])
+	assert.Equal(t, FileChange{Path: "removed", Change: Removed,
+		Before: &data.FileMeta{Length: 2, Hashes: data.Hashes{"sha256": []byte{2}}}}, targets.Targets[2])
+	assert.Equal(t, []KeyChange{{ID: delegationKey.ID(), Algorithm: data.ED25519Key, Change: Added}}, targets.Keys)
+	assert.Equal(t, []RoleChange{{
+		Name:       "targets/level1",
+		Change:     Added,
+		Threshold:  &IntChange{Before: 0, After: 1},
+		KeysAdded:  []string{delegationKey.ID()},
+		PathsAdded: []string{"level1/**"},
+	}}, targets.Roles)
+
+	delegated := findRole(d, "targets/level1")
+	assert.Equal(t, Added, delegated.Change)
+
+	snapshot := findRole(d, "snapshot")
+	assert.Equal(t, &IntChange{Before: 1, After: 2}, snapshot.Version)
+	paths := []string{}
+	for _, m := range snapshot.Meta {
+		paths = append(paths, m.Path)
+	}
+	assert.Equal(t, []string{"root", "targets", "targets/level1"}, paths)
+
+	timestamp := findRole(d, "timestamp")
+	assert.Len(t, timestamp.Meta, 1)
+	assert.Equal(t, Changed, timestamp.Meta[0].Change)
+}
+
+func TestDiffRepos(t *testing.T) {
+	repo := initRepo(t, signed.NewEd25519(), keys.NewDB())
+	assert.True(t, Diff(repo, repo).Empty())
+
+	d := Diff(nil, repo)
+	assert.Len(t, d.Roles, 4)
+	for _, rd := range d.Roles {
+		assert.Equal(t, Added, rd.Change)
+	}
+	assert.Len(t, findRole(d, "root").Keys, 4)
+
+	d = Diff(repo, nil)
+	assert.Equal(t, Removed, findRole(d, "timestamp").Change)
+}
+
+func TestDiffJSON(t *testing.T) {
+	cs := signed.NewEd25519()
+	repo := initRepo(t, cs, keys.NewDB())
+	before := signedMetas(t, repo)
+	_, err := repo.AddTargets("targets", data.Files{
+		"added": {Length: 4, Hashes: data.Hashes{"sha256": []byte{4}}},
+	})
+	assert.NoError(t, err)
+	after := signedMetas(t, repo)
+
+	d, err := DiffSigned(before, after)
+	assert.NoError(t, err)
+	raw, err := d.JSON()
+	assert.NoError(t, err)
+	decoded := &RepoDiff{}
+	assert.NoError(t, json.Unmarshal(raw, decoded))
+	assert.Equal(t, d.Roles[2].Targets, decoded.Roles[2].Targets)
+	assert.Equal(t, "targets", decoded.Roles[2].Role)
+	assert.Contains(t, findRole(d, "targets").Summary(), "added added (4 bytes)")
+}
@@ -18,6 +18,10 @@ import (
 
 const saltSize = 32
 
+// ErrDecryptFailed is returned when the ciphertext could not be decrypted,
+// most often because the passphrase was wrong
+var ErrDecryptFailed = errors.New("encrypted: decryption failed")
+
 const (
 	boxKeySize   = 32
 	boxNonceSize = 24
@@ -143,7 +147,7 @@ func (s *secretBoxCipher) Decrypt(ciphertext, key []byte) ([]byte, error) {
 
 	res, ok := secretbox.Open(nil, ciphertext, &nonceBytes, &keyBytes)
 	if !ok {
-		return nil, errors.New("encrypted: decryption failed")
+		return nil, ErrDecryptFailed
 	}
 	return res, nil
 }
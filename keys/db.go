@@ -59,6 +59,32 @@ func (db *KeyDB) AddRole(r *data.Role) error {
 	return nil
 }
 
+// RemoveRole removes a role from the database along with any of its keys
+// that are not associated with another role.
+func (db *KeyDB) RemoveRole(name string) {
+	r, ok := db.roles[name]
+	if !ok {
+		return
+	}
+	delete(db.roles, name)
+	for _, id := range r.KeyIDs {
+		if !db.keyInUse(id) {
+			delete(db.keys, id)
+		}
+	}
+}
+
+func (db *KeyDB) keyInUse(id string) bool {
+	for _, r := range db.roles {
+		for _, keyID := range r.KeyIDs {
+			if keyID == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // GetKey pulls a key out of the database by its ID
 func (db *KeyDB) GetKey(id string) data.PublicKey {
 	return db.keys[id]
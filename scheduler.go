@@ -0,0 +1,221 @@
+package tuf
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/endophage/gotuf/clock"
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/signed"
+	"github.com/endophage/gotuf/store"
+)
+
+// DefaultExpiryMargins is how long before each role expires the
+// ExpiryScheduler re-signs it, or warns that it must be re-signed
+var DefaultExpiryMargins = map[string]time.Duration{
+	data.CanonicalRootRole:      30 * 24 * time.Hour,
+	data.CanonicalTargetsRole:   7 * 24 * time.Hour,
+	data.CanonicalSnapshotRole:  24 * time.Hour,
+	data.CanonicalTimestampRole: 6 * time.Hour,
+}
+
+// defaultRetryInterval is how long the ExpiryScheduler waits after failing
+// to re-sign or publish before trying again
+const defaultRetryInterval = time.Minute
+
+// ExpiryConfig configures an ExpiryScheduler
+type ExpiryConfig struct {
+	// Margins maps a role to how long before it expires it is re-signed.
+	// Roles not listed use DefaultExpiryMargins, delegated roles use the
+	// margin of the targets role unless listed themselves.
+	Margins map[string]time.Duration
+	// ResignSnapshot re-signs the snapshot as well as the timestamp. It
+	// requires the snapshot key to be online.
+	ResignSnapshot bool
+	// CryptoService signs the re-signed roles, the repo's own is used if
+	// it is nil
+	CryptoService signed.CryptoService
+	// Clock defaults to the repo's clock
+	Clock clock.Clock
+	// Locker, if set, is held while the scheduler reads or re-signs the
+	// repo, so that the repo can safely be modified in the meantime
+	Locker sync.Locker
+	// RetryInterval is how long to wait before trying again after a
+	// failure, one minute if not set
+	RetryInterval time.Duration
+}
+
+// ExpiryScheduler watches the expiry of every role in a Repo. It re-signs
+// the timestamp, and optionally the snapshot, with new default expiries
+// before they expire and publishes the repo to a MetadataStore. Roles
+// whose keys are kept offline are only warned about.
+//
+// The snapshot is re-signed over the repo's current root and targets, so
+// any changes made to them must be signed before it next runs.
+type ExpiryScheduler struct {
+	repo        *Repo
+	metaStore   store.MetadataStore
+	config      ExpiryConfig
+	clock       clock.Clock
+	unpublished bool
+}
+
+// NewExpiryScheduler creates an ExpiryScheduler for the repo, publishing
+// to the metaStore
+func NewExpiryScheduler(repo *Repo, metaStore store.MetadataStore, config ExpiryConfig) *ExpiryScheduler {
+	c := config.Clock
+	if c == nil {
+		c = repo.Clock()
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = defaultRetryInterval
+	}
+	return &ExpiryScheduler{
+		repo:      repo,
+		metaStore: metaStore,
+		config:    config,
+		clock:     c,
+	}
+}
+
+// margin returns how long before the role expires it is due
+func (s *ExpiryScheduler) margin(role string) time.Duration {
+	if m, ok := s.config.Margins[role]; ok {
+		return m
+	}
+	base := strings.SplitN(data.CanonicalRole(role), "/", 2)[0]
+	if m, ok := s.config.Margins[base]; ok {
+		return m
+	}
+	return DefaultExpiryMargins[base]
+}
+
+func (s *ExpiryScheduler) due(role string, expires, now time.Time) bool {
+	return !now.Before(expires.Add(-s.margin(role)))
+}
+
+func (s *ExpiryScheduler) lock() {
+	if s.config.Locker != nil {
+		s.config.Locker.Lock()
+	}
+}
+
+func (s *ExpiryScheduler) unlock() {
+	if s.config.Locker != nil {
+		s.config.Locker.Unlock()
+	}
+}
+
+// Check re-signs the timestamp, and the snapshot if configured to, if they
+// are within their margin of expiring and publishes the repo. It returns
+// the roles that were re-signed. The timestamp is always re-signed along
+// with the snapshot. Any other role within its margin is logged.
+func (s *ExpiryScheduler) Check() ([]string, error) {
+	s.lock()
+	defer s.unlock()
+	tr := s.repo
+	if tr.Snapshot == nil {
+		return nil, ErrNotLoaded{role: data.ValidRoles["snapshot"]}
+	}
+	if tr.Timestamp == nil {
+		return nil, ErrNotLoaded{role: data.ValidRoles["timestamp"]}
+	}
+	now := s.clock.Now()
+	snapshotRole := data.ValidRoles["snapshot"]
+	timestampRole := data.ValidRoles["timestamp"]
+
+	resigned := []string{}
+	if s.config.ResignSnapshot && s.due(snapshotRole, tr.Snapshot.Signed.Expires, now) {
+		logrus.Debugf("re-signing %s expiring at %s", snapshotRole, tr.Snapshot.Signed.Expires)
+		if _, err := tr.SignSnapshot(data.DefaultExpiresAt(data.CanonicalSnapshotRole, now), s.config.CryptoService); err != nil {
+			return resigned, err
+		}
+		resigned = append(resigned, snapshotRole)
+	}
+	if len(resigned) > 0 || s.due(timestampRole, tr.Timestamp.Signed.Expires, now) {
+		logrus.Debugf("re-signing %s expiring at %s", timestampRole, tr.Timestamp.Signed.Expires)
+		if _, err := tr.SignTimestamp(data.DefaultExpiresAt(data.CanonicalTimestampRole, now), s.config.CryptoService); err != nil {
+			return resigned, err
+		}
+		resigned = append(resigned, timestampRole)
+	}
+	s.warnExpiring(now)
+
+	if len(resigned) > 0 {
+		s.unpublished = true
+	}
+	if s.unpublished {
+		if _, err := tr.Publish(s.metaStore); err != nil {
+			return resigned, err
+		}
+		s.unpublished = false
+	}
+	return resigned, nil
+}
+
+// warnExpiring logs the roles that are within their margin of expiring
+// but are not re-signed by the scheduler
+func (s *ExpiryScheduler) warnExpiring(now time.Time) {
+	tr := s.repo
+	expiries := make(map[string]time.Time)
+	if tr.Root != nil {
+		expiries[data.ValidRoles["root"]] = tr.Root.Signed.Expires
+	}
+	for role, t := range tr.Targets {
+		expiries[role] = t.Signed.Expires
+	}
+	if !s.config.ResignSnapshot {
+		expiries[data.ValidRoles["snapshot"]] = tr.Snapshot.Signed.Expires
+	}
+	for role, expires := range expiries {
+		if s.due(role, expires, now) {
+			logrus.Warnf("%s expires at %s and must be re-signed", role, expires)
+		}
+	}
+}
+
+// Next returns the time the next Check is due
+func (s *ExpiryScheduler) Next() time.Time {
+	s.lock()
+	defer s.unlock()
+	tr := s.repo
+	if s.unpublished || tr.Timestamp == nil || tr.Snapshot == nil {
+		return s.clock.Now()
+	}
+	next := tr.Timestamp.Signed.Expires.Add(-s.margin(data.ValidRoles["timestamp"]))
+	if s.config.ResignSnapshot {
+		snapshot := tr.Snapshot.Signed.Expires.Add(-s.margin(data.ValidRoles["snapshot"]))
+		if snapshot.Before(next) {
+			next = snapshot
+		}
+	}
+	return next
+}
+
+// Run checks the repo whenever a Check is due until the context is done.
+// Failures are logged and retried after the RetryInterval.
+func (s *ExpiryScheduler) Run(ctx context.Context) error {
+	for {
+		wait := s.config.RetryInterval
+		if resigned, err := s.Check(); err != nil {
+			logrus.Errorf("failed to re-sign expiring metadata: %s", err)
+		} else {
+			if len(resigned) > 0 {
+				logrus.Infof("re-signed and published %s", strings.Join(resigned, ", "))
+			}
+			wait = s.Next().Sub(s.clock.Now())
+			if wait <= 0 {
+				// the margin exceeds how long the role is signed for
+				wait = s.config.RetryInterval
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.clock.After(wait):
+		}
+	}
+}
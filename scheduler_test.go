@@ -0,0 +1,133 @@
+package tuf
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/endophage/gotuf/clock"
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/keys"
+	"github.com/endophage/gotuf/signed"
+	"github.com/endophage/gotuf/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// signedAt signs every role in a new repo with the default expiries
+// counted from start
+func signedAt(t *testing.T, start time.Time) *Repo {
+	repo := initRepo(t, signed.NewEd25519(), keys.NewDB())
+	_, err := repo.SignRoot(data.DefaultExpiresAt("root", start), nil)
+	assert.NoError(t, err)
+	_, err = repo.SignTargets("targets", data.DefaultExpiresAt("targets", start), nil)
+	assert.NoError(t, err)
+	_, err = repo.SignSnapshot(data.DefaultExpiresAt("snapshot", start), nil)
+	assert.NoError(t, err)
+	_, err = repo.SignTimestamp(data.DefaultExpiresAt("timestamp", start), nil)
+	assert.NoError(t, err)
+	return repo
+}
+
+func publishedCommon(t *testing.T, metaStore store.MetadataStore, role string) data.SignedCommon {
+	raw, err := metaStore.GetMeta(role, 1<<20)
+	assert.NoError(t, err)
+	s := &data.Signed{}
+	assert.NoError(t, json.Unmarshal(raw, s))
+	common := data.SignedCommon{}
+	assert.NoError(t, json.Unmarshal(s.Signed, &common))
+	return common
+}
+
+func TestExpirySchedulerCheck(t *testing.T) {
+	start := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	repo := signedAt(t, start)
+	metaStore := store.NewMemoryStore(nil, nil)
+	scheduler := NewExpiryScheduler(repo, metaStore, ExpiryConfig{Clock: fake})
+
+	// nothing is due, so nothing is published
+	resigned, err := scheduler.Check()
+	assert.NoError(t, err)
+	assert.Empty(t, resigned)
+	_, err = metaStore.GetMeta("timestamp", 1<<20)
+	assert.IsType(t, store.ErrMetaNotFound{}, err)
+	assert.Equal(t, start.Add(18*time.Hour), scheduler.Next())
+
+	fake.Set(scheduler.Next())
+	resigned, err = scheduler.Check()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"timestamp"}, resigned)
+	timestamp := publishedCommon(t, metaStore, "timestamp")
+	assert.Equal(t, 2, timestamp.Version)
+	assert.Equal(t, start.Add(42*time.Hour), timestamp.Expires)
+	assert.Equal(t, 1, publishedCommon(t, metaStore, "snapshot").Version)
+
+	// the snapshot is left to expire unless configured to be re-signed
+	fake.Set(start.Add(7 * 24 * time.Hour))
+	resigned, err = scheduler.Check()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"timestamp"}, resigned)
+	assert.Equal(t, 1, publishedCommon(t, metaStore, "snapshot").Version)
+}
+
+func TestExpirySchedulerResignSnapshot(t *testing.T) {
+	start := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	repo := signedAt(t, start)
+	metaStore := store.NewMemoryStore(nil, nil)
+	scheduler := NewExpiryScheduler(repo, metaStore, ExpiryConfig{
+		Clock:          fake,
+		ResignSnapshot: true,
+		Margins:        map[string]time.Duration{"timestamp": 2 * time.Hour},
+	})
+	assert.Equal(t, start.Add(22*time.Hour), scheduler.Next())
+
+	fake.Set(start.Add(6 * 24 * time.Hour))
+	resigned, err := scheduler.Check()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"snapshot", "timestamp"}, resigned)
+	snapshot := publishedCommon(t, metaStore, "snapshot")
+	assert.Equal(t, 2, snapshot.Version)
+	assert.Equal(t, start.Add(13*24*time.Hour), snapshot.Expires)
+	assert.Equal(t, 2, publishedCommon(t, metaStore, "timestamp").Version)
+	assert.Equal(t, 2, repo.Timestamp.Signed.Meta["snapshot"].Version)
+}
+
+func TestExpirySchedulerRun(t *testing.T) {
+	start := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	repo := signedAt(t, start)
+	metaStore := store.NewMemoryStore(nil, nil)
+	scheduler := NewExpiryScheduler(repo, metaStore, ExpiryConfig{Clock: fake})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- scheduler.Run(ctx)
+	}()
+
+	for i := 1; i <= 3; i++ {
+		fake.BlockUntil(1)
+		fake.Advance(18 * time.Hour)
+		// the scheduler waits again once it has re-signed and published
+		fake.BlockUntil(1)
+		assert.Equal(t, i+1, publishedCommon(t, metaStore, "timestamp").Version)
+	}
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+}
+
+func TestExpirySchedulerRepoClock(t *testing.T) {
+	start := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	repo := initRepo(t, signed.NewEd25519(), keys.NewDB())
+	repo.SetClock(fake)
+	assert.NoError(t, repo.InitRepo(false))
+	assert.Equal(t, start.AddDate(1, 0, 0), repo.Root.Signed.Expires)
+	assert.Equal(t, start.AddDate(0, 0, 1), repo.Timestamp.Signed.Expires)
+
+	// the scheduler defaults to the repo's clock
+	scheduler := NewExpiryScheduler(repo, store.NewMemoryStore(nil, nil), ExpiryConfig{})
+	assert.Equal(t, start.Add(18*time.Hour), scheduler.Next())
+}
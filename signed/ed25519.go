@@ -36,8 +36,13 @@ func (e *Ed25519) RemoveKey(keyID string) error {
 func (e *Ed25519) Sign(keyIDs []string, toSign []byte) ([]data.Signature, error) {
 	signatures := make([]data.Signature, 0, len(keyIDs))
 	for _, keyID := range keyIDs {
+		k, ok := e.keys[keyID]
+		if !ok {
+			// another party may hold this key
+			continue
+		}
 		priv := [ed25519.PrivateKeySize]byte{}
-		copy(priv[:], e.keys[keyID].Private())
+		copy(priv[:], k.Private())
 		sig := ed25519.Sign(&priv, toSign)
 		signatures = append(signatures, data.Signature{
 			KeyID:     keyID,
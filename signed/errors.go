@@ -2,6 +2,9 @@ package signed
 
 import (
 	"fmt"
+	"strings"
+
+	"github.com/endophage/gotuf/data"
 )
 
 // ErrExpired indicates a piece of metadata has expired
@@ -25,11 +28,17 @@ func (e ErrLowVersion) Error() string {
 	return fmt.Sprintf("version %d is lower than current version %d", e.Actual, e.Current)
 }
 
-// ErrRoleThreshold indicates we did not validate enough signatures to meet the threshold
-type ErrRoleThreshold struct{}
+// ErrRoleThreshold indicates we did not validate enough signatures to meet the threshold.
+// Report, if set, describes the outcome of verifying each signature.
+type ErrRoleThreshold struct {
+	Report *VerificationReport
+}
 
 func (e ErrRoleThreshold) Error() string {
-	return "valid signatures did not meet threshold"
+	if e.Report == nil {
+		return "valid signatures did not meet threshold"
+	}
+	return fmt.Sprintf("valid signatures did not meet threshold: %s", e.Report)
 }
 
 // ErrInvalidKeyType indicates the types for the key and signature it's associated with are
@@ -49,3 +58,57 @@ type ErrInvalidKeyLength struct {
 func (e ErrInvalidKeyLength) Error() string {
 	return fmt.Sprintf("key length is not supported: %s", e.msg)
 }
+
+// ErrUnsupportedKeyAlgorithm indicates a CryptoService cannot create, or
+// sign with, keys of the given algorithm
+type ErrUnsupportedKeyAlgorithm struct {
+	Algorithm data.KeyAlgorithm
+}
+
+func (e ErrUnsupportedKeyAlgorithm) Error() string {
+	return fmt.Sprintf("unsupported key algorithm: %s", e.Algorithm)
+}
+
+// ErrWrongPassphrase indicates the passphrase provided for a role could not
+// decrypt its key
+type ErrWrongPassphrase struct {
+	Role string
+}
+
+func (e ErrWrongPassphrase) Error() string {
+	return fmt.Sprintf("incorrect passphrase for %s", e.Role)
+}
+
+// ErrCorruptKeyFile indicates a stored key could not be read, or did not
+// contain the key its name claimed
+type ErrCorruptKeyFile struct {
+	KeyID string
+}
+
+func (e ErrCorruptKeyFile) Error() string {
+	return fmt.Sprintf("key file for %s is corrupt", e.KeyID)
+}
+
+// ErrPassphraseChangeIncomplete indicates changing the passphrase for a
+// role failed after some of its keys had been re-encrypted. The keys in
+// Changed are encrypted with the new passphrase, the rest with the old.
+type ErrPassphraseChangeIncomplete struct {
+	Role    string
+	Changed []string
+	Err     error
+}
+
+func (e ErrPassphraseChangeIncomplete) Error() string {
+	return fmt.Sprintf("changing the passphrase for %s failed after re-encrypting %s: %s",
+		e.Role, strings.Join(e.Changed, ", "), e.Err)
+}
+
+// ErrTokenNotFound indicates no PKCS#11 token with the given label is
+// present
+type ErrTokenNotFound struct {
+	Label string
+}
+
+func (e ErrTokenNotFound) Error() string {
+	return fmt.Sprintf("no PKCS#11 token labelled %s", e.Label)
+}
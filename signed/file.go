@@ -0,0 +1,409 @@
+package signed
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/encrypted"
+	"github.com/endophage/gotuf/utils"
+)
+
+const (
+	keyFileExtension = ".key"
+	// passphraseAttempts is the number of times the passphrase for a role
+	// is requested before giving up on unlocking a key
+	passphraseAttempts = 3
+)
+
+// keyFile is the on disk representation of a key. Only the private part
+// is encrypted so keys can be listed without a passphrase.
+type keyFile struct {
+	Role      string            `json:"role"`
+	Algorithm data.KeyAlgorithm `json:"keytype"`
+	Public    []byte            `json:"public"`
+	Private   json.RawMessage   `json:"private"`
+}
+
+// FileCryptoService is a CryptoService that stores each private key in its
+// own file in a directory, encrypted with the passphrase for the role the
+// key was created for. Passphrases are requested from a PassphraseFunc
+// when a key is created or first used. Unlocked keys are cached in memory
+// until Lock is called.
+type FileCryptoService struct {
+	mutex      sync.Mutex
+	baseDir    string
+	passphrase utils.PassphraseFunc
+	unlocked   map[string]data.PrivateKey
+	// rename moves staged key files into place
+	rename func(oldpath, newpath string) error
+}
+
+// NewFileCryptoService creates a FileCryptoService storing keys in baseDir,
+// which is created if it does not exist
+func NewFileCryptoService(baseDir string, passphrase utils.PassphraseFunc) (*FileCryptoService, error) {
+	if err := os.MkdirAll(baseDir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileCryptoService{
+		baseDir:    baseDir,
+		passphrase: passphrase,
+		unlocked:   make(map[string]data.PrivateKey),
+		rename:     os.Rename,
+	}, nil
+}
+
+// Create generates a new key, as MemoryCryptoService.Create does, and
+// stores it encrypted with the passphrase for role
+func (f *FileCryptoService) Create(role string, algorithm data.KeyAlgorithm) (data.PublicKey, error) {
+	return f.CreateWithSize(role, algorithm, defaultKeySize(algorithm))
+}
+
+// CreateWithSize generates a new key of the given size, as
+// MemoryCryptoService.CreateWithSize does, and stores it encrypted with
+// the passphrase for role
+func (f *FileCryptoService) CreateWithSize(role string, algorithm data.KeyAlgorithm, bits int) (data.PublicKey, error) {
+	private, err := GenerateKey(algorithm, bits)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.AddKey(role, private); err != nil {
+		return nil, err
+	}
+	return data.PublicKeyFromPrivate(private), nil
+}
+
+// AddKey stores an existing private key encrypted with the passphrase
+// for role
+func (f *FileCryptoService) AddKey(role string, k data.PrivateKey) error {
+	if _, err := signer(k); err != nil {
+		return err
+	}
+	passphrase, err := f.passphrase(role, true)
+	if err != nil {
+		return err
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if err := f.writeKey(role, k, passphrase); err != nil {
+		return err
+	}
+	f.unlocked[k.ID()] = k
+	return nil
+}
+
+// RemoveKey deletes the key's file and forgets the unlocked key
+func (f *FileCryptoService) RemoveKey(keyID string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.unlocked, keyID)
+	path, err := f.keyPath(keyID)
+	if err == nil {
+		err = os.Remove(path)
+	}
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// GetKey returns the public part of the key with the given ID, or nil if
+// the service does not hold it. No passphrase is required.
+func (f *FileCryptoService) GetKey(keyID string) data.PublicKey {
+	kf, err := f.readKeyFile(keyID)
+	if err != nil {
+		return nil
+	}
+	return data.NewPublicKey(kf.Algorithm, kf.Public)
+}
+
+// PublicKeys returns a map of public keys for the ids provided, when those
+// IDs are found in the service
+func (f *FileCryptoService) PublicKeys(keyIDs ...string) (map[string]data.PublicKey, error) {
+	pubs := make(map[string]data.PublicKey)
+	for _, keyID := range keyIDs {
+		if k := f.GetKey(keyID); k != nil {
+			pubs[keyID] = k
+		}
+	}
+	return pubs, nil
+}
+
+// ListKeys returns the role each stored key was created for, keyed by
+// key ID. No passphrase is required.
+func (f *FileCryptoService) ListKeys() (map[string]string, error) {
+	files, err := ioutil.ReadDir(f.baseDir)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]string)
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != keyFileExtension {
+			continue
+		}
+		keyID := strings.TrimSuffix(file.Name(), keyFileExtension)
+		kf, err := f.readKeyFile(keyID)
+		if err != nil {
+			return nil, err
+		}
+		keys[keyID] = kf.Role
+	}
+	return keys, nil
+}
+
+// Sign generates a signature over the data with each of the keys the
+// service holds, unlocking them if necessary. Key IDs it does not hold are
+// skipped as another party may hold them.
+func (f *FileCryptoService) Sign(keyIDs []string, toSign []byte) ([]data.Signature, error) {
+	signatures := make([]data.Signature, 0, len(keyIDs))
+	for _, keyID := range keyIDs {
+		k, err := f.unlock(keyID)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sig, err := SignWithKey(k, toSign)
+		if err != nil {
+			return nil, err
+		}
+		sig.KeyID = keyID
+		signatures = append(signatures, sig)
+	}
+	return signatures, nil
+}
+
+// ChangePassphrase re-encrypts every key stored for role with the passphrase
+// returned by newPassphrase. The current passphrase is requested once, even if
+// the keys are already unlocked, and must decrypt every key stored for role.
+// Every key is re-encrypted to a staged file before any is replaced, so a
+// failure to re-encrypt leaves all the keys with the old passphrase. Should
+// replacing the keys fail part way an ErrPassphraseChangeIncomplete reports
+// which keys have the new passphrase.
+func (f *FileCryptoService) ChangePassphrase(role string, newPassphrase utils.PassphraseFunc) error {
+	keys, err := f.ListKeys()
+	if err != nil {
+		return err
+	}
+	unlocked := make([]data.PrivateKey, 0, len(keys))
+	var oldPassphrase []byte
+	for keyID, keyRole := range keys {
+		if keyRole != role {
+			continue
+		}
+		kf, err := f.readKeyFile(keyID)
+		if err != nil {
+			return err
+		}
+		var k data.PrivateKey
+		if len(unlocked) == 0 {
+			k, oldPassphrase, err = f.requestPassphrase(keyID, kf)
+		} else {
+			k, err = decryptKeyFile(keyID, kf, oldPassphrase)
+			if err == encrypted.ErrDecryptFailed {
+				err = ErrWrongPassphrase{Role: role}
+			}
+		}
+		if err != nil {
+			return err
+		}
+		unlocked = append(unlocked, k)
+	}
+	if len(unlocked) == 0 {
+		return nil
+	}
+	passphrase, err := newPassphrase(role, true)
+	if err != nil {
+		return err
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	staged := make(map[string]string, len(unlocked))
+	defer func() {
+		for _, name := range staged {
+			os.Remove(name)
+		}
+	}()
+	for _, k := range unlocked {
+		name, err := f.stageKey(role, k, passphrase)
+		if err != nil {
+			return err
+		}
+		staged[k.ID()] = name
+	}
+	changed := make([]string, 0, len(staged))
+	for keyID, name := range staged {
+		path, err := f.keyPath(keyID)
+		if err == nil {
+			err = f.rename(name, path)
+		}
+		if err != nil {
+			if len(changed) == 0 {
+				return err
+			}
+			sort.Strings(changed)
+			return ErrPassphraseChangeIncomplete{Role: role, Changed: changed, Err: err}
+		}
+		changed = append(changed, keyID)
+	}
+	return nil
+}
+
+// Lock forgets every unlocked key, so the passphrase will be requested
+// again before they are next used
+func (f *FileCryptoService) Lock() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.unlocked = make(map[string]data.PrivateKey)
+}
+
+// unlock returns the private key, decrypting it if it is not cached
+func (f *FileCryptoService) unlock(keyID string) (data.PrivateKey, error) {
+	f.mutex.Lock()
+	k, ok := f.unlocked[keyID]
+	f.mutex.Unlock()
+	if ok {
+		return k, nil
+	}
+	k, err := f.decryptKey(keyID)
+	if err != nil {
+		return nil, err
+	}
+	f.mutex.Lock()
+	f.unlocked[keyID] = k
+	f.mutex.Unlock()
+	return k, nil
+}
+
+// decryptKey reads and decrypts the key, requesting the passphrase for
+// its role until it is correct or passphraseAttempts have been made
+func (f *FileCryptoService) decryptKey(keyID string) (data.PrivateKey, error) {
+	kf, err := f.readKeyFile(keyID)
+	if err != nil {
+		return nil, err
+	}
+	k, _, err := f.requestPassphrase(keyID, kf)
+	return k, err
+}
+
+// requestPassphrase requests the passphrase for the role of the key file
+// until it decrypts the key or passphraseAttempts have been made, returning
+// the key along with the passphrase that decrypted it
+func (f *FileCryptoService) requestPassphrase(keyID string, kf *keyFile) (data.PrivateKey, []byte, error) {
+	for attempt := 0; attempt < passphraseAttempts; attempt++ {
+		passphrase, err := f.passphrase(kf.Role, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		k, err := decryptKeyFile(keyID, kf, passphrase)
+		if err == encrypted.ErrDecryptFailed {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return k, passphrase, nil
+	}
+	return nil, nil, ErrWrongPassphrase{Role: kf.Role}
+}
+
+// decryptKeyFile decrypts the private part of the key file with passphrase
+func decryptKeyFile(keyID string, kf *keyFile, passphrase []byte) (data.PrivateKey, error) {
+	k := &data.TUFKey{}
+	if err := encrypted.Unmarshal(kf.Private, k, passphrase); err != nil {
+		return nil, err
+	}
+	// the file may have been renamed or its public part replaced
+	if k.ID() != keyID || k.Algorithm() != kf.Algorithm {
+		return nil, ErrCorruptKeyFile{KeyID: keyID}
+	}
+	return k, nil
+}
+
+// keyPath returns the name of the key's file. A key ID that could not name
+// a file in the base directory is reported as not existing.
+func (f *FileCryptoService) keyPath(keyID string) (string, error) {
+	if keyID == "" || strings.ContainsAny(keyID, `/\`) {
+		// not a key ID this service could have generated a file name for
+		return "", os.ErrNotExist
+	}
+	return filepath.Join(f.baseDir, keyID+keyFileExtension), nil
+}
+
+func (f *FileCryptoService) readKeyFile(keyID string) (*keyFile, error) {
+	path, err := f.keyPath(keyID)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	kf := &keyFile{}
+	if err := json.Unmarshal(raw, kf); err != nil {
+		return nil, ErrCorruptKeyFile{KeyID: keyID}
+	}
+	return kf, nil
+}
+
+// writeKey encrypts and writes the key, replacing any existing file for
+// it atomically. The caller must hold the mutex.
+func (f *FileCryptoService) writeKey(role string, k data.PrivateKey, passphrase []byte) error {
+	name, err := f.stageKey(role, k, passphrase)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(name)
+	path, err := f.keyPath(k.ID())
+	if err != nil {
+		return err
+	}
+	return f.rename(name, path)
+}
+
+// stageKey encrypts and writes the key to a temporary file in the base
+// directory, returning its name. The caller must hold the mutex and is
+// responsible for renaming or removing the file.
+func (f *FileCryptoService) stageKey(role string, k data.PrivateKey, passphrase []byte) (string, error) {
+	private := data.NewPrivateKey(k.Algorithm(), k.Public(), k.Private())
+	ciphertext, err := encrypted.Marshal(private, passphrase)
+	if err != nil {
+		return "", err
+	}
+	raw, err := json.Marshal(keyFile{
+		Role:      role,
+		Algorithm: k.Algorithm(),
+		Public:    k.Public(),
+		Private:   ciphertext,
+	})
+	if err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempFile(f.baseDir, ".tmp-")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	// the contents must be on disk before the rename replacing the key
+	// file can be
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
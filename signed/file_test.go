@@ -0,0 +1,225 @@
+package signed
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// passphrases returns a PassphraseFunc answering from the map, and counts
+// the number of times each role was asked for
+func passphrases(p map[string]string, asked map[string]int) utils.PassphraseFunc {
+	return func(role string, confirm bool) ([]byte, error) {
+		asked[role]++
+		pass, ok := p[role]
+		if !ok {
+			return nil, errors.New("no passphrase for " + role)
+		}
+		return []byte(pass), nil
+	}
+}
+
+func TestFileCryptoServiceSurvivesRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotuf-keys")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	asked := make(map[string]int)
+	pass := passphrases(map[string]string{"root": "rootpass", "targets": "targetspass"}, asked)
+
+	service, err := NewFileCryptoService(dir, pass)
+	assert.NoError(t, err)
+	rootKey, err := service.Create("root", data.ECDSAKey)
+	assert.NoError(t, err)
+	targetsKey, err := service.Create("targets", data.ED25519Key)
+	assert.NoError(t, err)
+
+	// newly created keys are already unlocked
+	asked["root"] = 0
+	sigs, err := service.Sign([]string{rootKey.ID()}, []byte("msg"))
+	assert.NoError(t, err)
+	assert.Len(t, sigs, 1)
+	assert.Equal(t, 0, asked["root"])
+
+	// the private key is never written in the clear
+	raw, err := ioutil.ReadFile(filepath.Join(dir, rootKey.ID()+keyFileExtension))
+	assert.NoError(t, err)
+	k, err := service.unlock(rootKey.ID())
+	assert.NoError(t, err)
+	assert.NotContains(t, string(raw), string(k.Private()))
+
+	service, err = NewFileCryptoService(dir, pass)
+	assert.NoError(t, err)
+	keys, err := service.ListKeys()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{rootKey.ID(): "root", targetsKey.ID(): "targets"}, keys)
+	assert.Equal(t, rootKey.ID(), service.GetKey(rootKey.ID()).ID())
+
+	sigs, err = service.Sign([]string{rootKey.ID(), targetsKey.ID(), "unknown"}, []byte("msg"))
+	assert.NoError(t, err)
+	assert.Len(t, sigs, 2)
+	assert.NoError(t, ECDSAVerifier{}.Verify(rootKey, sigs[0].Signature, []byte("msg")))
+	assert.NoError(t, Ed25519Verifier{}.Verify(targetsKey, sigs[1].Signature, []byte("msg")))
+	assert.Equal(t, 1, asked["root"])
+
+	// unlocked keys are cached until locked
+	_, err = service.Sign([]string{rootKey.ID()}, []byte("msg"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, asked["root"])
+	service.Lock()
+	_, err = service.Sign([]string{rootKey.ID()}, []byte("msg"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, asked["root"])
+
+	assert.NoError(t, service.RemoveKey(rootKey.ID()))
+	assert.Nil(t, service.GetKey(rootKey.ID()))
+	sigs, err = service.Sign([]string{rootKey.ID()}, []byte("msg"))
+	assert.NoError(t, err)
+	assert.Len(t, sigs, 0)
+}
+
+func TestFileCryptoServiceWrongPassphrase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotuf-keys")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	asked := make(map[string]int)
+
+	service, err := NewFileCryptoService(dir, passphrases(map[string]string{"root": "right"}, asked))
+	assert.NoError(t, err)
+	key, err := service.Create("root", data.ED25519Key)
+	assert.NoError(t, err)
+
+	asked = make(map[string]int)
+	service, err = NewFileCryptoService(dir, passphrases(map[string]string{"root": "wrong"}, asked))
+	assert.NoError(t, err)
+	_, err = service.Sign([]string{key.ID()}, []byte("msg"))
+	assert.Equal(t, ErrWrongPassphrase{Role: "root"}, err)
+	assert.Equal(t, passphraseAttempts, asked["root"])
+}
+
+func TestFileCryptoServiceChangePassphrase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotuf-keys")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	asked := make(map[string]int)
+	old := passphrases(map[string]string{"root": "old", "targets": "targets"}, asked)
+
+	service, err := NewFileCryptoService(dir, old)
+	assert.NoError(t, err)
+	rootKey, err := service.Create("root", data.ED25519Key)
+	assert.NoError(t, err)
+	_, err = service.Create("root", data.ED25519Key)
+	assert.NoError(t, err)
+	targetsKey, err := service.Create("targets", data.ED25519Key)
+	assert.NoError(t, err)
+
+	// the old and new passphrases are each requested once for both keys
+	asked["root"] = 0
+	err = service.ChangePassphrase("root", passphrases(map[string]string{"root": "new"}, asked))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, asked["root"])
+
+	// only the keys for the role are re-encrypted
+	service, err = NewFileCryptoService(dir, passphrases(map[string]string{"root": "new", "targets": "targets"}, asked))
+	assert.NoError(t, err)
+	sigs, err := service.Sign([]string{rootKey.ID(), targetsKey.ID()}, []byte("msg"))
+	assert.NoError(t, err)
+	assert.Len(t, sigs, 2)
+
+	service, err = NewFileCryptoService(dir, old)
+	assert.NoError(t, err)
+	_, err = service.Sign([]string{rootKey.ID()}, []byte("msg"))
+	assert.IsType(t, ErrWrongPassphrase{}, err)
+}
+
+func TestFileCryptoServiceChangePassphraseIncomplete(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotuf-keys")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	asked := make(map[string]int)
+	old := passphrases(map[string]string{"root": "old"}, asked)
+	service, err := NewFileCryptoService(dir, old)
+	assert.NoError(t, err)
+	var keyIDs []string
+	for i := 0; i < 2; i++ {
+		k, err := service.Create("root", data.ED25519Key)
+		assert.NoError(t, err)
+		keyIDs = append(keyIDs, k.ID())
+	}
+
+	// the second key file cannot be replaced
+	renames := 0
+	service.rename = func(from, to string) error {
+		renames++
+		if renames > 1 {
+			return errors.New("rename failed")
+		}
+		return os.Rename(from, to)
+	}
+	err = service.ChangePassphrase("root", passphrases(map[string]string{"root": "new"}, asked))
+	assert.IsType(t, ErrPassphraseChangeIncomplete{}, err)
+	changed := err.(ErrPassphraseChangeIncomplete).Changed
+	assert.Len(t, changed, 1)
+
+	// the key reported has the new passphrase, the other the old, and no
+	// staged files are left behind
+	for _, keyID := range keyIDs {
+		pass := "old"
+		if keyID == changed[0] {
+			pass = "new"
+		}
+		service, err = NewFileCryptoService(dir, passphrases(map[string]string{"root": pass}, asked))
+		assert.NoError(t, err)
+		_, err = service.Sign([]string{keyID}, []byte("msg"))
+		assert.NoError(t, err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+}
+
+func TestFileCryptoServiceRenamedKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotuf-keys")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	pass := passphrases(map[string]string{"root": "pass"}, make(map[string]int))
+
+	service, err := NewFileCryptoService(dir, pass)
+	assert.NoError(t, err)
+	key, err := service.Create("root", data.ED25519Key)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Rename(
+		filepath.Join(dir, key.ID()+keyFileExtension),
+		filepath.Join(dir, "abcdef"+keyFileExtension),
+	))
+
+	service, err = NewFileCryptoService(dir, pass)
+	assert.NoError(t, err)
+	_, err = service.Sign([]string{"abcdef"}, []byte("msg"))
+	assert.Equal(t, ErrCorruptKeyFile{KeyID: "abcdef"}, err)
+}
+
+func TestFileCryptoServiceRemoveKeyOutsideBaseDir(t *testing.T) {
+	parent, err := ioutil.TempDir("", "gotuf-keys")
+	assert.NoError(t, err)
+	defer os.RemoveAll(parent)
+	dir := filepath.Join(parent, "keys")
+	service, err := NewFileCryptoService(dir, passphrases(nil, make(map[string]int)))
+	assert.NoError(t, err)
+
+	// a file beside the key directory named as a key file would be
+	outside := filepath.Join(parent, "x"+keyFileExtension)
+	assert.NoError(t, ioutil.WriteFile(outside, []byte("not a key"), 0600))
+
+	for _, keyID := range []string{"../x", `..\x`} {
+		assert.NoError(t, service.RemoveKey(keyID))
+		assert.Nil(t, service.GetKey(keyID))
+	}
+	_, err = os.Stat(outside)
+	assert.NoError(t, err, "a file outside the key directory was removed")
+}
@@ -0,0 +1,257 @@
+package signed
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"sync"
+
+	"github.com/agl/ed25519"
+	"github.com/endophage/gotuf/data"
+)
+
+const (
+	defaultECDSAKeySizeBit = 256
+	defaultRSAKeySizeBit   = minRSAKeySizeBit
+)
+
+// MemoryCryptoService implements an in memory CryptoService for ED25519,
+// ECDSA (P-256 and P-384) and RSA keys. ECDSA signatures are the raw
+// concatenation of r and s, and RSA signatures use RSASSA-PSS, both over
+// the sha256 digest of the data, as expected by ECDSAVerifier and
+// RSAPSSVerifier.
+type MemoryCryptoService struct {
+	mutex sync.RWMutex
+	keys  map[string]data.PrivateKey
+}
+
+// NewMemoryCryptoService initializes a new empty MemoryCryptoService
+func NewMemoryCryptoService() *MemoryCryptoService {
+	return &MemoryCryptoService{
+		keys: make(map[string]data.PrivateKey),
+	}
+}
+
+// Create generates a new key of the default size for the algorithm, P-256
+// for ECDSA and 2048 bits for RSA, and returns the public part
+func (m *MemoryCryptoService) Create(role string, algorithm data.KeyAlgorithm) (data.PublicKey, error) {
+	return m.CreateWithSize(role, algorithm, defaultKeySize(algorithm))
+}
+
+// CreateWithSize generates a new key of the given size in bits and returns
+// the public part. ECDSA keys may be 256 or 384 bits and RSA keys must be
+// at least 2048 bits. The size of ED25519 keys is fixed and bits is ignored.
+func (m *MemoryCryptoService) CreateWithSize(role string, algorithm data.KeyAlgorithm, bits int) (data.PublicKey, error) {
+	private, err := GenerateKey(algorithm, bits)
+	if err != nil {
+		return nil, err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.keys[private.ID()] = private
+	return data.PublicKeyFromPrivate(private), nil
+}
+
+// AddKey adds an existing private key to the service
+func (m *MemoryCryptoService) AddKey(k data.PrivateKey) error {
+	if _, err := signer(k); err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.keys[k.ID()] = k
+	return nil
+}
+
+// RemoveKey deletes a key from the service
+func (m *MemoryCryptoService) RemoveKey(keyID string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.keys, keyID)
+	return nil
+}
+
+// GetKey returns the public part of the key with the given ID, or nil if
+// the service does not hold it
+func (m *MemoryCryptoService) GetKey(keyID string) data.PublicKey {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	k, ok := m.keys[keyID]
+	if !ok {
+		return nil
+	}
+	return data.PublicKeyFromPrivate(k)
+}
+
+// PublicKeys returns a map of public keys for the ids provided, when those
+// IDs are found in the service
+func (m *MemoryCryptoService) PublicKeys(keyIDs ...string) (map[string]data.PublicKey, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	pubs := make(map[string]data.PublicKey)
+	for _, keyID := range keyIDs {
+		if k, ok := m.keys[keyID]; ok {
+			pubs[keyID] = data.PublicKeyFromPrivate(k)
+		}
+	}
+	return pubs, nil
+}
+
+// Sign generates a signature over the data with each of the keys the
+// service holds. Key IDs it does not hold are skipped as another party
+// may hold them.
+func (m *MemoryCryptoService) Sign(keyIDs []string, toSign []byte) ([]data.Signature, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	signatures := make([]data.Signature, 0, len(keyIDs))
+	for _, keyID := range keyIDs {
+		k, ok := m.keys[keyID]
+		if !ok {
+			continue
+		}
+		sig, err := SignWithKey(k, toSign)
+		if err != nil {
+			return nil, err
+		}
+		sig.KeyID = keyID
+		signatures = append(signatures, sig)
+	}
+	return signatures, nil
+}
+
+// defaultKeySize returns the size in bits of keys generated for the
+// algorithm when no size is given
+func defaultKeySize(algorithm data.KeyAlgorithm) int {
+	switch algorithm {
+	case data.ECDSAKey:
+		return defaultECDSAKeySizeBit
+	case data.RSAKey:
+		return defaultRSAKeySizeBit
+	}
+	return 0
+}
+
+// GenerateKey generates a new private key for the algorithm, with the
+// private part serialized as the verifiers expect: DER encoded PKCS#1 for
+// RSA and SEC 1 for ECDSA. See MemoryCryptoService.CreateWithSize for the
+// permitted sizes.
+func GenerateKey(algorithm data.KeyAlgorithm, bits int) (data.PrivateKey, error) {
+	switch algorithm {
+	case data.ED25519Key:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return data.NewPrivateKey(data.ED25519Key, pub[:], priv[:]), nil
+	case data.ECDSAKey:
+		var curve elliptic.Curve
+		switch bits {
+		case 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		default:
+			return nil, ErrInvalidKeyLength{msg: fmt.Sprintf("ECDSA keys must be 256 or 384 bits, not %d.", bits)}
+		}
+		priv, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		pub, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(priv)
+		if err != nil {
+			return nil, err
+		}
+		return data.NewPrivateKey(data.ECDSAKey, pub, der), nil
+	case data.RSAKey:
+		if bits < minRSAKeySizeBit {
+			return nil, ErrInvalidKeyLength{msg: fmt.Sprintf("RSA key must be at least %d bits.", minRSAKeySizeBit)}
+		}
+		priv, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return nil, err
+		}
+		pub, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		return data.NewPrivateKey(data.RSAKey, pub, x509.MarshalPKCS1PrivateKey(priv)), nil
+	}
+	return nil, ErrUnsupportedKeyAlgorithm{Algorithm: algorithm}
+}
+
+// SignWithKey signs the data with the private key, returning a signature
+// with the method appropriate to the key and without a key ID
+func SignWithKey(k data.PrivateKey, toSign []byte) (data.Signature, error) {
+	s, err := signer(k)
+	if err != nil {
+		return data.Signature{}, err
+	}
+	sig, method, err := s(toSign)
+	if err != nil {
+		return data.Signature{}, err
+	}
+	return data.Signature{Method: method, Signature: sig}, nil
+}
+
+// signer parses the private key, returning a function that signs with it
+func signer(k data.PrivateKey) (func([]byte) ([]byte, data.SigAlgorithm, error), error) {
+	switch k.Algorithm() {
+	case data.ED25519Key:
+		if len(k.Private()) != ed25519.PrivateKeySize {
+			return nil, ErrInvalidKeyLength{msg: fmt.Sprintf("ed25519 private key must be %d bytes.", ed25519.PrivateKeySize)}
+		}
+		priv := [ed25519.PrivateKeySize]byte{}
+		copy(priv[:], k.Private())
+		return func(msg []byte) ([]byte, data.SigAlgorithm, error) {
+			sig := ed25519.Sign(&priv, msg)
+			return sig[:], data.EDDSASignature, nil
+		}, nil
+	case data.ECDSAKey:
+		priv, err := x509.ParseECPrivateKey(k.Private())
+		if err != nil {
+			return nil, err
+		}
+		octets := (priv.Params().BitSize + 7) >> 3
+		return func(msg []byte) ([]byte, data.SigAlgorithm, error) {
+			digest := sha256.Sum256(msg)
+			r, s, err := ecdsa.Sign(rand.Reader, priv, digest[:])
+			if err != nil {
+				return nil, "", err
+			}
+			// r and s are left padded to the curve's size so the
+			// verifier can split the signature in half
+			sig := make([]byte, 2*octets)
+			rBytes, sBytes := r.Bytes(), s.Bytes()
+			copy(sig[octets-len(rBytes):octets], rBytes)
+			copy(sig[2*octets-len(sBytes):], sBytes)
+			return sig, data.ECDSASignature, nil
+		}, nil
+	case data.RSAKey:
+		priv, err := x509.ParsePKCS1PrivateKey(k.Private())
+		if err != nil {
+			return nil, err
+		}
+		if priv.N.BitLen() < minRSAKeySizeBit {
+			return nil, ErrInvalidKeyLength{msg: fmt.Sprintf("RSA key must be at least %d bits.", minRSAKeySizeBit)}
+		}
+		return func(msg []byte) ([]byte, data.SigAlgorithm, error) {
+			digest := sha256.Sum256(msg)
+			opts := rsa.PSSOptions{SaltLength: sha256.Size, Hash: crypto.SHA256}
+			sig, err := rsa.SignPSS(rand.Reader, priv, crypto.SHA256, digest[:], &opts)
+			if err != nil {
+				return nil, "", err
+			}
+			return sig, data.RSAPSSSignature, nil
+		}, nil
+	}
+	return nil, ErrUnsupportedKeyAlgorithm{Algorithm: k.Algorithm()}
+}
@@ -0,0 +1,84 @@
+package signed
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"text/template"
+
+	"github.com/endophage/gotuf/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryCryptoServiceSign(t *testing.T) {
+	msg := []byte("test data")
+	for _, test := range []struct {
+		algorithm data.KeyAlgorithm
+		bits      int
+		method    data.SigAlgorithm
+	}{
+		{data.ED25519Key, 0, data.EDDSASignature},
+		{data.ECDSAKey, 256, data.ECDSASignature},
+		{data.ECDSAKey, 384, data.ECDSASignature},
+		{data.RSAKey, 2048, data.RSAPSSSignature},
+	} {
+		service := NewMemoryCryptoService()
+		pub, err := service.CreateWithSize("root", test.algorithm, test.bits)
+		assert.NoError(t, err)
+		assert.Equal(t, test.algorithm, pub.Algorithm())
+		assert.Equal(t, pub.ID(), service.GetKey(pub.ID()).ID())
+
+		sigs, err := service.Sign([]string{pub.ID(), "unknown"}, msg)
+		assert.NoError(t, err)
+		assert.Len(t, sigs, 1)
+		assert.Equal(t, pub.ID(), sigs[0].KeyID)
+		assert.Equal(t, test.method, sigs[0].Method)
+		assert.NoError(t, Verifiers[sigs[0].Method].Verify(pub, sigs[0].Signature, msg), string(test.algorithm))
+		assert.Error(t, Verifiers[sigs[0].Method].Verify(pub, sigs[0].Signature, []byte("other data")))
+
+		assert.NoError(t, service.RemoveKey(pub.ID()))
+		assert.Nil(t, service.GetKey(pub.ID()))
+		sigs, err = service.Sign([]string{pub.ID()}, msg)
+		assert.NoError(t, err)
+		assert.Len(t, sigs, 0)
+	}
+}
+
+func TestMemoryCryptoServiceCreateDefaults(t *testing.T) {
+	service := NewMemoryCryptoService()
+	for _, algorithm := range []data.KeyAlgorithm{data.ED25519Key, data.ECDSAKey} {
+		pub, err := service.Create("targets", algorithm)
+		assert.NoError(t, err)
+		keys, err := service.PublicKeys(pub.ID())
+		assert.NoError(t, err)
+		assert.Len(t, keys, 1)
+	}
+}
+
+func TestMemoryCryptoServiceCreateInvalid(t *testing.T) {
+	service := NewMemoryCryptoService()
+	_, err := service.CreateWithSize("root", data.ECDSAKey, 521)
+	assert.IsType(t, ErrInvalidKeyLength{}, err)
+	_, err = service.CreateWithSize("root", data.RSAKey, 1024)
+	assert.IsType(t, ErrInvalidKeyLength{}, err)
+	_, err = service.Create("root", data.RSAx509Key)
+	assert.Equal(t, ErrUnsupportedKeyAlgorithm{Algorithm: data.RSAx509Key}, err)
+}
+
+func TestMemoryCryptoServiceAddKey(t *testing.T) {
+	var key data.TUFKey
+	var jsonKey bytes.Buffer
+	templ, _ := template.New("KeyTemplate").Parse(baseECDSAKey)
+	templ.Execute(&jsonKey, KeyTemplate{KeyType: data.ECDSAKey})
+	assert.NoError(t, json.Unmarshal(jsonKey.Bytes(), &key))
+
+	service := NewMemoryCryptoService()
+	assert.NoError(t, service.AddKey(&key))
+	sigs, err := service.Sign([]string{key.ID()}, []byte("test data"))
+	assert.NoError(t, err)
+	assert.Len(t, sigs, 1)
+	assert.NoError(t, ECDSAVerifier{}.Verify(&key, sigs[0].Signature, []byte("test data")))
+
+	bad := data.NewPrivateKey(data.ECDSAKey, key.Public(), []byte("not a key"))
+	assert.Error(t, service.AddKey(bad))
+}
@@ -0,0 +1,538 @@
+//go:build pkcs11
+// +build pkcs11
+
+package signed
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/docker/notary/trustmanager"
+	"github.com/endophage/gotuf/data"
+	"github.com/miekg/pkcs11"
+)
+
+var (
+	// DER encoded OIDs of the supported curves, as CKA_EC_PARAMS
+	oidP256 = []byte{0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07}
+	oidP384 = []byte{0x06, 0x05, 0x2b, 0x81, 0x04, 0x00, 0x22}
+
+	// sha256DigestInfo is the DER prefix of a PKCS#1 v1.5 DigestInfo for
+	// a sha256 digest
+	sha256DigestInfo = []byte{0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20}
+)
+
+// PKCS11Config identifies the PKCS#11 token a PKCS11CryptoService uses
+type PKCS11Config struct {
+	// Module is the path to the PKCS#11 library, e.g. libsofthsm2.so
+	Module string
+	// TokenLabel selects the slot whose token has this label
+	TokenLabel string
+	// PIN is the user PIN of the token
+	PIN string
+}
+
+// PKCS11CryptoService is a CryptoService for ECDSA and RSA keys generated,
+// and held, in a PKCS#11 token such as an HSM. Private keys never leave
+// the token. Public keys are returned as self signed x509 certificates
+// (ecdsa-x509 and rsa-x509 keys), which are also stored in the token, and
+// each key is identified by its canonical key ID (see
+// utils.CanonicalKeyID).
+//
+// It is only built with the pkcs11 build tag as it requires cgo.
+type PKCS11CryptoService struct {
+	mutex   sync.Mutex
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+}
+
+// NewPKCS11CryptoService loads the PKCS#11 module and logs in to the token
+// with the configured label. Close must be called once the service is no
+// longer needed.
+func NewPKCS11CryptoService(config PKCS11Config) (*PKCS11CryptoService, error) {
+	ctx := pkcs11.New(config.Module)
+	if ctx == nil {
+		return nil, fmt.Errorf("failed to load PKCS#11 module %s", config.Module)
+	}
+	if err := ctx.Initialize(); err != nil && !isPKCS11Error(err, pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED) {
+		ctx.Destroy()
+		return nil, err
+	}
+	p := &PKCS11CryptoService{ctx: ctx}
+	if err := p.openSession(config); err != nil {
+		ctx.Finalize()
+		ctx.Destroy()
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *PKCS11CryptoService) openSession(config PKCS11Config) error {
+	slots, err := p.ctx.GetSlotList(true)
+	if err != nil {
+		return err
+	}
+	for _, slot := range slots {
+		info, err := p.ctx.GetTokenInfo(slot)
+		if err != nil || strings.TrimSpace(info.Label) != config.TokenLabel {
+			continue
+		}
+		session, err := p.ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+		if err != nil {
+			return err
+		}
+		err = p.ctx.Login(session, pkcs11.CKU_USER, config.PIN)
+		if err != nil && !isPKCS11Error(err, pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+			p.ctx.CloseSession(session)
+			return err
+		}
+		p.session = session
+		return nil
+	}
+	return ErrTokenNotFound{Label: config.TokenLabel}
+}
+
+// Close logs out of the token and unloads the module
+func (p *PKCS11CryptoService) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.ctx.Logout(p.session)
+	err := p.ctx.CloseSession(p.session)
+	p.ctx.Finalize()
+	p.ctx.Destroy()
+	return err
+}
+
+// Create generates a new key in the token, P-256 for ECDSA and 2048 bits
+// for RSA, and returns its certificate. Either the plain or the x509 key
+// algorithm may be given, the key returned is always an x509 key.
+func (p *PKCS11CryptoService) Create(role string, algorithm data.KeyAlgorithm) (data.PublicKey, error) {
+	switch algorithm {
+	case data.ECDSAx509Key:
+		algorithm = data.ECDSAKey
+	case data.RSAx509Key:
+		algorithm = data.RSAKey
+	}
+	return p.CreateWithSize(role, algorithm, defaultKeySize(algorithm))
+}
+
+// CreateWithSize generates a new key of the given size in bits in the
+// token. ECDSA keys may be 256 or 384 bits and RSA keys must be at least
+// 2048 bits.
+func (p *PKCS11CryptoService) CreateWithSize(role string, algorithm data.KeyAlgorithm, bits int) (data.PublicKey, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// the key ID depends on the public key, so the key is generated with
+	// a random ID and relabelled once the public key is known
+	tmpID := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, tmpID); err != nil {
+		return nil, err
+	}
+	common := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, role),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, tmpID),
+	}
+	private := append([]*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+	}, common...)
+	public := append([]*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+	}, common...)
+
+	var mechanism uint
+	switch algorithm {
+	case data.ECDSAKey:
+		var params []byte
+		switch bits {
+		case 256:
+			params = oidP256
+		case 384:
+			params = oidP384
+		default:
+			return nil, ErrInvalidKeyLength{msg: fmt.Sprintf("ECDSA keys must be 256 or 384 bits, not %d.", bits)}
+		}
+		mechanism = pkcs11.CKM_EC_KEY_PAIR_GEN
+		public = append(public, pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, params))
+	case data.RSAKey:
+		if bits < minRSAKeySizeBit {
+			return nil, ErrInvalidKeyLength{msg: fmt.Sprintf("RSA key must be at least %d bits.", minRSAKeySizeBit)}
+		}
+		mechanism = pkcs11.CKM_RSA_PKCS_KEY_PAIR_GEN
+		public = append(public,
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS_BITS, bits),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, []byte{1, 0, 1}),
+		)
+	default:
+		return nil, ErrUnsupportedKeyAlgorithm{Algorithm: algorithm}
+	}
+
+	pubHandle, privHandle, err := p.ctx.GenerateKeyPair(p.session,
+		[]*pkcs11.Mechanism{pkcs11.NewMechanism(mechanism, nil)}, public, private)
+	if err != nil {
+		return nil, err
+	}
+	key, err := p.newKey(role, algorithm, pubHandle, privHandle)
+	if err != nil {
+		p.ctx.DestroyObject(p.session, pubHandle)
+		p.ctx.DestroyObject(p.session, privHandle)
+		return nil, err
+	}
+	return key, nil
+}
+
+// newKey reads the public part of a newly generated key, sets the key's
+// ID and stores a self signed certificate for it in the token
+func (p *PKCS11CryptoService) newKey(role string, algorithm data.KeyAlgorithm, pubHandle, privHandle pkcs11.ObjectHandle) (data.PublicKey, error) {
+	pub, err := p.publicKey(algorithm, pubHandle)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	keyID := data.NewPublicKey(algorithm, der).ID()
+	id, err := hex.DecodeString(keyID)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range []pkcs11.ObjectHandle{pubHandle, privHandle} {
+		if err := p.ctx.SetAttributeValue(p.session, h, []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_ID, id)}); err != nil {
+			return nil, err
+		}
+	}
+
+	template, err := trustmanager.NewCertificate(role)
+	if err != nil {
+		return nil, err
+	}
+	template.SignatureAlgorithm = x509.ECDSAWithSHA256
+	if algorithm == data.RSAKey {
+		template.SignatureAlgorithm = x509.SHA256WithRSA
+	}
+	s := &pkcs11Signer{p: p, handle: privHandle, algorithm: algorithm, public: pub}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, pub, s)
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.ctx.CreateObject(p.session, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_CERTIFICATE),
+		pkcs11.NewAttribute(pkcs11.CKA_CERTIFICATE_TYPE, pkcs11.CKC_X_509),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, role),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, id),
+		pkcs11.NewAttribute(pkcs11.CKA_VALUE, cert),
+	})
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := x509.ParseCertificate(cert)
+	if err != nil {
+		return nil, err
+	}
+	return trustmanager.CertToKey(parsed), nil
+}
+
+// publicKey reads the public key object
+func (p *PKCS11CryptoService) publicKey(algorithm data.KeyAlgorithm, h pkcs11.ObjectHandle) (crypto.PublicKey, error) {
+	if algorithm == data.RSAKey {
+		attrs, err := p.ctx.GetAttributeValue(p.session, h, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(attrs[0].Value),
+			E: int(new(big.Int).SetBytes(attrs[1].Value).Int64()),
+		}, nil
+	}
+	attrs, err := p.ctx.GetAttributeValue(p.session, h, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var curve elliptic.Curve
+	switch string(attrs[0].Value) {
+	case string(oidP256):
+		curve = elliptic.P256()
+	case string(oidP384):
+		curve = elliptic.P384()
+	default:
+		return nil, errors.New("unsupported curve in PKCS#11 token")
+	}
+	// CKA_EC_POINT is the DER encoding of an OCTET STRING holding the point
+	var point []byte
+	if _, err := asn1.Unmarshal(attrs[1].Value, &point); err != nil {
+		return nil, err
+	}
+	x, y := elliptic.Unmarshal(curve, point)
+	if x == nil {
+		return nil, errors.New("invalid EC point in PKCS#11 token")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// RemoveKey deletes the private key, public key and certificate with the
+// given canonical key ID from the token
+func (p *PKCS11CryptoService) RemoveKey(keyID string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	id, err := hex.DecodeString(keyID)
+	if err != nil {
+		return err
+	}
+	handles, err := p.find(pkcs11.NewAttribute(pkcs11.CKA_ID, id))
+	if err != nil {
+		return err
+	}
+	for _, h := range handles {
+		if err := p.ctx.DestroyObject(p.session, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetKey returns the certificate for the key with the given canonical key
+// ID, or nil if the token does not hold it
+func (p *PKCS11CryptoService) GetKey(keyID string) data.PublicKey {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	id, err := hex.DecodeString(keyID)
+	if err != nil {
+		return nil
+	}
+	cert, _, err := p.certificate(id)
+	if err != nil {
+		return nil
+	}
+	return trustmanager.CertToKey(cert)
+}
+
+// PublicKeys returns a map of certificates for the canonical key ids
+// provided, when those IDs are found in the token
+func (p *PKCS11CryptoService) PublicKeys(keyIDs ...string) (map[string]data.PublicKey, error) {
+	pubs := make(map[string]data.PublicKey)
+	for _, keyID := range keyIDs {
+		if k := p.GetKey(keyID); k != nil {
+			pubs[keyID] = k
+		}
+	}
+	return pubs, nil
+}
+
+// ListKeys returns the role each key in the token was created for, keyed
+// by canonical key ID
+func (p *PKCS11CryptoService) ListKeys() (map[string]string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	handles, err := p.find(pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_CERTIFICATE))
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]string)
+	for _, h := range handles {
+		attrs, err := p.ctx.GetAttributeValue(p.session, h, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_ID, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, nil),
+		})
+		if err != nil {
+			return nil, err
+		}
+		keys[hex.EncodeToString(attrs[0].Value)] = string(attrs[1].Value)
+	}
+	return keys, nil
+}
+
+// Sign generates a signature over the data with each of the keys, given by
+// canonical key ID, the token holds. ECDSA signatures are raw r||s and RSA
+// signatures use RSASSA-PSS, both over sha256, as the verifiers expect.
+func (p *PKCS11CryptoService) Sign(keyIDs []string, toSign []byte) ([]data.Signature, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	signatures := make([]data.Signature, 0, len(keyIDs))
+	for _, keyID := range keyIDs {
+		id, err := hex.DecodeString(keyID)
+		if err != nil {
+			continue
+		}
+		handles, err := p.find(
+			pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+			pkcs11.NewAttribute(pkcs11.CKA_ID, id),
+		)
+		if err != nil {
+			return nil, err
+		}
+		if len(handles) == 0 {
+			// another party may hold this key
+			continue
+		}
+		attrs, err := p.ctx.GetAttributeValue(p.session, handles[0], []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, nil),
+		})
+		if err != nil {
+			return nil, err
+		}
+		keyType, err := ulongValue(attrs[0].Value)
+		if err != nil {
+			return nil, err
+		}
+		var sig []byte
+		var method data.SigAlgorithm
+		switch keyType {
+		case pkcs11.CKK_EC:
+			digest := sha256.Sum256(toSign)
+			sig, err = p.sign(handles[0], pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil), digest[:])
+			method = data.ECDSASignature
+		case pkcs11.CKK_RSA:
+			params := pkcs11.NewPSSParams(pkcs11.CKM_SHA256, pkcs11.CKG_MGF1_SHA256, sha256.Size)
+			sig, err = p.sign(handles[0], pkcs11.NewMechanism(pkcs11.CKM_SHA256_RSA_PKCS_PSS, params), toSign)
+			method = data.RSAPSSSignature
+		default:
+			return nil, errors.New("unsupported key type in PKCS#11 token")
+		}
+		if err != nil {
+			return nil, err
+		}
+		signatures = append(signatures, data.Signature{KeyID: keyID, Method: method, Signature: sig})
+	}
+	return signatures, nil
+}
+
+// sign signs msg with the private key object using mechanism. The caller
+// must hold the mutex.
+func (p *PKCS11CryptoService) sign(h pkcs11.ObjectHandle, mechanism *pkcs11.Mechanism, msg []byte) ([]byte, error) {
+	if err := p.ctx.SignInit(p.session, []*pkcs11.Mechanism{mechanism}, h); err != nil {
+		return nil, err
+	}
+	return p.ctx.Sign(p.session, msg)
+}
+
+// find returns every object matching the template. The caller must hold
+// the mutex.
+func (p *PKCS11CryptoService) find(template ...*pkcs11.Attribute) ([]pkcs11.ObjectHandle, error) {
+	if err := p.ctx.FindObjectsInit(p.session, template); err != nil {
+		return nil, err
+	}
+	defer p.ctx.FindObjectsFinal(p.session)
+	var handles []pkcs11.ObjectHandle
+	for {
+		found, _, err := p.ctx.FindObjects(p.session, 16)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) == 0 {
+			return handles, nil
+		}
+		handles = append(handles, found...)
+	}
+}
+
+// certificate returns the certificate stored with the given CKA_ID. The
+// caller must hold the mutex.
+func (p *PKCS11CryptoService) certificate(id []byte) (*x509.Certificate, pkcs11.ObjectHandle, error) {
+	handles, err := p.find(
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_CERTIFICATE),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, id),
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(handles) == 0 {
+		return nil, 0, errors.New("certificate not found")
+	}
+	attrs, err := p.ctx.GetAttributeValue(p.session, handles[0], []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_VALUE, nil),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	cert, err := x509.ParseCertificate(attrs[0].Value)
+	return cert, handles[0], err
+}
+
+// pkcs11Signer is a crypto.Signer for a private key in the token, used to
+// self sign the key's certificate. The service's mutex must be held while
+// it is used.
+type pkcs11Signer struct {
+	p         *PKCS11CryptoService
+	handle    pkcs11.ObjectHandle
+	algorithm data.KeyAlgorithm
+	public    crypto.PublicKey
+}
+
+func (s *pkcs11Signer) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign signs the sha256 digest, returning an ASN.1 encoded signature for
+// ECDSA keys and a PKCS#1 v1.5 signature for RSA keys, as x509 requires
+func (s *pkcs11Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 {
+		return nil, errors.New("only sha256 certificate signatures are supported")
+	}
+	if s.algorithm == data.RSAKey {
+		msg := append(append([]byte{}, sha256DigestInfo...), digest...)
+		return s.p.sign(s.handle, pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil), msg)
+	}
+	raw, err := s.p.sign(s.handle, pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil), digest)
+	if err != nil {
+		return nil, err
+	}
+	half := len(raw) / 2
+	return asn1.Marshal(struct{ R, S *big.Int }{
+		new(big.Int).SetBytes(raw[:half]),
+		new(big.Int).SetBytes(raw[half:]),
+	})
+}
+
+func isPKCS11Error(err error, code uint) bool {
+	e, ok := err.(pkcs11.Error)
+	return ok && uint(e) == code
+}
+
+// ulongValue decodes a CK_ULONG attribute value, which is in the
+// platform's native byte order and size
+func ulongValue(b []byte) (uint64, error) {
+	switch len(b) {
+	case 4:
+		return uint64(nativeEndian.Uint32(b)), nil
+	case 8:
+		return nativeEndian.Uint64(b), nil
+	}
+	return 0, fmt.Errorf("invalid CK_ULONG attribute of %d bytes", len(b))
+}
+
+// nativeEndian is the platform's byte order, found by looking at the first
+// byte of a known uint16
+var nativeEndian = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
@@ -0,0 +1,96 @@
+//go:build pkcs11
+// +build pkcs11
+
+package signed
+
+import (
+	"os"
+	"testing"
+
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// These tests run against a PKCS#11 module given by the environment, e.g.
+// with SoftHSM:
+//
+//	softhsm2-util --init-token --free --label gotuf --pin 1234 --so-pin 1234
+//	GOTUF_PKCS11_MODULE=/usr/lib/softhsm/libsofthsm2.so \
+//	GOTUF_PKCS11_TOKEN=gotuf GOTUF_PKCS11_PIN=1234 \
+//	go test -tags pkcs11 ./signed/
+func pkcs11Service(t *testing.T) *PKCS11CryptoService {
+	config := PKCS11Config{
+		Module:     os.Getenv("GOTUF_PKCS11_MODULE"),
+		TokenLabel: os.Getenv("GOTUF_PKCS11_TOKEN"),
+		PIN:        os.Getenv("GOTUF_PKCS11_PIN"),
+	}
+	if config.Module == "" {
+		t.Skip("GOTUF_PKCS11_MODULE not set")
+	}
+	service, err := NewPKCS11CryptoService(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service
+}
+
+func TestPKCS11CryptoServiceSign(t *testing.T) {
+	service := pkcs11Service(t)
+	defer service.Close()
+
+	msg := []byte("test data")
+	for _, test := range []struct {
+		algorithm data.KeyAlgorithm
+		bits      int
+		keyType   data.KeyAlgorithm
+		method    data.SigAlgorithm
+	}{
+		{data.ECDSAKey, 256, data.ECDSAx509Key, data.ECDSASignature},
+		{data.ECDSAKey, 384, data.ECDSAx509Key, data.ECDSASignature},
+		{data.RSAKey, 2048, data.RSAx509Key, data.RSAPSSSignature},
+	} {
+		pub, err := service.CreateWithSize("root", test.algorithm, test.bits)
+		assert.NoError(t, err)
+		assert.Equal(t, test.keyType, pub.Algorithm())
+		keyID, err := utils.CanonicalKeyID(pub)
+		assert.NoError(t, err)
+		assert.NotNil(t, service.GetKey(keyID))
+
+		keys, err := service.ListKeys()
+		assert.NoError(t, err)
+		assert.Equal(t, "root", keys[keyID])
+
+		sigs, err := service.Sign([]string{keyID, "unknown"}, msg)
+		assert.NoError(t, err)
+		assert.Len(t, sigs, 1)
+		assert.Equal(t, keyID, sigs[0].KeyID)
+		assert.Equal(t, test.method, sigs[0].Method)
+		assert.NoError(t, Verifiers[sigs[0].Method].Verify(pub, sigs[0].Signature, msg), string(test.algorithm))
+		assert.Error(t, Verifiers[sigs[0].Method].Verify(pub, sigs[0].Signature, []byte("other data")))
+
+		assert.NoError(t, service.RemoveKey(keyID))
+		assert.Nil(t, service.GetKey(keyID))
+		sigs, err = service.Sign([]string{keyID}, msg)
+		assert.NoError(t, err)
+		assert.Len(t, sigs, 0)
+	}
+}
+
+func TestPKCS11CryptoServiceCreateX509(t *testing.T) {
+	service := pkcs11Service(t)
+	defer service.Close()
+
+	pub, err := service.Create("targets", data.ECDSAx509Key)
+	assert.NoError(t, err)
+	assert.Equal(t, data.ECDSAx509Key, pub.Algorithm())
+	keyID, err := utils.CanonicalKeyID(pub)
+	assert.NoError(t, err)
+	assert.NoError(t, service.RemoveKey(keyID))
+	assert.Error(t, service.RemoveKey("not a key id"))
+
+	_, err = service.Create("targets", data.ED25519Key)
+	assert.IsType(t, ErrUnsupportedKeyAlgorithm{}, err)
+	_, err = service.CreateWithSize("targets", data.RSAKey, 1024)
+	assert.IsType(t, ErrInvalidKeyLength{}, err)
+}
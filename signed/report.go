@@ -0,0 +1,99 @@
+package signed
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/endophage/gotuf/data"
+)
+
+// SignatureOutcome is the result of verifying a single signature
+type SignatureOutcome string
+
+// The outcomes of verifying a signature. Only a SignatureValid signature
+// counts towards the threshold.
+const (
+	SignatureValid SignatureOutcome = "valid"
+	// SignatureKeyNotInRole - the key is not one of the role's keys
+	SignatureKeyNotInRole SignatureOutcome = "key not in role"
+	// SignatureUnknownKey - the key is one of the role's but is not known
+	SignatureUnknownKey SignatureOutcome = "unknown key"
+	// SignatureUnsupportedMethod - no Verifier is registered for the method
+	SignatureUnsupportedMethod SignatureOutcome = "unsupported method"
+	// SignatureKeyTypeMismatch - the key cannot produce signatures of the
+	// method
+	SignatureKeyTypeMismatch SignatureOutcome = "key type mismatch"
+	// SignatureUnsupportedKey - the key's length is not supported
+	SignatureUnsupportedKey SignatureOutcome = "unsupported key"
+	// SignatureInvalid - the signature does not match the signed data
+	SignatureInvalid SignatureOutcome = "invalid signature"
+	// SignatureDuplicate - the key already produced a valid signature
+	SignatureDuplicate SignatureOutcome = "duplicate"
+)
+
+// SignatureResult describes the verification of one signature
+type SignatureResult struct {
+	KeyID   string
+	Method  data.SigAlgorithm
+	Outcome SignatureOutcome
+	// Err is the Verifier's error, if it rejected the signature
+	Err error
+}
+
+// VerificationReport describes the verification of every signature on a
+// piece of signed metadata, in the order the signatures appear, and how
+// many valid signatures were found against the role's threshold
+type VerificationReport struct {
+	Role       string
+	Threshold  int
+	Valid      int
+	Signatures []SignatureResult
+}
+
+// Met indicates whether enough valid signatures were found to meet the
+// threshold
+func (r *VerificationReport) Met() bool {
+	return r.Threshold > 0 && r.Valid >= r.Threshold
+}
+
+func (r *VerificationReport) String() string {
+	results := make([]string, 0, len(r.Signatures))
+	for _, sig := range r.Signatures {
+		results = append(results, fmt.Sprintf("%s: %s", sig.KeyID, sig.Outcome))
+	}
+	return fmt.Sprintf("%s has %d of %d required valid signatures [%s]",
+		r.Role, r.Valid, r.Threshold, strings.Join(results, ", "))
+}
+
+// add records the result and counts it if valid
+func (r *VerificationReport) add(result SignatureResult) {
+	logrus.Debugf("signature by %s for %s: %s", result.KeyID, r.Role, result.Outcome)
+	if result.Outcome == SignatureValid {
+		r.Valid++
+	}
+	r.Signatures = append(r.Signatures, result)
+}
+
+// verifySignature checks a signature by the key over msg
+func verifySignature(sig data.Signature, key data.PublicKey, msg []byte) SignatureResult {
+	result := SignatureResult{KeyID: sig.KeyID, Method: sig.Method}
+	// method lookup is consistent due to Unmarshal JSON doing lower case for us.
+	verifier, ok := Verifiers[sig.Method]
+	if !ok {
+		result.Outcome = SignatureUnsupportedMethod
+		return result
+	}
+	result.Err = verifier.Verify(key, sig.Signature, msg)
+	switch result.Err.(type) {
+	case nil:
+		result.Outcome = SignatureValid
+	case ErrInvalidKeyType:
+		result.Outcome = SignatureKeyTypeMismatch
+	case ErrInvalidKeyLength:
+		result.Outcome = SignatureUnsupportedKey
+	default:
+		result.Outcome = SignatureInvalid
+	}
+	return result
+}
@@ -42,7 +42,6 @@ func Sign(service CryptoService, s *data.Signed, keys ...data.PublicKey) error {
 		if err != nil {
 			continue
 		}
-		keyIDMemb[key.ID()] = struct{}{}
 		keyIDs = append(keyIDs, idPair{
 			scopedKeyID:    key.ID(),
 			canonicalKeyID: keyID,
@@ -65,6 +64,7 @@ func Sign(service CryptoService, s *data.Signed, keys ...data.PublicKey) error {
 			newSig := newSigs[0]
 			newSig.KeyID = pair.scopedKeyID
 			signatures = append(signatures, newSig)
+			keyIDMemb[pair.scopedKeyID] = struct{}{}
 		}
 	}
 	if len(signatures) < 1 {
@@ -73,6 +73,8 @@ func Sign(service CryptoService, s *data.Signed, keys ...data.PublicKey) error {
 			Err:  nil,
 		}
 	}
+	// only replace existing signatures by keys that signed again, so
+	// signatures by keys this service doesn't hold are kept
 	for _, sig := range s.Signatures {
 		if _, ok := keyIDMemb[sig.KeyID]; ok {
 			continue
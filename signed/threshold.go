@@ -0,0 +1,121 @@
+package signed
+
+// Threshold signing allows the keys for a role to be held by several
+// parties, each with their own CryptoService. One party exports the
+// (unsigned or partially signed) data.Signed, e.g. from ToSigned on the
+// appropriate Signed* type, each party adds their signatures with Sign,
+// and the resulting signature sets are combined with MergeSignatures.
+// CheckThreshold reports progress towards the role's threshold.
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/keys"
+)
+
+// ThresholdStatus describes how many valid signatures a piece of signed
+// metadata has relative to the threshold of the role that must sign it
+type ThresholdStatus struct {
+	Role      string
+	Threshold int
+	// ValidKeyIDs are the IDs of the role's keys that produced a valid
+	// signature, in sorted order
+	ValidKeyIDs []string
+	// MissingKeyIDs are the IDs of the role's keys that have not yet
+	// produced a valid signature, in sorted order
+	MissingKeyIDs []string
+}
+
+// Valid returns the number of valid signatures
+func (ts ThresholdStatus) Valid() int {
+	return len(ts.ValidKeyIDs)
+}
+
+// Met indicates whether enough valid signatures exist to meet the threshold
+func (ts ThresholdStatus) Met() bool {
+	return ts.Threshold > 0 && ts.Valid() >= ts.Threshold
+}
+
+// CheckThreshold counts the valid signatures on s for the given role, as
+// known to the db. Unlike VerifySignatures it does not fail when the
+// threshold is not met, it only returns an error if the role is unknown or
+// the signed data cannot be parsed.
+func CheckThreshold(s *data.Signed, role string, db *keys.KeyDB) (*ThresholdStatus, error) {
+	report, err := CheckSignatures(s, role, db)
+	if err != nil {
+		return nil, err
+	}
+	valid := make(map[string]struct{})
+	for _, sig := range report.Signatures {
+		if sig.Outcome == SignatureValid {
+			valid[sig.KeyID] = struct{}{}
+		}
+	}
+	roleData := db.GetRole(role)
+	status := &ThresholdStatus{
+		Role:          role,
+		Threshold:     roleData.Threshold,
+		ValidKeyIDs:   make([]string, 0, len(valid)),
+		MissingKeyIDs: make([]string, 0, len(roleData.KeyIDs)),
+	}
+	for _, keyID := range roleData.KeyIDs {
+		if _, ok := valid[keyID]; ok {
+			status.ValidKeyIDs = append(status.ValidKeyIDs, keyID)
+		} else {
+			status.MissingKeyIDs = append(status.MissingKeyIDs, keyID)
+		}
+	}
+	sort.Strings(status.ValidKeyIDs)
+	sort.Strings(status.MissingKeyIDs)
+	return status, nil
+}
+
+// MergeSignatures adds the signatures from each of the others to s. All
+// of them must carry the same signed data as s. Where more than one
+// signature exists for a key ID, the first that verifies with the key in
+// the db is kept, so a stale or corrupt signature cannot displace a valid
+// one. If none of them verify, the one already on s (or the earliest of
+// the others) is kept.
+func MergeSignatures(s *data.Signed, db *keys.KeyDB, others ...*data.Signed) error {
+	msg, err := canonicalSigned(s)
+	if err != nil {
+		return err
+	}
+	valid := func(sig data.Signature) bool {
+		key := db.GetKey(sig.KeyID)
+		return key != nil && verifySignature(sig, key, msg).Outcome == SignatureValid
+	}
+	// kept maps each key ID to the index of its signature in signatures
+	kept := make(map[string]int)
+	signatures := make([]data.Signature, 0, len(s.Signatures))
+	add := func(sig data.Signature) {
+		i, ok := kept[sig.KeyID]
+		if !ok {
+			kept[sig.KeyID] = len(signatures)
+			signatures = append(signatures, sig)
+			return
+		}
+		if !valid(signatures[i]) && valid(sig) {
+			signatures[i] = sig
+		}
+	}
+	for _, sig := range s.Signatures {
+		add(sig)
+	}
+	for _, o := range others {
+		otherMsg, err := canonicalSigned(o)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(msg, otherMsg) {
+			return ErrSignedMismatch
+		}
+		for _, sig := range o.Signatures {
+			add(sig)
+		}
+	}
+	s.Signatures = signatures
+	return nil
+}
@@ -0,0 +1,167 @@
+package signed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/keys"
+)
+
+func TestThresholdSigning(t *testing.T) {
+	// each party holds exactly one of the root keys
+	parties := []*Ed25519{NewEd25519(), NewEd25519(), NewEd25519()}
+	db := keys.NewDB()
+	var pubKeys []data.PublicKey
+	var keyIDs []string
+	for _, p := range parties {
+		k, err := p.Create("root", data.ED25519Key)
+		assert.NoError(t, err)
+		db.AddKey(k)
+		pubKeys = append(pubKeys, k)
+		keyIDs = append(keyIDs, k.ID())
+	}
+	role, err := data.NewRole("root", 2, keyIDs, nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, db.AddRole(role))
+
+	root, err := data.NewRoot(nil, map[string]*data.RootRole{"root": &role.RootRole}, false)
+	assert.NoError(t, err)
+	unsigned, err := root.ToSigned()
+	assert.NoError(t, err)
+
+	status, err := CheckThreshold(unsigned, "root", db)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, status.Valid())
+	assert.Equal(t, 2, status.Threshold)
+	assert.False(t, status.Met())
+
+	// each party signs their own copy, offering all the role's keys
+	partials := make([]*data.Signed, 0, len(parties))
+	for _, p := range parties[:2] {
+		s, err := root.ToSigned()
+		assert.NoError(t, err)
+		assert.NoError(t, Sign(p, s, pubKeys...))
+		assert.Len(t, s.Signatures, 1)
+		partials = append(partials, s)
+	}
+
+	status, err = CheckThreshold(partials[0], "root", db)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{keyIDs[0]}, status.ValidKeyIDs)
+	assert.Len(t, status.MissingKeyIDs, 2)
+	assert.False(t, status.Met())
+	assert.IsType(t, ErrRoleThreshold{}, VerifySignatures(partials[0], "root", db))
+
+	err = MergeSignatures(unsigned, db, partials...)
+	assert.NoError(t, err)
+	// merging the same signatures again must not duplicate them
+	err = MergeSignatures(unsigned, db, partials...)
+	assert.NoError(t, err)
+	assert.Len(t, unsigned.Signatures, 2)
+
+	status, err = CheckThreshold(unsigned, "root", db)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, status.Valid())
+	assert.True(t, status.Met())
+	assert.NoError(t, VerifySignatures(unsigned, "root", db))
+}
+
+func TestMergeSignaturesInvalid(t *testing.T) {
+	cs := NewEd25519()
+	k, err := cs.Create("root", data.ED25519Key)
+	assert.NoError(t, err)
+	db := keys.NewDB()
+	db.AddKey(k)
+	role, err := data.NewRole("root", 1, []string{k.ID()}, nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, db.AddRole(role))
+
+	root, err := data.NewRoot(nil, map[string]*data.RootRole{"root": &role.RootRole}, false)
+	assert.NoError(t, err)
+	good, err := root.ToSigned()
+	assert.NoError(t, err)
+	assert.NoError(t, Sign(cs, good, k))
+
+	// a corrupt signature by the same key is already present
+	s, err := root.ToSigned()
+	assert.NoError(t, err)
+	corrupt := good.Signatures[0]
+	corrupt.Signature = make([]byte, len(corrupt.Signature))
+	s.Signatures = []data.Signature{corrupt}
+
+	assert.NoError(t, MergeSignatures(s, db, good))
+	assert.Equal(t, good.Signatures, s.Signatures)
+	assert.NoError(t, VerifySignatures(s, "root", db))
+
+	// and a valid signature is never displaced by a corrupt one
+	other, err := root.ToSigned()
+	assert.NoError(t, err)
+	other.Signatures = []data.Signature{corrupt}
+	assert.NoError(t, MergeSignatures(s, db, other))
+	assert.Equal(t, good.Signatures, s.Signatures)
+}
+
+func TestMergeSignaturesMismatch(t *testing.T) {
+	cs := NewEd25519()
+	k, err := cs.Create("root", data.ED25519Key)
+	assert.NoError(t, err)
+
+	root, err := data.NewRoot(nil, nil, false)
+	assert.NoError(t, err)
+	s, err := root.ToSigned()
+	assert.NoError(t, err)
+
+	root.Signed.Version++
+	other, err := root.ToSigned()
+	assert.NoError(t, err)
+	assert.NoError(t, Sign(cs, other, k))
+
+	err = MergeSignatures(s, keys.NewDB(), other)
+	assert.Equal(t, ErrSignedMismatch, err)
+	assert.Len(t, s.Signatures, 0)
+}
+
+func TestCheckThresholdUnknownRole(t *testing.T) {
+	root, err := data.NewRoot(nil, nil, false)
+	assert.NoError(t, err)
+	s, err := root.ToSigned()
+	assert.NoError(t, err)
+	_, err = CheckThreshold(s, "root", keys.NewDB())
+	assert.Equal(t, ErrUnknownRole, err)
+}
+
+func TestThresholdSigningInSequence(t *testing.T) {
+	parties := []*Ed25519{NewEd25519(), NewEd25519()}
+	db := keys.NewDB()
+	var pubKeys []data.PublicKey
+	var keyIDs []string
+	for _, p := range parties {
+		k, err := p.Create("root", data.ED25519Key)
+		assert.NoError(t, err)
+		db.AddKey(k)
+		pubKeys = append(pubKeys, k)
+		keyIDs = append(keyIDs, k.ID())
+	}
+	role, err := data.NewRole("root", 2, keyIDs, nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, db.AddRole(role))
+
+	root, err := data.NewRoot(nil, map[string]*data.RootRole{"root": &role.RootRole}, false)
+	assert.NoError(t, err)
+	s, err := root.ToSigned()
+	assert.NoError(t, err)
+
+	// both parties sign the same object, offering all the role's keys
+	for _, p := range parties {
+		assert.NoError(t, Sign(p, s, pubKeys...))
+	}
+	assert.Len(t, s.Signatures, 2)
+
+	status, err := CheckThreshold(s, "root", db)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, status.Valid())
+	assert.True(t, status.Met())
+	assert.NoError(t, VerifySignatures(s, "root", db))
+}
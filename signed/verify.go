@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/endophage/gotuf/clock"
 	"github.com/endophage/gotuf/data"
 	"github.com/endophage/gotuf/keys"
 	"github.com/jfrazelle/go/canonical/json"
@@ -19,11 +20,20 @@ var (
 	ErrWrongMethod  = errors.New("tuf: invalid signature type")
 	ErrUnknownRole  = errors.New("tuf: unknown role")
 	ErrWrongType    = errors.New("tuf: meta file has wrong type")
+	// ErrSignedMismatch indicates signatures over different data were
+	// being merged
+	ErrSignedMismatch = errors.New("tuf: signed data does not match")
 )
 
 // VerifyRoot checks if a given root file is valid against a known set of keys.
 // Threshold is always assumed to be 1
 func VerifyRoot(s *data.Signed, minVersion int, keys map[string]data.PublicKey) error {
+	return VerifyRootWithExpiry(s, minVersion, keys, ExpiryChecker{})
+}
+
+// VerifyRootWithExpiry is VerifyRoot with expiry decided by the
+// ExpiryChecker, as VerifyWithExpiry is to Verify
+func VerifyRootWithExpiry(s *data.Signed, minVersion int, keys map[string]data.PublicKey, expiry ExpiryChecker) error {
 	if len(s.Signatures) == 0 {
 		return ErrNoSignatures
 	}
@@ -37,41 +47,61 @@ func VerifyRoot(s *data.Signed, minVersion int, keys map[string]data.PublicKey)
 		return err
 	}
 
+	report := &VerificationReport{Role: "root", Threshold: 1}
 	for _, sig := range s.Signatures {
-		// method lookup is consistent due to Unmarshal JSON doing lower case for us.
-		method := sig.Method
-		verifier, ok := Verifiers[method]
-		if !ok {
-			logrus.Debugf("continuing b/c signing method is not supported for verify root: %s\n", sig.Method)
-			continue
-		}
-
 		key, ok := keys[sig.KeyID]
 		if !ok {
-			logrus.Debugf("continuing b/c signing key isn't present in keys: %s\n", sig.KeyID)
+			report.add(SignatureResult{KeyID: sig.KeyID, Method: sig.Method, Outcome: SignatureUnknownKey})
 			continue
 		}
-
-		if err := verifier.Verify(key, sig.Signature, msg); err != nil {
-			logrus.Debugf("continuing b/c signature was invalid\n")
-			continue
+		report.add(verifySignature(sig, key, msg))
+		if report.Met() {
+			// threshold of 1 so return on first success
+			return verifyMeta(s, "root", minVersion, expiry)
 		}
-		// threshold of 1 so return on first success
-		return verifyMeta(s, "root", minVersion)
 	}
-	return ErrRoleThreshold{}
+	return ErrRoleThreshold{Report: report}
+}
+
+// ExpiryChecker decides whether metadata has expired by the time of its
+// Clock, or of the system clock if Clock is nil. Skew tolerates a clock
+// known to be wrong within bounds: metadata is only considered expired
+// once its expiry is more than Skew before the clock's time.
+type ExpiryChecker struct {
+	Clock clock.Clock
+	Skew  time.Duration
+}
+
+// Now returns the time by the checker's clock
+func (e ExpiryChecker) Now() time.Time {
+	if e.Clock == nil {
+		return clock.System.Now()
+	}
+	return e.Clock.Now()
+}
+
+// IsExpired checks if the given time, allowing for the skew, passed
+// before the checker's time
+func (e ExpiryChecker) IsExpired(t time.Time) bool {
+	return t.Add(e.Skew).Before(e.Now())
 }
 
 // Verify checks the signatures and metadata (expiry, version) for the signed role
 // data
 func Verify(s *data.Signed, role string, minVersion int, db *keys.KeyDB) error {
+	return VerifyWithExpiry(s, role, minVersion, db, ExpiryChecker{})
+}
+
+// VerifyWithExpiry is Verify with expiry decided by the ExpiryChecker,
+// for example to verify metadata as of a time in the past
+func VerifyWithExpiry(s *data.Signed, role string, minVersion int, db *keys.KeyDB, expiry ExpiryChecker) error {
 	if err := VerifySignatures(s, role, db); err != nil {
 		return err
 	}
-	return verifyMeta(s, role, minVersion)
+	return verifyMeta(s, role, minVersion, expiry)
 }
 
-func verifyMeta(s *data.Signed, role string, minVersion int) error {
+func verifyMeta(s *data.Signed, role string, minVersion int, expiry ExpiryChecker) error {
 	sm := &data.SignedCommon{}
 	if err := json.Unmarshal(s.Signed, sm); err != nil {
 		return err
@@ -79,7 +109,7 @@ func verifyMeta(s *data.Signed, role string, minVersion int) error {
 	if !data.ValidTUFType(sm.Type, role) {
 		return ErrWrongType
 	}
-	if IsExpired(sm.Expires) {
+	if expiry.IsExpired(sm.Expires) {
 		logrus.Errorf("Metadata for %s expired", role)
 		return ErrExpired{Role: role, Expired: sm.Expires.Format("Mon Jan 2 15:04:05 MST 2006")}
 	}
@@ -92,66 +122,79 @@ func verifyMeta(s *data.Signed, role string, minVersion int) error {
 
 // IsExpired checks if the given time passed before the present time
 func IsExpired(t time.Time) bool {
-	return t.Before(time.Now())
+	return ExpiryChecker{}.IsExpired(t)
 }
 
-// VerifySignatures checks the we have sufficient valid signatures for the given role
+// VerifySignatures checks the we have sufficient valid signatures for the given role.
+// If not, the ErrRoleThreshold returned carries a VerificationReport
+// describing why each signature was rejected.
 func VerifySignatures(s *data.Signed, role string, db *keys.KeyDB) error {
 	if len(s.Signatures) == 0 {
 		return ErrNoSignatures
 	}
+	report, err := CheckSignatures(s, role, db)
+	if err != nil {
+		return err
+	}
+	if !report.Met() {
+		return ErrRoleThreshold{Report: report}
+	}
+	return nil
+}
 
+// CheckSignatures verifies each signature on s for the given role, as known
+// to the db, and reports the outcomes. Unlike VerifySignatures it does not
+// fail when the threshold is not met, it only returns an error if the role
+// is unknown or the signed data cannot be parsed.
+func CheckSignatures(s *data.Signed, role string, db *keys.KeyDB) (*VerificationReport, error) {
 	roleData := db.GetRole(role)
 	if roleData == nil {
-		return ErrUnknownRole
+		return nil, ErrUnknownRole
 	}
+	logrus.Debugf("%s role has key IDs: %s", roleData.Name, strings.Join(roleData.KeyIDs, ","))
 
-	if roleData.Threshold < 1 {
-		return ErrRoleThreshold{}
-	}
-	logrus.Debugf("%s role has key IDs: %s", role, strings.Join(roleData.KeyIDs, ","))
-
-	var decoded map[string]interface{}
-	if err := json.Unmarshal(s.Signed, &decoded); err != nil {
-		return err
-	}
-	msg, err := json.MarshalCanonical(decoded)
+	msg, err := canonicalSigned(s)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	report := &VerificationReport{
+		Role:       role,
+		Threshold:  roleData.Threshold,
+		Signatures: make([]SignatureResult, 0, len(s.Signatures)),
+	}
 	valid := make(map[string]struct{})
 	for _, sig := range s.Signatures {
-		logrus.Debug("verifying signature for key ID: ", sig.KeyID)
 		if !roleData.ValidKey(sig.KeyID) {
-			logrus.Debugf("continuing b/c keyid was invalid: %s for roledata %s\n", sig.KeyID, roleData)
+			report.add(SignatureResult{KeyID: sig.KeyID, Method: sig.Method, Outcome: SignatureKeyNotInRole})
 			continue
 		}
-		key := db.GetKey(sig.KeyID)
-		if key == nil {
-			logrus.Debugf("continuing b/c keyid lookup was nil: %s\n", sig.KeyID)
+		if _, ok := valid[sig.KeyID]; ok {
+			report.add(SignatureResult{KeyID: sig.KeyID, Method: sig.Method, Outcome: SignatureDuplicate})
 			continue
 		}
-		// method lookup is consistent due to Unmarshal JSON doing lower case for us.
-		method := sig.Method
-		verifier, ok := Verifiers[method]
-		if !ok {
-			logrus.Debugf("continuing b/c signing method is not supported: %s\n", sig.Method)
+		key := db.GetKey(sig.KeyID)
+		if key == nil {
+			report.add(SignatureResult{KeyID: sig.KeyID, Method: sig.Method, Outcome: SignatureUnknownKey})
 			continue
 		}
-
-		if err := verifier.Verify(key, sig.Signature, msg); err != nil {
-			logrus.Debugf("continuing b/c signature was invalid\n")
-			continue
+		result := verifySignature(sig, key, msg)
+		if result.Outcome == SignatureValid {
+			valid[sig.KeyID] = struct{}{}
 		}
-		valid[sig.KeyID] = struct{}{}
-
-	}
-	if len(valid) < roleData.Threshold {
-		return ErrRoleThreshold{}
+		report.add(result)
 	}
+	return report, nil
+}
 
-	return nil
+// canonicalSigned returns the canonical JSON encoding of the signed
+// portion of s, which is the message signatures are generated over.
+func canonicalSigned(s *data.Signed) ([]byte, error) {
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(s.Signed, &decoded); err != nil {
+		return nil, err
+	}
+	return json.MarshalCanonical(decoded)
 }
 
 // Unmarshal unmarshals and verifys the raw bytes for a given role's metadata
@@ -6,6 +6,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/endophage/gotuf/clock"
 	"github.com/endophage/gotuf/data"
 	"github.com/endophage/gotuf/keys"
 	"github.com/jfrazelle/go/canonical/json"
@@ -187,12 +188,23 @@ func Test(t *testing.T) {
 		err := Verify(run.s, run.role, minVer, db)
 		if e, ok := run.err.(ErrExpired); ok {
 			assertErrExpired(t, err, e)
+		} else if _, ok := run.err.(ErrRoleThreshold); ok {
+			assertErrRoleThreshold(t, err)
 		} else {
 			assert.Equal(t, run.err, err)
 		}
 	}
 }
 
+func assertErrRoleThreshold(t *testing.T, err error) {
+	actual, ok := err.(ErrRoleThreshold)
+	if !ok {
+		t.Fatalf("expected err to have type ErrRoleThreshold, got %T", err)
+	}
+	assert.False(t, actual.Report.Met())
+	assert.True(t, actual.Report.Valid < actual.Report.Threshold || actual.Report.Threshold < 1)
+}
+
 func assertErrExpired(t *testing.T, err error, expected ErrExpired) {
 	actual, ok := err.(ErrExpired)
 	if !ok {
@@ -200,3 +212,111 @@ func assertErrExpired(t *testing.T, err error, expected ErrExpired) {
 	}
 	assert.Equal(t, actual.Expired, expected.Expired)
 }
+
+func TestVerifyWithExpiry(t *testing.T) {
+	cryptoService := NewEd25519()
+	k, err := cryptoService.Create("root", data.ED25519Key)
+	assert.NoError(t, err)
+	expires := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	b, err := json.MarshalCanonical(&data.SignedCommon{Type: data.TUFTypes["root"], Version: 1, Expires: expires})
+	assert.NoError(t, err)
+	s := &data.Signed{Signed: b}
+	assert.NoError(t, Sign(cryptoService, s, k))
+	db := keys.NewDB()
+	db.AddKey(k)
+	role, err := data.NewRole("root", 1, []string{k.ID()}, nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, db.AddRole(role))
+
+	// by the system clock the metadata has long expired
+	assert.IsType(t, ErrExpired{}, Verify(s, "root", 1, db))
+
+	fake := clock.NewFake(expires.Add(-time.Hour))
+	assert.NoError(t, VerifyWithExpiry(s, "root", 1, db, ExpiryChecker{Clock: fake}))
+
+	fake.Advance(2 * time.Hour)
+	assert.IsType(t, ErrExpired{}, VerifyWithExpiry(s, "root", 1, db, ExpiryChecker{Clock: fake}))
+	skewed := ExpiryChecker{Clock: fake, Skew: 90 * time.Minute}
+	assert.NoError(t, VerifyWithExpiry(s, "root", 1, db, skewed))
+	fake.Advance(time.Hour)
+	assert.IsType(t, ErrExpired{}, VerifyWithExpiry(s, "root", 1, db, skewed))
+
+	// roots verified against a set of keys follow the same checker
+	rootKeys := map[string]data.PublicKey{k.ID(): k}
+	assert.IsType(t, ErrExpired{}, VerifyRoot(s, 1, rootKeys))
+	fake = clock.NewFake(expires.Add(-time.Hour))
+	assert.NoError(t, VerifyRootWithExpiry(s, 1, rootKeys, ExpiryChecker{Clock: fake}))
+	fake.Advance(2 * time.Hour)
+	assert.IsType(t, ErrExpired{}, VerifyRootWithExpiry(s, 1, rootKeys, ExpiryChecker{Clock: fake}))
+}
+
+func TestVerifySignaturesReport(t *testing.T) {
+	cryptoService := NewEd25519()
+	b, err := json.MarshalCanonical(&data.SignedCommon{Type: data.TUFTypes["root"], Version: 1})
+	assert.NoError(t, err)
+	s := &data.Signed{Signed: b}
+
+	db := keys.NewDB()
+	roleKeys := make([]data.PublicKey, 5)
+	ids := make([]string, 5)
+	for i := range roleKeys {
+		roleKeys[i], err = cryptoService.Create("root", data.ED25519Key)
+		assert.NoError(t, err)
+		ids[i] = roleKeys[i].ID()
+	}
+	// the last of the role's keys is missing from the db
+	for _, k := range roleKeys[:4] {
+		db.AddKey(k)
+	}
+	outsider, err := cryptoService.Create("root", data.ED25519Key)
+	assert.NoError(t, err)
+	db.AddKey(outsider)
+	role, err := data.NewRole("root", 3, ids[:4], nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, db.AddRole(role))
+	role.KeyIDs = append(role.KeyIDs, ids[4])
+
+	assert.NoError(t, Sign(cryptoService, s, append(roleKeys, outsider)...))
+	sigs := make(map[string]data.Signature)
+	for _, sig := range s.Signatures {
+		sigs[sig.KeyID] = sig
+	}
+	unsupported := sigs[ids[1]]
+	unsupported.Method = "foo"
+	mismatched := sigs[ids[2]]
+	mismatched.Method = data.ECDSASignature
+	invalid := sigs[ids[3]]
+	invalid.Signature = make([]byte, len(invalid.Signature))
+	s.Signatures = []data.Signature{
+		sigs[ids[0]], sigs[ids[0]], unsupported, mismatched, invalid, sigs[ids[4]], sigs[outsider.ID()],
+	}
+
+	err = VerifySignatures(s, "root", db)
+	assert.IsType(t, ErrRoleThreshold{}, err)
+	report := err.(ErrRoleThreshold).Report
+	assert.Equal(t, "root", report.Role)
+	assert.Equal(t, 3, report.Threshold)
+	assert.Equal(t, 1, report.Valid)
+	outcomes := make([]SignatureOutcome, 0, len(report.Signatures))
+	for _, result := range report.Signatures {
+		outcomes = append(outcomes, result.Outcome)
+	}
+	assert.Equal(t, []SignatureOutcome{
+		SignatureValid,
+		SignatureDuplicate,
+		SignatureUnsupportedMethod,
+		SignatureKeyTypeMismatch,
+		SignatureInvalid,
+		SignatureUnknownKey,
+		SignatureKeyNotInRole,
+	}, outcomes)
+	assert.Equal(t, ids[3], report.Signatures[4].KeyID)
+	assert.Equal(t, ErrInvalid, report.Signatures[4].Err)
+	assert.Equal(t, data.ECDSASignature, report.Signatures[3].Method)
+	assert.Contains(t, err.Error(), "root has 1 of 3 required valid signatures")
+
+	// CheckSignatures reports without failing
+	checked, err := CheckSignatures(s, "root", db)
+	assert.NoError(t, err)
+	assert.Equal(t, report, checked)
+}
@@ -0,0 +1,177 @@
+package signer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/endophage/gotuf/data"
+)
+
+// maxResponseSize caps the size of a response body, which is never more
+// than a few keys or signatures
+const maxResponseSize = 1 << 20
+
+// Client is a signed.CryptoService that calls a remote Server. Private
+// keys never leave the server.
+type Client struct {
+	baseURL url.URL
+	client  *http.Client
+}
+
+// NewClient creates a Client for the Server at baseURL, authenticating
+// with the TLS configuration, see ClientTLSConfig
+func NewClient(baseURL string, config *tls.Config) (*Client, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if base.Scheme != "https" {
+		return nil, errors.New("signer client requires an https baseURL")
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		// so request paths are resolved beneath it
+		base.Path += "/"
+	}
+	return &Client{
+		baseURL: *base,
+		client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: config},
+		},
+	}, nil
+}
+
+// ClientTLSConfig returns a TLS configuration for a Client that presents
+// cert and only trusts servers with a certificate issued by one of rootCAs
+func ClientTLSConfig(cert tls.Certificate, rootCAs *x509.CertPool) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      rootCAs,
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// Create asks the server to generate a new key for the role and returns
+// the public part
+func (c *Client) Create(role string, algorithm data.KeyAlgorithm) (data.PublicKey, error) {
+	k := &data.TUFKey{}
+	err := c.do("POST", keysPath, createRequest{Role: role, Algorithm: algorithm}, k)
+	if err != nil {
+		return nil, err
+	}
+	return data.NewPublicKey(k.Algorithm(), k.Public()), nil
+}
+
+// GetKey retrieves the public key from the server, returning nil if the
+// server does not hold it or cannot be reached
+func (c *Client) GetKey(keyID string) data.PublicKey {
+	k := &data.TUFKey{}
+	segment, err := escapeKeyID(keyID)
+	if err == nil {
+		err = c.do("GET", keysPath+segment, nil, k)
+	}
+	if err != nil {
+		if _, ok := err.(ErrKeyNotFound); !ok {
+			logrus.Errorf("Failed to get key %s: %s", keyID, err.Error())
+		}
+		return nil
+	}
+	return data.NewPublicKey(k.Algorithm(), k.Public())
+}
+
+// RemoveKey asks the server to delete the key
+func (c *Client) RemoveKey(keyID string) error {
+	segment, err := escapeKeyID(keyID)
+	if err != nil {
+		return err
+	}
+	return c.do("DELETE", keysPath+segment, nil, nil)
+}
+
+// Sign asks the server to sign the data with each of the keys it holds.
+// Key IDs it does not hold are skipped as another party may hold them.
+func (c *Client) Sign(keyIDs []string, toSign []byte) ([]data.Signature, error) {
+	resp := signResponse{}
+	if err := c.do("POST", signPath, signRequest{KeyIDs: keyIDs, Data: toSign}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Signatures, nil
+}
+
+// do makes a request with the JSON encoding of in as the body, when in is
+// not nil, and decodes the response into out, when out is not nil
+func (c *Client) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	u, err := c.baseURL.Parse(strings.TrimPrefix(path, "/"))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return decodeError(resp.StatusCode, raw)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// decodeError recreates the error the server returned
+func decodeError(code int, raw []byte) error {
+	resp := errorResponse{}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return ErrRemote{Code: code, Msg: string(bytes.TrimSpace(raw))}
+	}
+	switch resp.Kind {
+	case "unauthenticated":
+		return ErrUnauthenticated{}
+	case "forbidden":
+		return ErrForbidden{Client: resp.Client, Role: resp.Role}
+	case "unknown_key_role":
+		return ErrUnknownKeyRole{KeyID: resp.KeyID}
+	case "not_found":
+		return ErrKeyNotFound{KeyID: resp.KeyID}
+	}
+	return ErrRemote{Code: code, Msg: resp.Msg}
+}
+
+// escapeKeyID escapes a key ID, including any "/", for use as the final
+// segment of a request path. Key IDs that would be resolved as a relative
+// path rather than a segment are rejected.
+func escapeKeyID(keyID string) (string, error) {
+	switch keyID {
+	case "", ".", "..":
+		return "", ErrInvalidKeyID{KeyID: keyID}
+	}
+	return url.PathEscape(keyID), nil
+}
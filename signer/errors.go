@@ -0,0 +1,64 @@
+package signer
+
+import (
+	"fmt"
+)
+
+// ErrUnauthenticated indicates the request was not made with a client
+// certificate issued by a CA the server trusts
+type ErrUnauthenticated struct{}
+
+func (e ErrUnauthenticated) Error() string {
+	return "signing service requires a trusted client certificate"
+}
+
+// ErrForbidden indicates the client is not authorized to use keys for the
+// role
+type ErrForbidden struct {
+	Client string
+	Role   string
+}
+
+func (e ErrForbidden) Error() string {
+	return fmt.Sprintf("%s is not authorized to use %s keys", e.Client, e.Role)
+}
+
+// ErrUnknownKeyRole indicates the server holds a key but does not know
+// which role it belongs to, so cannot authorize its use
+type ErrUnknownKeyRole struct {
+	KeyID string
+}
+
+func (e ErrUnknownKeyRole) Error() string {
+	return fmt.Sprintf("role of key %s is unknown", e.KeyID)
+}
+
+// ErrRemote is an error returned by the signing service that has no more
+// specific type
+type ErrRemote struct {
+	Code int
+	Msg  string
+}
+
+func (e ErrRemote) Error() string {
+	return fmt.Sprintf("signing service returned %d: %s", e.Code, e.Msg)
+}
+
+// ErrKeyNotFound indicates the signing service does not hold the key
+type ErrKeyNotFound struct {
+	KeyID string
+}
+
+func (e ErrKeyNotFound) Error() string {
+	return fmt.Sprintf("signing service does not hold key %s", e.KeyID)
+}
+
+// ErrInvalidKeyID indicates a key ID that cannot be sent to the signing
+// service as a path segment
+type ErrInvalidKeyID struct {
+	KeyID string
+}
+
+func (e ErrInvalidKeyID) Error() string {
+	return fmt.Sprintf("invalid key ID %q", e.KeyID)
+}
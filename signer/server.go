@@ -0,0 +1,316 @@
+package signer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/signed"
+	"github.com/endophage/gotuf/utils"
+)
+
+const (
+	signPath = "/v1/sign"
+	keysPath = "/v1/keys/"
+
+	// maxRequestSize caps the size of a request body, which for signing is
+	// the largest metadata file the repo is expected to produce
+	maxRequestSize = 5 << 20
+)
+
+type signRequest struct {
+	KeyIDs []string `json:"keyids"`
+	Data   []byte   `json:"data"`
+}
+
+type signResponse struct {
+	Signatures []data.Signature `json:"signatures"`
+}
+
+type createRequest struct {
+	Role      string            `json:"role"`
+	Algorithm data.KeyAlgorithm `json:"keytype"`
+}
+
+// errorResponse carries enough of an error for the client to recreate the
+// typed errors it knows about
+type errorResponse struct {
+	Kind   string `json:"kind"`
+	Msg    string `json:"msg"`
+	Client string `json:"client,omitempty"`
+	Role   string `json:"role,omitempty"`
+	KeyID  string `json:"keyid,omitempty"`
+}
+
+// Authorizer decides whether a client may use the keys of a role
+type Authorizer interface {
+	Authorize(client *x509.Certificate, role string) bool
+}
+
+// RoleAuthorizer authorizes clients by the common name of their
+// certificate, mapping each name to the roles it may use
+type RoleAuthorizer map[string][]string
+
+// Authorize returns true if role is listed for the client's common name
+func (a RoleAuthorizer) Authorize(client *x509.Certificate, role string) bool {
+	for _, r := range a[client.Subject.CommonName] {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// keyLister is implemented by CryptoServices that record the role each of
+// their keys was created for
+type keyLister interface {
+	ListKeys() (map[string]string, error)
+}
+
+// Server exposes a CryptoService over HTTPS so that keys can be kept on an
+// isolated signing host. Clients are authenticated by their TLS
+// certificate, so the server must be run with a TLS configuration that
+// verifies client certificates, see ServerTLSConfig, and every use of a
+// key must be allowed for its role by the Authorizer.
+//
+// The role of a key is the one it was created for through the server or,
+// when the CryptoService can list its keys, the one it records. Keys
+// created by other means must be registered with SetKeyRole before they
+// can be used.
+type Server struct {
+	service    signed.CryptoService
+	authorizer Authorizer
+
+	mutex sync.RWMutex
+	roles map[string]string
+}
+
+// NewServer creates a Server for the CryptoService
+func NewServer(service signed.CryptoService, authorizer Authorizer) *Server {
+	return &Server{
+		service:    service,
+		authorizer: authorizer,
+		roles:      make(map[string]string),
+	}
+}
+
+// ServerTLSConfig returns a TLS configuration for a Server that requires
+// clients present a certificate issued by one of clientCAs
+func ServerTLSConfig(cert tls.Certificate, clientCAs *x509.CertPool) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// ListenAndServeTLS serves the signing service on addr until it fails
+func (s *Server) ListenAndServeTLS(addr string, config *tls.Config) error {
+	server := &http.Server{
+		Addr:      addr,
+		Handler:   s,
+		TLSConfig: config,
+	}
+	return server.ListenAndServeTLS("", "")
+}
+
+// SetKeyRole records the role of a key the server did not create
+func (s *Server) SetKeyRole(keyID, role string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.roles[keyID] = role
+}
+
+// keyRole returns the role of the key
+func (s *Server) keyRole(keyID string) (string, bool) {
+	s.mutex.RLock()
+	role, ok := s.roles[keyID]
+	s.mutex.RUnlock()
+	if ok {
+		return role, true
+	}
+	lister, ok := s.service.(keyLister)
+	if !ok {
+		return "", false
+	}
+	keys, err := lister.ListKeys()
+	if err != nil {
+		logrus.Errorf("Failed to list keys: %s", err.Error())
+		return "", false
+	}
+	role, ok = keys[keyID]
+	return role, ok
+}
+
+// authorize checks the client may use keys of the role
+func (s *Server) authorize(client *x509.Certificate, role string) error {
+	if !s.authorizer.Authorize(client, role) {
+		logrus.Infof("refused %s access to %s keys", client.Subject.CommonName, role)
+		return ErrForbidden{Client: client.Subject.CommonName, Role: role}
+	}
+	return nil
+}
+
+// authorizeKey checks the client may use the key
+func (s *Server) authorizeKey(client *x509.Certificate, keyID string) error {
+	role, ok := s.keyRole(keyID)
+	if !ok {
+		return ErrUnknownKeyRole{KeyID: keyID}
+	}
+	return s.authorize(client, role)
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		writeError(w, ErrUnauthenticated{})
+		return
+	}
+	client := r.TLS.VerifiedChains[0][0]
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+
+	switch {
+	case r.URL.Path == signPath && r.Method == "POST":
+		s.sign(w, r, client)
+	case r.URL.Path == keysPath && r.Method == "POST":
+		s.create(w, r, client)
+	case strings.HasPrefix(r.URL.Path, keysPath) && r.Method == "GET":
+		s.getKey(w, strings.TrimPrefix(r.URL.Path, keysPath))
+	case strings.HasPrefix(r.URL.Path, keysPath) && r.Method == "DELETE":
+		s.removeKey(w, strings.TrimPrefix(r.URL.Path, keysPath), client)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) sign(w http.ResponseWriter, r *http.Request, client *x509.Certificate) {
+	req := signRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	keyIDs := make([]string, 0, len(req.KeyIDs))
+	for _, keyID := range req.KeyIDs {
+		if s.service.GetKey(keyID) == nil {
+			// another party may hold this key
+			continue
+		}
+		if err := s.authorizeKey(client, keyID); err != nil {
+			writeError(w, err)
+			return
+		}
+		keyIDs = append(keyIDs, keyID)
+	}
+	sigs, err := s.service.Sign(keyIDs, req.Data)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, signResponse{Signatures: sigs})
+}
+
+func (s *Server) create(w http.ResponseWriter, r *http.Request, client *x509.Certificate) {
+	req := createRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.authorize(client, req.Role); err != nil {
+		writeError(w, err)
+		return
+	}
+	k, err := s.service.Create(req.Role, req.Algorithm)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	for _, id := range keyIDs(k) {
+		s.SetKeyRole(id, req.Role)
+	}
+	writeJSON(w, http.StatusOK, data.NewPublicKey(k.Algorithm(), k.Public()))
+}
+
+func (s *Server) getKey(w http.ResponseWriter, keyID string) {
+	k := s.service.GetKey(keyID)
+	if k == nil {
+		writeError(w, ErrKeyNotFound{KeyID: keyID})
+		return
+	}
+	writeJSON(w, http.StatusOK, data.NewPublicKey(k.Algorithm(), k.Public()))
+}
+
+func (s *Server) removeKey(w http.ResponseWriter, keyID string, client *x509.Certificate) {
+	k := s.service.GetKey(keyID)
+	if k == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err := s.authorizeKey(client, keyID); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := s.service.RemoveKey(keyID); err != nil {
+		writeError(w, err)
+		return
+	}
+	s.mutex.Lock()
+	delete(s.roles, keyID)
+	for _, id := range keyIDs(k) {
+		delete(s.roles, id)
+	}
+	s.mutex.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// keyIDs returns the IDs the key may be referred to by. An x509 key is
+// identified by the ID of its certificate, but services holding such keys
+// identify them by the canonical ID of the key in the certificate.
+func keyIDs(k data.PublicKey) []string {
+	ids := []string{k.ID()}
+	canonical, err := utils.CanonicalKeyID(k)
+	if err != nil {
+		logrus.Errorf("Failed to determine the canonical ID of key %s: %s", k.ID(), err.Error())
+		return ids
+	}
+	if canonical != k.ID() {
+		ids = append(ids, canonical)
+	}
+	return ids
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.Errorf("Failed to write response: %s", err.Error())
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	resp := errorResponse{Msg: err.Error()}
+	code := http.StatusInternalServerError
+	switch err := err.(type) {
+	case ErrUnauthenticated:
+		resp.Kind, code = "unauthenticated", http.StatusUnauthorized
+	case ErrForbidden:
+		resp.Kind, code = "forbidden", http.StatusForbidden
+		resp.Client, resp.Role = err.Client, err.Role
+	case ErrUnknownKeyRole:
+		resp.Kind, code = "unknown_key_role", http.StatusForbidden
+		resp.KeyID = err.KeyID
+	case ErrKeyNotFound:
+		resp.Kind, code = "not_found", http.StatusNotFound
+		resp.KeyID = err.KeyID
+	case signed.ErrUnsupportedKeyAlgorithm, signed.ErrInvalidKeyLength:
+		code = http.StatusBadRequest
+	default:
+		logrus.Errorf("signing service error: %s", err.Error())
+	}
+	writeJSON(w, code, resp)
+}
@@ -0,0 +1,211 @@
+package signer_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+
+	"github.com/docker/notary/trustmanager"
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/signed"
+	"github.com/endophage/gotuf/signer"
+	"github.com/endophage/gotuf/testutils"
+	"github.com/endophage/gotuf/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func loopback(t *testing.T, service signed.CryptoService) *testutils.LoopbackSigner {
+	l, err := testutils.NewLoopbackSigner(service, signer.RoleAuthorizer{
+		"repo": {"timestamp", "snapshot"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestRemoteSign(t *testing.T) {
+	l := loopback(t, signed.NewMemoryCryptoService())
+	defer l.Close()
+	client, err := l.Client("repo")
+	assert.NoError(t, err)
+
+	for _, algorithm := range []data.KeyAlgorithm{data.ED25519Key, data.ECDSAKey} {
+		pub, err := client.Create("timestamp", algorithm)
+		assert.NoError(t, err)
+		assert.Equal(t, algorithm, pub.Algorithm())
+		assert.Equal(t, pub.ID(), client.GetKey(pub.ID()).ID())
+
+		msg := []byte("test data")
+		sigs, err := client.Sign([]string{pub.ID(), "unknown"}, msg)
+		assert.NoError(t, err)
+		assert.Len(t, sigs, 1)
+		assert.Equal(t, pub.ID(), sigs[0].KeyID)
+		assert.NoError(t, signed.Verifiers[sigs[0].Method].Verify(pub, sigs[0].Signature, msg))
+
+		assert.NoError(t, client.RemoveKey(pub.ID()))
+		assert.Nil(t, client.GetKey(pub.ID()))
+	}
+}
+
+// recordingService is a CryptoService recording the key IDs it is asked for
+type recordingService struct {
+	*signed.MemoryCryptoService
+	requested *[]string
+}
+
+func (s recordingService) GetKey(keyID string) data.PublicKey {
+	*s.requested = append(*s.requested, keyID)
+	return s.MemoryCryptoService.GetKey(keyID)
+}
+
+func TestRemoteKeyIDEscaped(t *testing.T) {
+	var requested []string
+	l := loopback(t, recordingService{MemoryCryptoService: signed.NewMemoryCryptoService(), requested: &requested})
+	defer l.Close()
+	client, err := l.Client("repo")
+	assert.NoError(t, err)
+
+	for _, keyID := range []string{"a key+id/with?odd#characters", "../../x", "a/../b", "..."} {
+		requested = nil
+		assert.Nil(t, client.GetKey(keyID))
+		assert.NoError(t, client.RemoveKey(keyID))
+		assert.Equal(t, []string{keyID, keyID}, requested, keyID)
+	}
+
+	// key IDs that cannot be a single path segment are never sent
+	requested = nil
+	for _, keyID := range []string{"", ".", ".."} {
+		assert.Nil(t, client.GetKey(keyID))
+		assert.Equal(t, signer.ErrInvalidKeyID{KeyID: keyID}, client.RemoveKey(keyID))
+	}
+	assert.Empty(t, requested)
+}
+
+// x509Service creates keys as x509 certificates but, like a PKCS#11
+// token, holds and signs with them under their canonical key IDs
+type x509Service struct {
+	*signed.MemoryCryptoService
+}
+
+func (s x509Service) Create(role string, algorithm data.KeyAlgorithm) (data.PublicKey, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	k, err := trustmanager.ECDSAToPrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.AddKey(k); err != nil {
+		return nil, err
+	}
+	template, err := trustmanager.NewCertificate(role)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return trustmanager.CertToKey(cert), nil
+}
+
+func TestRemoteSignX509(t *testing.T) {
+	l := loopback(t, x509Service{signed.NewMemoryCryptoService()})
+	defer l.Close()
+	client, err := l.Client("repo")
+	assert.NoError(t, err)
+
+	pub, err := client.Create("timestamp", data.ECDSAx509Key)
+	assert.NoError(t, err)
+	assert.Equal(t, data.ECDSAx509Key, pub.Algorithm())
+	keyID, err := utils.CanonicalKeyID(pub)
+	assert.NoError(t, err)
+	assert.NotEqual(t, pub.ID(), keyID)
+
+	// the key may be used by its canonical ID
+	sigs, err := client.Sign([]string{keyID}, []byte("test data"))
+	assert.NoError(t, err)
+	assert.Len(t, sigs, 1)
+	assert.Equal(t, keyID, sigs[0].KeyID)
+	assert.NoError(t, client.RemoveKey(keyID))
+	assert.Nil(t, client.GetKey(keyID))
+}
+
+func TestRemoteSignTimestamp(t *testing.T) {
+	l := loopback(t, signed.NewMemoryCryptoService())
+	defer l.Close()
+	client, err := l.Client("repo")
+	assert.NoError(t, err)
+
+	// the repo's timestamp key lives only on the signing service
+	kdb, repo, _ := testutils.EmptyRepo()
+	pub, err := client.Create("timestamp", data.ECDSAKey)
+	assert.NoError(t, err)
+	kdb.AddKey(pub)
+	role, err := data.NewRole("timestamp", 1, []string{pub.ID()}, nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, kdb.AddRole(role))
+
+	s, err := repo.SignTimestamp(data.DefaultExpires("timestamp"), client)
+	assert.NoError(t, err)
+	assert.NoError(t, signed.Verify(s, "timestamp", 0, kdb))
+}
+
+func TestRemoteAuthorization(t *testing.T) {
+	service := signed.NewMemoryCryptoService()
+	l := loopback(t, service)
+	defer l.Close()
+	client, err := l.Client("repo")
+	assert.NoError(t, err)
+	other, err := l.Client("other")
+	assert.NoError(t, err)
+
+	_, err = client.Create("root", data.ED25519Key)
+	assert.Equal(t, signer.ErrForbidden{Client: "repo", Role: "root"}, err)
+
+	// keys created on the signing host must have their role registered
+	root, err := service.Create("root", data.ED25519Key)
+	assert.NoError(t, err)
+	_, err = client.Sign([]string{root.ID()}, []byte("test data"))
+	assert.Equal(t, signer.ErrUnknownKeyRole{KeyID: root.ID()}, err)
+	l.Server.SetKeyRole(root.ID(), "root")
+	_, err = client.Sign([]string{root.ID()}, []byte("test data"))
+	assert.Equal(t, signer.ErrForbidden{Client: "repo", Role: "root"}, err)
+	assert.Equal(t, signer.ErrForbidden{Client: "repo", Role: "root"}, client.RemoveKey(root.ID()))
+	assert.NotNil(t, service.GetKey(root.ID()))
+
+	timestamp, err := client.Create("timestamp", data.ED25519Key)
+	assert.NoError(t, err)
+	_, err = other.Sign([]string{timestamp.ID()}, []byte("test data"))
+	assert.Equal(t, signer.ErrForbidden{Client: "other", Role: "timestamp"}, err)
+}
+
+func TestRemoteRequiresClientCertificate(t *testing.T) {
+	l := loopback(t, signed.NewMemoryCryptoService())
+	defer l.Close()
+
+	client, err := signer.NewClient(l.URL, &tls.Config{RootCAs: l.RootCAs()})
+	assert.NoError(t, err)
+	_, err = client.Create("timestamp", data.ED25519Key)
+	assert.Error(t, err)
+
+	// nor does the client trust a server it cannot verify
+	other := loopback(t, signed.NewMemoryCryptoService())
+	defer other.Close()
+	client, err = signer.NewClient(l.URL, &tls.Config{RootCAs: other.RootCAs()})
+	assert.NoError(t, err)
+	_, err = client.Create("timestamp", data.ED25519Key)
+	assert.Error(t, err)
+
+	_, err = signer.NewClient("http://127.0.0.1", nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"io"
+)
+
+// ContextMetadataStore is a MetadataStore whose operations can be
+// cancelled, or bounded by a deadline, using a context.Context
+type ContextMetadataStore interface {
+	MetadataStore
+	GetMetaContext(ctx context.Context, name string, size int64) ([]byte, error)
+	SetMetaContext(ctx context.Context, name string, blob []byte) error
+	SetMultiMetaContext(ctx context.Context, metas map[string][]byte) error
+}
+
+// ContextRemoteStore is a RemoteStore whose operations can be cancelled,
+// or bounded by a deadline, using a context.Context
+type ContextRemoteStore interface {
+	RemoteStore
+	ContextMetadataStore
+	RangeTargetStore
+	GetKeyContext(ctx context.Context, role string) ([]byte, error)
+	GetTargetContext(ctx context.Context, path string) (io.ReadCloser, error)
+}
+
+// MetadataWithContext returns the store as a ContextMetadataStore. Stores
+// that do not support contexts natively are wrapped so that calls return
+// as soon as the context is done, abandoning the underlying call. As an
+// abandoned call may still complete, callers should not assume a write
+// that returned a context error did not happen.
+func MetadataWithContext(s MetadataStore) ContextMetadataStore {
+	if cs, ok := s.(ContextMetadataStore); ok {
+		return cs
+	}
+	return contextMetadataStore{MetadataStore: s}
+}
+
+// RemoteWithContext returns the store as a ContextRemoteStore, wrapping
+// it as described for MetadataWithContext if necessary
+func RemoteWithContext(s RemoteStore) ContextRemoteStore {
+	if cs, ok := s.(ContextRemoteStore); ok {
+		return cs
+	}
+	return contextRemoteStore{
+		RemoteStore:          s,
+		contextMetadataStore: contextMetadataStore{MetadataStore: s},
+	}
+}
+
+// withContext runs fn, returning early with the context's error if the
+// context is done before fn completes. fn is not stopped when that happens:
+// the call is abandoned and left to run to completion in the background.
+// cleanup, if non-nil, is called with fn's result once fn completes if that
+// result was abandoned. As fn's result may be a nil interface, callers must
+// use the two value form when asserting its type.
+func withContext(ctx context.Context, fn func() (interface{}, error), cleanup func(interface{})) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	type result struct {
+		val interface{}
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		val, err := fn()
+		done <- result{val: val, err: err}
+	}()
+	select {
+	case res := <-done:
+		return res.val, res.err
+	case <-ctx.Done():
+		if cleanup != nil {
+			go func() {
+				if res := <-done; res.err == nil {
+					cleanup(res.val)
+				}
+			}()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+type contextMetadataStore struct {
+	MetadataStore
+}
+
+func (s contextMetadataStore) GetMetaContext(ctx context.Context, name string, size int64) ([]byte, error) {
+	meta, err := withContext(ctx, func() (interface{}, error) {
+		return s.GetMeta(name, size)
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	b, _ := meta.([]byte)
+	return b, nil
+}
+
+func (s contextMetadataStore) SetMetaContext(ctx context.Context, name string, blob []byte) error {
+	_, err := withContext(ctx, func() (interface{}, error) {
+		return nil, s.SetMeta(name, blob)
+	}, nil)
+	return err
+}
+
+func (s contextMetadataStore) SetMultiMetaContext(ctx context.Context, metas map[string][]byte) error {
+	_, err := withContext(ctx, func() (interface{}, error) {
+		return nil, s.SetMultiMeta(metas)
+	}, nil)
+	return err
+}
+
+type contextRemoteStore struct {
+	RemoteStore
+	contextMetadataStore
+}
+
+func (s contextRemoteStore) GetKeyContext(ctx context.Context, role string) ([]byte, error) {
+	key, err := withContext(ctx, func() (interface{}, error) {
+		return s.GetKey(role)
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	b, _ := key.([]byte)
+	return b, nil
+}
+
+func (s contextRemoteStore) GetTargetContext(ctx context.Context, path string) (io.ReadCloser, error) {
+	r, err := withContext(ctx, func() (interface{}, error) {
+		return s.GetTarget(path)
+	}, func(r interface{}) {
+		if rc, ok := r.(io.ReadCloser); ok {
+			rc.Close()
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	rc, _ := r.(io.ReadCloser)
+	return rc, nil
+}
+
+// GetTargetRange falls back to reading the target from the start, and
+// discarding the first offset bytes, if the wrapped store cannot serve
+// ranges itself.
+func (s contextRemoteStore) GetTargetRange(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	if rs, ok := s.RemoteStore.(RangeTargetStore); ok {
+		return rs.GetTargetRange(ctx, path, offset)
+	}
+	r, err := s.GetTargetContext(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if err := skip(r, offset); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingStore is a RemoteStore whose reads block until release is closed
+type blockingStore struct {
+	RemoteStore
+	release chan struct{}
+}
+
+func (b blockingStore) GetMeta(name string, size int64) ([]byte, error) {
+	<-b.release
+	return b.RemoteStore.GetMeta(name, size)
+}
+
+func (b blockingStore) GetTarget(path string) (io.ReadCloser, error) {
+	<-b.release
+	return b.RemoteStore.GetTarget(path)
+}
+
+// nilTargetStore is a RemoteStore serving no reader, and no error, for
+// every target
+type nilTargetStore struct {
+	RemoteStore
+}
+
+func (n nilTargetStore) GetTarget(path string) (io.ReadCloser, error) {
+	return nil, nil
+}
+
+func TestRemoteWithContext(t *testing.T) {
+	mem := NewMemoryStore(map[string][]byte{"root": []byte("data")}, nil)
+	s := RemoteWithContext(blockingStore{RemoteStore: mem, release: make(chan struct{})})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := s.GetMetaContext(ctx, "root", 10)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	_, err = s.GetTargetContext(ctx, "foo")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// a store that doesn't block completes as normal
+	meta, err := RemoteWithContext(mem).GetMetaContext(context.Background(), "root", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("data"), meta)
+	r, err := RemoteWithContext(nilTargetStore{RemoteStore: mem}).GetTargetContext(context.Background(), "foo")
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+
+	// stores supporting contexts natively are not wrapped
+	h := HTTPStore{}
+	assert.Equal(t, h, RemoteWithContext(h))
+}
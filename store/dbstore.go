@@ -0,0 +1,319 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/hex"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/errors"
+)
+
+// Schema holds the statements creating the tables a DBStore expects, in
+// SQL accepted by both SQLite and MySQL: identifiers that are reserved in
+// MySQL are quoted, every table is keyed on its natural columns rather than
+// an auto-incremented id, and metadata is stored as a longblob as a MySQL
+// blob holds no more than 64KB. CreateSchema executes them.
+var Schema = []string{
+	"CREATE TABLE IF NOT EXISTS `keys`(namespace varchar(255) not null, role varchar(255) not null, `key` text not null, primary key (namespace, role));",
+	"CREATE TABLE IF NOT EXISTS filehashes(namespace varchar(255) not null, path varchar(255) not null, alg varchar(10) not null, hash varchar(128) not null, primary key (namespace, path, alg));",
+	"CREATE TABLE IF NOT EXISTS filemeta(namespace varchar(255) not null, path varchar(255) not null, size int not null, custom text default null, primary key (namespace, path));",
+	"CREATE TABLE IF NOT EXISTS tuf_meta(namespace varchar(255) not null, role varchar(255) not null, data longblob not null, primary key (namespace, role));",
+}
+
+// CreateSchema creates any of the tables a DBStore expects that do not
+// already exist, in a single transaction
+func CreateSchema(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, stmt := range Schema {
+		if _, err := tx.Exec(stmt); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DBStore is a LocalStore and PublicKeyStore backed by a SQL database.
+// All rows are scoped by namespace so that many repositories can share
+// the same tables, which CreateSchema creates:
+//
+//	keys(namespace, role, key)
+//	filemeta(namespace, path, size, custom)
+//	filehashes(namespace, path, alg, hash)
+//	tuf_meta(namespace, role, data)
+type DBStore struct {
+	db        *sql.DB
+	namespace string
+}
+
+// NewDBStore initializes a DBStore for the given namespace
+func NewDBStore(db *sql.DB, namespace string) *DBStore {
+	return &DBStore{
+		db:        db,
+		namespace: namespace,
+	}
+}
+
+// GetMeta returns the meta for the given name (a role). As with the
+// other stores, size is a cap and longer data will be truncated.
+func (dbs *DBStore) GetMeta(name string, size int64) ([]byte, error) {
+	var meta []byte
+	err := dbs.db.QueryRow(
+		"SELECT data FROM tuf_meta WHERE namespace=? AND role=?;",
+		dbs.namespace, name,
+	).Scan(&meta)
+	if err == sql.ErrNoRows {
+		return nil, ErrMetaNotFound{}
+	} else if err != nil {
+		return nil, err
+	}
+	if int64(len(meta)) > size {
+		meta = meta[:size]
+	}
+	return meta, nil
+}
+
+// SetMeta sets the meta for a single role
+func (dbs *DBStore) SetMeta(name string, meta []byte) error {
+	return dbs.SetMultiMeta(map[string][]byte{name: meta})
+}
+
+// SetMultiMeta sets the metadata for multiple roles in a single
+// transaction. Either all of the roles are updated or none are.
+func (dbs *DBStore) SetMultiMeta(metas map[string][]byte) error {
+	tx, err := dbs.db.Begin()
+	if err != nil {
+		return err
+	}
+	for role, blob := range metas {
+		err = dbs.setMeta(tx, role, blob)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (dbs *DBStore) setMeta(tx *sql.Tx, role string, blob []byte) error {
+	_, err := tx.Exec(
+		"DELETE FROM tuf_meta WHERE namespace=? AND role=?;",
+		dbs.namespace, role,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO tuf_meta (namespace, role, data) VALUES (?,?,?);",
+		dbs.namespace, role, blob,
+	)
+	return err
+}
+
+// WalkStagedTargets walks all targets in scope. If paths is empty every
+// staged target is walked, otherwise only the given paths are, and it is
+// an error for any of them not to have been staged.
+func (dbs *DBStore) WalkStagedTargets(paths []string, targetsFn targetsWalkFunc) error {
+	if len(paths) == 0 {
+		var err error
+		paths, err = dbs.stagedPaths()
+		if err != nil {
+			return err
+		}
+	}
+	for _, path := range paths {
+		meta, err := dbs.loadTarget(path)
+		if err != nil {
+			return err
+		}
+		if err = targetsFn(path, meta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddTargets stages the given targets, replacing the meta of any that
+// have already been staged. All targets are added in a single transaction.
+func (dbs *DBStore) AddTargets(targets data.Files) error {
+	tx, err := dbs.db.Begin()
+	if err != nil {
+		return err
+	}
+	for path, meta := range targets {
+		err = dbs.removeTarget(tx, path)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		err = dbs.addTarget(tx, path, meta)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// RemoveTargets unstages the given targets. Paths that have not been
+// staged are ignored.
+func (dbs *DBStore) RemoveTargets(paths ...string) error {
+	tx, err := dbs.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		err = dbs.removeTarget(tx, path)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (dbs *DBStore) addTarget(tx *sql.Tx, path string, meta data.FileMeta) error {
+	var custom interface{}
+	if len(meta.Custom) > 0 {
+		custom = string(meta.Custom)
+	}
+	_, err := tx.Exec(
+		"INSERT INTO filemeta (namespace, path, size, custom) VALUES (?,?,?,?);",
+		dbs.namespace, path, meta.Length, custom,
+	)
+	if err != nil {
+		return err
+	}
+	for alg, hash := range meta.Hashes {
+		_, err = tx.Exec(
+			"INSERT INTO filehashes (namespace, path, alg, hash) VALUES (?,?,?,?);",
+			dbs.namespace, path, alg, hex.EncodeToString(hash),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (dbs *DBStore) removeTarget(tx *sql.Tx, path string) error {
+	_, err := tx.Exec(
+		"DELETE FROM filemeta WHERE namespace=? AND path=?;",
+		dbs.namespace, path,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"DELETE FROM filehashes WHERE namespace=? AND path=?;",
+		dbs.namespace, path,
+	)
+	return err
+}
+
+func (dbs *DBStore) stagedPaths() ([]string, error) {
+	rows, err := dbs.db.Query(
+		"SELECT path FROM filemeta WHERE namespace=? ORDER BY path;",
+		dbs.namespace,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, rows.Err()
+}
+
+func (dbs *DBStore) loadTarget(path string) (data.FileMeta, error) {
+	var (
+		size   int64
+		custom sql.NullString
+	)
+	err := dbs.db.QueryRow(
+		"SELECT size, custom FROM filemeta WHERE namespace=? AND path=?;",
+		dbs.namespace, path,
+	).Scan(&size, &custom)
+	if err == sql.ErrNoRows {
+		return data.FileMeta{}, errors.ErrFileNotFound{Path: path}
+	} else if err != nil {
+		return data.FileMeta{}, err
+	}
+	meta := data.FileMeta{Length: size, Hashes: make(data.Hashes)}
+	if custom.Valid {
+		meta.Custom = []byte(custom.String)
+	}
+
+	rows, err := dbs.db.Query(
+		"SELECT alg, hash FROM filehashes WHERE namespace=? AND path=?;",
+		dbs.namespace, path,
+	)
+	if err != nil {
+		return data.FileMeta{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var alg, hash string
+		if err := rows.Scan(&alg, &hash); err != nil {
+			return data.FileMeta{}, err
+		}
+		digest, err := hex.DecodeString(hash)
+		if err != nil {
+			logrus.Errorf("stored %s hash for %s is not valid hex", alg, path)
+			return data.FileMeta{}, err
+		}
+		meta.Hashes[alg] = digest
+	}
+	return meta, rows.Err()
+}
+
+// GetKey returns the public key stored for the given role
+func (dbs *DBStore) GetKey(role string) ([]byte, error) {
+	var key string
+	err := dbs.db.QueryRow(
+		"SELECT `key` FROM `keys` WHERE namespace=? AND role=?;",
+		dbs.namespace, role,
+	).Scan(&key)
+	if err == sql.ErrNoRows {
+		return nil, ErrMetaNotFound{}
+	} else if err != nil {
+		return nil, err
+	}
+	return []byte(key), nil
+}
+
+// SetKey stores the public key for the given role, replacing any
+// existing key for that role
+func (dbs *DBStore) SetKey(role string, key []byte) error {
+	tx, err := dbs.db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"DELETE FROM `keys` WHERE namespace=? AND role=?;",
+		dbs.namespace, role,
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO `keys` (namespace, role, `key`) VALUES (?,?,?);",
+		dbs.namespace, role, string(key),
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
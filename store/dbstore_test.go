@@ -0,0 +1,110 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/errors"
+	"github.com/endophage/gotuf/store"
+	"github.com/endophage/gotuf/testutils"
+)
+
+func TestDBStoreMeta(t *testing.T) {
+	db := testutils.GetSqliteDB()
+	defer testutils.FlushDB(db)
+	s := store.NewDBStore(db, "testNamespace")
+
+	_, err := s.GetMeta("root", 100)
+	assert.IsType(t, store.ErrMetaNotFound{}, err)
+
+	err = s.SetMeta("root", []byte("root data"))
+	assert.NoError(t, err)
+	err = s.SetMultiMeta(map[string][]byte{
+		"root":    []byte("new root data"),
+		"targets": []byte("targets data"),
+	})
+	assert.NoError(t, err)
+
+	root, err := s.GetMeta("root", 100)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("new root data"), root)
+
+	// size is a cap on the returned data
+	targets, err := s.GetMeta("targets", 7)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("targets"), targets)
+
+	// other namespaces must not see the data
+	_, err = store.NewDBStore(db, "otherNamespace").GetMeta("root", 100)
+	assert.IsType(t, store.ErrMetaNotFound{}, err)
+}
+
+func TestDBStoreWalkStagedTargets(t *testing.T) {
+	db := testutils.GetSqliteDB()
+	defer testutils.FlushDB(db)
+	s := store.NewDBStore(db, "testNamespace")
+
+	meta := testutils.SampleMeta()
+	meta.Custom = []byte(`{"foo":"bar"}`)
+	err := s.AddTargets(data.Files{
+		"a.txt": meta,
+		"b.txt": testutils.SampleMeta(),
+	})
+	assert.NoError(t, err)
+
+	found := make(data.Files)
+	err = s.WalkStagedTargets(nil, func(path string, m data.FileMeta) error {
+		found[path] = m
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, found, 2)
+	assert.Equal(t, meta, found["a.txt"])
+	assert.Nil(t, found["b.txt"].Custom)
+
+	err = s.WalkStagedTargets([]string{"c.txt"}, func(string, data.FileMeta) error { return nil })
+	assert.IsType(t, errors.ErrFileNotFound{}, err)
+
+	err = s.RemoveTargets("a.txt")
+	assert.NoError(t, err)
+	found = make(data.Files)
+	err = s.WalkStagedTargets(nil, func(path string, m data.FileMeta) error {
+		found[path] = m
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+	_, ok := found["b.txt"]
+	assert.True(t, ok)
+}
+
+func TestDBStoreKeys(t *testing.T) {
+	db := testutils.GetSqliteDB()
+	defer testutils.FlushDB(db)
+	s := store.NewDBStore(db, "testNamespace")
+
+	_, err := s.GetKey("root")
+	assert.IsType(t, store.ErrMetaNotFound{}, err)
+
+	assert.NoError(t, s.SetKey("root", []byte("first key")))
+	assert.NoError(t, s.SetKey("root", []byte("second key")))
+
+	key, err := s.GetKey("root")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("second key"), key)
+}
+
+func TestCreateSchemaExisting(t *testing.T) {
+	db := testutils.GetSqliteDB()
+	defer testutils.FlushDB(db)
+	s := store.NewDBStore(db, "testNamespace")
+	assert.NoError(t, s.SetMeta("root", []byte("root data")))
+
+	// existing tables, and their rows, are left alone
+	assert.NoError(t, store.CreateSchema(db))
+	root, err := s.GetMeta("root", 100)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("root data"), root)
+}
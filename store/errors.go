@@ -1,5 +1,7 @@
 package store
 
+import "fmt"
+
 // ErrMetaNotFound indicates we did not find a particular piece
 // of metadata in the store
 type ErrMetaNotFound struct{}
@@ -7,3 +9,25 @@ type ErrMetaNotFound struct{}
 func (err ErrMetaNotFound) Error() string {
 	return "no trust data available"
 }
+
+// ErrInvalidTargetPath indicates a target path would resolve outside of
+// the targets directory
+type ErrInvalidTargetPath struct {
+	Path string
+}
+
+func (err ErrInvalidTargetPath) Error() string {
+	return fmt.Sprintf("invalid target path %s", err.Path)
+}
+
+// ErrRangeMismatch indicates a server responded to a request for a target
+// from an offset with a range that does not start at that offset
+type ErrRangeMismatch struct {
+	Path   string
+	Offset int64
+	Range  string
+}
+
+func (err ErrRangeMismatch) Error() string {
+	return fmt.Sprintf("requested %s from offset %d but was sent range %q", err.Path, err.Offset, err.Range)
+}
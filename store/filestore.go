@@ -1,14 +1,32 @@
 package store
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/errors"
+)
+
+const (
+	// stagingDirName is the directory, relative to the baseDir, that
+	// metadata is written to before being moved into place.
+	stagingDirName = ".staging"
+	// journalFileName is the file, relative to the baseDir, recording the
+	// names of staged metadata files that have been committed. Its presence
+	// means a multi meta write must be completed.
+	journalFileName = ".staging.journal"
 )
 
-// NewFilesystemStore creates a new store in a directory tree
+// NewFilesystemStore creates a new store in a directory tree. Any
+// interrupted SetMultiMeta is recovered: if it was committed it is
+// completed, otherwise it is rolled back.
 func NewFilesystemStore(baseDir, metaSubDir, metaExtension, targetsSubDir string) (*FilesystemStore, error) {
 	metaDir := path.Join(baseDir, metaSubDir)
 	targetsDir := path.Join(baseDir, targetsSubDir)
@@ -23,50 +41,263 @@ func NewFilesystemStore(baseDir, metaSubDir, metaExtension, targetsSubDir string
 		return nil, err
 	}
 
-	return &FilesystemStore{
+	f := &FilesystemStore{
 		baseDir:       baseDir,
 		metaDir:       metaDir,
 		metaExtension: metaExtension,
 		targetsDir:    targetsDir,
-	}, nil
+		stagingDir:    path.Join(baseDir, stagingDirName),
+		journal:       path.Join(baseDir, journalFileName),
+	}
+	if err := f.recover(); err != nil {
+		return nil, err
+	}
+	return f, nil
 }
 
-// FilesystemStore is a store in a locally accessible directory
+// FilesystemStore is a store in a locally accessible directory. Reads and
+// writes are serialized by an in-process lock only, so a directory must not
+// be shared by more than one FilesystemStore, in this or any other process:
+// each recovers interrupted writes by discarding whatever is staged.
 type FilesystemStore struct {
 	baseDir       string
 	metaDir       string
 	metaExtension string
 	targetsDir    string
+	stagingDir    string
+	journal       string
+	mu            sync.Mutex
 }
 
-// GetMeta returns the meta for the given name (a role)
+func (f *FilesystemStore) metaFileName(name string) string {
+	return fmt.Sprintf("%s.%s", name, f.metaExtension)
+}
+
+// GetMeta returns the meta for the given name (a role), or ErrMetaNotFound
+// if there is none. A committed SetMultiMeta that has not been completed is
+// completed first, so a partly applied update is never read.
 func (f *FilesystemStore) GetMeta(name string, size int64) ([]byte, error) {
-	fileName := fmt.Sprintf("%s.%s", name, f.metaExtension)
-	path := filepath.Join(f.metaDir, fileName)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.recover(); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(f.metaDir, f.metaFileName(name))
 	meta, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrMetaNotFound{}
+	}
 	if err != nil {
 		return nil, err
 	}
 	return meta, nil
 }
 
-// SetMultiMeta sets the metadata for multiple roles in one operation
+// SetMultiMeta sets the metadata for multiple roles in one operation.
+// Either all of the roles are updated or none are, even if the process
+// crashes part way through. A previous update that was committed but
+// failed to complete is completed first.
 func (f *FilesystemStore) SetMultiMeta(metas map[string][]byte) error {
-	for role, blob := range metas {
-		err := f.SetMeta(role, blob)
-		if err != nil {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.recover(); err != nil {
+		return err
+	}
+
+	names, err := f.stage(metas)
+	if err != nil {
+		os.RemoveAll(f.stagingDir)
+		return err
+	}
+	// writing the journal is the commit point, after which recovery
+	// will always complete the update.
+	if err := f.writeJournal(names); err != nil {
+		os.RemoveAll(f.stagingDir)
+		return err
+	}
+	return f.applyJournal(names)
+}
+
+// SetMeta sets the meta for a single role. As with SetMultiMeta, a
+// previous update that was committed but failed to complete is completed
+// first, so it cannot later overwrite this one.
+func (f *FilesystemStore) SetMeta(name string, meta []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.recover(); err != nil {
+		return err
+	}
+
+	fileName := f.metaFileName(name)
+	staged := filepath.Join(f.stagingDir, fileName)
+	if err := writeFileSync(staged, meta); err != nil {
+		os.RemoveAll(f.stagingDir)
+		return err
+	}
+	return moveFile(staged, filepath.Join(f.metaDir, fileName))
+}
+
+// WalkStagedTargets walks the files in the targets directory. If paths
+// is empty every file is walked, otherwise only the given paths are, and
+// it is an error for any of them not to exist.
+func (f *FilesystemStore) WalkStagedTargets(paths []string, targetsFn targetsWalkFunc) error {
+	if len(paths) == 0 {
+		return filepath.Walk(f.targetsDir, func(fullPath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if fullPath == f.stagingDir && info.IsDir() {
+				return filepath.SkipDir
+			}
+			if !info.Mode().IsRegular() || fullPath == f.journal {
+				return nil
+			}
+			rel, err := filepath.Rel(f.targetsDir, fullPath)
+			if err != nil {
+				return err
+			}
+			return f.walkTarget(filepath.ToSlash(rel), targetsFn)
+		})
+	}
+
+	for _, path := range paths {
+		if err := f.walkTarget(path, targetsFn); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-// SetMeta sets the meta for a single role
-func (f *FilesystemStore) SetMeta(name string, meta []byte) error {
-	fileName := fmt.Sprintf("%s.%s", name, f.metaExtension)
-	path := filepath.Join(f.metaDir, fileName)
-	if err := ioutil.WriteFile(path, meta, 0600); err != nil {
+func (f *FilesystemStore) walkTarget(path string, targetsFn targetsWalkFunc) error {
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		if part == ".." {
+			return ErrInvalidTargetPath{Path: path}
+		}
+	}
+	file, err := os.Open(filepath.Join(f.targetsDir, filepath.FromSlash(path)))
+	if os.IsNotExist(err) {
+		return errors.ErrFileNotFound{Path: path}
+	} else if err != nil {
 		return err
 	}
-	return nil
+	defer file.Close()
+	meta, err := data.NewFileMeta(file, "sha256")
+	if err != nil {
+		return err
+	}
+	return targetsFn(path, meta)
+}
+
+// stage writes each piece of metadata into the staging directory,
+// returning the names that were staged.
+func (f *FilesystemStore) stage(metas map[string][]byte) ([]string, error) {
+	if err := os.RemoveAll(f.stagingDir); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(metas))
+	for name, blob := range metas {
+		staged := filepath.Join(f.stagingDir, f.metaFileName(name))
+		if err := writeFileSync(staged, blob); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (f *FilesystemStore) writeJournal(names []string) error {
+	j, err := json.Marshal(names)
+	if err != nil {
+		return err
+	}
+	tmp := f.journal + ".tmp"
+	if err := writeFileSync(tmp, j); err != nil {
+		return err
+	}
+	return moveFile(tmp, f.journal)
+}
+
+// applyJournal moves the named files from the staging directory into
+// place then removes the journal. It may safely be re-run if interrupted.
+func (f *FilesystemStore) applyJournal(names []string) error {
+	for _, name := range names {
+		fileName := f.metaFileName(name)
+		err := moveFile(
+			filepath.Join(f.stagingDir, fileName),
+			filepath.Join(f.metaDir, fileName),
+		)
+		// a missing staged file was moved by an earlier, interrupted, attempt
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Remove(f.journal); err != nil {
+		return err
+	}
+	if err := syncDir(f.baseDir); err != nil {
+		return err
+	}
+	return os.RemoveAll(f.stagingDir)
+}
+
+// recover completes a committed multi meta write, or discards an
+// uncommitted one, left behind by a crash.
+func (f *FilesystemStore) recover() error {
+	os.Remove(f.journal + ".tmp")
+	j, err := ioutil.ReadFile(f.journal)
+	if os.IsNotExist(err) {
+		return os.RemoveAll(f.stagingDir)
+	} else if err != nil {
+		return err
+	}
+	var names []string
+	if err := json.Unmarshal(j, &names); err != nil {
+		return err
+	}
+	return f.applyJournal(names)
+}
+
+// writeFileSync writes the file, creating any parent directories, and
+// ensures the contents have reached the disk before returning.
+func writeFileSync(name string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(b)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// moveFile atomically renames src to dst, creating dst's parent directory
+// if necessary, and syncs the directory so the rename is durable.
+func moveFile(src, dst string) error {
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(dst))
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
 }
@@ -7,6 +7,9 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/errors"
 )
 
 const testDir = "/tmp/testFilesystemStore/"
@@ -55,4 +58,162 @@ func TestGetMeta(t *testing.T) {
 	assert.Nil(t, err, "GetMeta returned unexpected error: %v", err)
 
 	assert.Equal(t, testContent, content, "Content read from file was corrupted.")
+
+	_, err = s.GetMeta("missing", 100)
+	assert.IsType(t, ErrMetaNotFound{}, err)
+}
+
+func TestFilesystemSetMultiMeta(t *testing.T) {
+	s, err := NewFilesystemStore(testDir, "metadata", "json", "targets")
+	assert.Nil(t, err, "Initializing FilesystemStore returned unexpected error: %v", err)
+	defer os.RemoveAll(testDir)
+
+	metas := map[string][]byte{
+		"root":         []byte("root data"),
+		"targets/deep": []byte("delegation data"),
+	}
+	err = s.SetMultiMeta(metas)
+	assert.Nil(t, err, "SetMultiMeta returned unexpected error: %v", err)
+
+	for role, blob := range metas {
+		content, err := ioutil.ReadFile(path.Join(testDir, "metadata", role+".json"))
+		assert.Nil(t, err, "Error reading file: %v", err)
+		assert.Equal(t, blob, content, "Content written to file was corrupted.")
+	}
+	_, err = os.Stat(path.Join(testDir, stagingDirName))
+	assert.True(t, os.IsNotExist(err), "Staging directory was not cleaned up")
+	_, err = os.Stat(path.Join(testDir, journalFileName))
+	assert.True(t, os.IsNotExist(err), "Journal was not cleaned up")
+}
+
+func TestSetMultiMetaRecoverCommitted(t *testing.T) {
+	s, err := NewFilesystemStore(testDir, "metadata", "json", "targets")
+	assert.Nil(t, err, "Initializing FilesystemStore returned unexpected error: %v", err)
+	defer os.RemoveAll(testDir)
+
+	err = s.SetMultiMeta(map[string][]byte{"snapshot": []byte("old snapshot"), "timestamp": []byte("old timestamp")})
+	assert.Nil(t, err)
+
+	// simulate a crash after the journal was written but before all the
+	// staged files were moved into place.
+	names, err := s.stage(map[string][]byte{"snapshot": []byte("new snapshot"), "timestamp": []byte("new timestamp")})
+	assert.Nil(t, err)
+	assert.Nil(t, s.writeJournal(names))
+	assert.Nil(t, moveFile(path.Join(testDir, stagingDirName, "snapshot.json"), path.Join(testDir, "metadata", "snapshot.json")))
+
+	s, err = NewFilesystemStore(testDir, "metadata", "json", "targets")
+	assert.Nil(t, err, "Recovering FilesystemStore returned unexpected error: %v", err)
+
+	snapshot, err := s.GetMeta("snapshot", 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("new snapshot"), snapshot)
+	timestamp, err := s.GetMeta("timestamp", 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("new timestamp"), timestamp)
+}
+
+func TestSetMultiMetaRecoverUncommitted(t *testing.T) {
+	s, err := NewFilesystemStore(testDir, "metadata", "json", "targets")
+	assert.Nil(t, err, "Initializing FilesystemStore returned unexpected error: %v", err)
+	defer os.RemoveAll(testDir)
+
+	err = s.SetMultiMeta(map[string][]byte{"snapshot": []byte("old snapshot"), "timestamp": []byte("old timestamp")})
+	assert.Nil(t, err)
+
+	// simulate a crash before the journal was written
+	_, err = s.stage(map[string][]byte{"snapshot": []byte("new snapshot"), "timestamp": []byte("new timestamp")})
+	assert.Nil(t, err)
+
+	s, err = NewFilesystemStore(testDir, "metadata", "json", "targets")
+	assert.Nil(t, err, "Recovering FilesystemStore returned unexpected error: %v", err)
+
+	snapshot, err := s.GetMeta("snapshot", 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("old snapshot"), snapshot)
+	timestamp, err := s.GetMeta("timestamp", 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("old timestamp"), timestamp)
+	_, err = os.Stat(path.Join(testDir, stagingDirName))
+	assert.True(t, os.IsNotExist(err), "Staging directory was not rolled back")
+}
+
+func TestSetMultiMetaRecoverFailedApply(t *testing.T) {
+	s, err := NewFilesystemStore(testDir, "metadata", "json", "targets")
+	assert.Nil(t, err, "Initializing FilesystemStore returned unexpected error: %v", err)
+	defer os.RemoveAll(testDir)
+
+	// an update committed to the journal that failed to be applied
+	names, err := s.stage(map[string][]byte{"snapshot": []byte("committed snapshot"), "timestamp": []byte("committed timestamp")})
+	assert.Nil(t, err)
+	assert.Nil(t, s.writeJournal(names))
+
+	// it is completed before the next update, which is not rolled back
+	assert.Nil(t, s.SetMultiMeta(map[string][]byte{"timestamp": []byte("new timestamp")}))
+	snapshot, err := s.GetMeta("snapshot", 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("committed snapshot"), snapshot)
+
+	names, err = s.stage(map[string][]byte{"snapshot": []byte("committed snapshot 2")})
+	assert.Nil(t, err)
+	assert.Nil(t, s.writeJournal(names))
+	assert.Nil(t, s.SetMeta("snapshot", []byte("new snapshot")))
+
+	s, err = NewFilesystemStore(testDir, "metadata", "json", "targets")
+	assert.Nil(t, err)
+	snapshot, err = s.GetMeta("snapshot", 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("new snapshot"), snapshot)
+	timestamp, err := s.GetMeta("timestamp", 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("new timestamp"), timestamp)
+}
+
+func TestGetMetaCompletesCommitted(t *testing.T) {
+	s, err := NewFilesystemStore(testDir, "metadata", "json", "targets")
+	assert.Nil(t, err, "Initializing FilesystemStore returned unexpected error: %v", err)
+	defer os.RemoveAll(testDir)
+
+	err = s.SetMultiMeta(map[string][]byte{"snapshot": []byte("old snapshot"), "timestamp": []byte("old timestamp")})
+	assert.Nil(t, err)
+
+	// an update committed to the journal of which only one file has been
+	// moved into place
+	names, err := s.stage(map[string][]byte{"snapshot": []byte("new snapshot"), "timestamp": []byte("new timestamp")})
+	assert.Nil(t, err)
+	assert.Nil(t, s.writeJournal(names))
+	assert.Nil(t, moveFile(path.Join(testDir, stagingDirName, "snapshot.json"), path.Join(testDir, "metadata", "snapshot.json")))
+
+	// it is completed before reading, so the update is seen in full
+	timestamp, err := s.GetMeta("timestamp", 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("new timestamp"), timestamp)
+	_, err = os.Stat(path.Join(testDir, journalFileName))
+	assert.True(t, os.IsNotExist(err), "Journal was not cleaned up")
+}
+
+func TestFilesystemWalkStagedTargets(t *testing.T) {
+	s, err := NewFilesystemStore(testDir, "metadata", "json", "targets")
+	assert.Nil(t, err, "Initializing FilesystemStore returned unexpected error: %v", err)
+	defer os.RemoveAll(testDir)
+
+	os.MkdirAll(path.Join(testDir, "targets", "dir"), 0700)
+	ioutil.WriteFile(path.Join(testDir, "targets", "a.txt"), []byte("foo"), 0600)
+	ioutil.WriteFile(path.Join(testDir, "targets", "dir", "b.txt"), []byte("barbaz"), 0600)
+
+	found := make(map[string]int64)
+	err = s.WalkStagedTargets(nil, func(path string, meta data.FileMeta) error {
+		found[path] = meta.Length
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int64{"a.txt": 3, "dir/b.txt": 6}, found)
+
+	err = s.WalkStagedTargets([]string{"missing.txt"}, func(string, data.FileMeta) error { return nil })
+	assert.IsType(t, errors.ErrFileNotFound{}, err)
+
+	ioutil.WriteFile(path.Join(testDir, "outside.txt"), []byte("secret"), 0600)
+	for _, escape := range []string{"../outside.txt", "dir/../../outside.txt"} {
+		err = s.WalkStagedTargets([]string{escape}, func(string, data.FileMeta) error { return nil })
+		assert.Equal(t, ErrInvalidTargetPath{Path: escape}, err)
+	}
 }
@@ -2,6 +2,7 @@ package store
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -10,6 +11,8 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
+	"strings"
 
 	"github.com/Sirupsen/logrus"
 )
@@ -74,6 +77,11 @@ func NewHTTPStore(baseURL, metaPrefix, metaExtension, targetsPrefix, keyExtensio
 // is acceptable because in the case of timestamp.json, the size is a cap,
 // not an exact length.
 func (s HTTPStore) GetMeta(name string, size int64) ([]byte, error) {
+	return s.GetMetaContext(context.Background(), name, size)
+}
+
+// GetMetaContext is GetMeta with the request bound to ctx
+func (s HTTPStore) GetMetaContext(ctx context.Context, name string, size int64) ([]byte, error) {
 	url, err := s.buildMetaURL(name)
 	if err != nil {
 		return nil, err
@@ -82,6 +90,7 @@ func (s HTTPStore) GetMeta(name string, size int64) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	req = req.WithContext(ctx)
 	resp, err := s.roundTrip.RoundTrip(req)
 	if err != nil {
 		return nil, err
@@ -107,6 +116,11 @@ func (s HTTPStore) GetMeta(name string, size int64) ([]byte, error) {
 
 // SetMeta uploads a piece of TUF metadata to the server
 func (s HTTPStore) SetMeta(name string, blob []byte) error {
+	return s.SetMetaContext(context.Background(), name, blob)
+}
+
+// SetMetaContext is SetMeta with the request bound to ctx
+func (s HTTPStore) SetMetaContext(ctx context.Context, name string, blob []byte) error {
 	url, err := s.buildMetaURL("")
 	if err != nil {
 		return err
@@ -115,6 +129,7 @@ func (s HTTPStore) SetMeta(name string, blob []byte) error {
 	if err != nil {
 		return err
 	}
+	req = req.WithContext(ctx)
 	resp, err := s.roundTrip.RoundTrip(req)
 	if err != nil {
 		return err
@@ -132,6 +147,11 @@ func (s HTTPStore) SetMeta(name string, blob []byte) error {
 // This should be preferred for updating a remote server as it enable the server
 // to remain consistent, either accepting or rejecting the complete update.
 func (s HTTPStore) SetMultiMeta(metas map[string][]byte) error {
+	return s.SetMultiMetaContext(context.Background(), metas)
+}
+
+// SetMultiMetaContext is SetMultiMeta with the request bound to ctx
+func (s HTTPStore) SetMultiMetaContext(ctx context.Context, metas map[string][]byte) error {
 	url, err := s.buildMetaURL("")
 	if err != nil {
 		return err
@@ -150,10 +170,11 @@ func (s HTTPStore) SetMultiMeta(metas map[string][]byte) error {
 		return err
 	}
 	req, err := http.NewRequest("POST", url.String(), body)
-	req.Header.Set("Content-Type", writer.FormDataContentType())
 	if err != nil {
 		return err
 	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
 	resp, err := s.roundTrip.RoundTrip(req)
 	if err != nil {
 		return err
@@ -198,30 +219,97 @@ func (s HTTPStore) buildURL(uri string) (*url.URL, error) {
 // GetTarget returns a reader for the desired target or an error.
 // N.B. The caller is responsible for closing the reader.
 func (s HTTPStore) GetTarget(path string) (io.ReadCloser, error) {
+	return s.GetTargetContext(context.Background(), path)
+}
+
+// GetTargetContext is GetTarget with the request bound to ctx. Reads from
+// the returned reader will fail once ctx is done.
+func (s HTTPStore) GetTargetContext(ctx context.Context, path string) (io.ReadCloser, error) {
+	return s.GetTargetRange(ctx, path, 0)
+}
+
+// GetTargetRange returns a reader for the desired target starting offset
+// bytes into it, using an HTTP Range request. If the server ignores the
+// range and returns the whole target, the first offset bytes are skipped.
+// If the server returns a range that does not start at offset an
+// ErrRangeMismatch is returned.
+// N.B. The caller is responsible for closing the reader.
+func (s HTTPStore) GetTargetRange(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
 	url, err := s.buildTargetsURL(path)
 	if err != nil {
 		return nil, err
 	}
-	logrus.Debug("Attempting to download target: ", url.String())
+	logrus.Debugf("Attempting to download target %s from offset %d", url.String(), offset)
 	req, err := http.NewRequest("GET", url.String(), nil)
 	if err != nil {
 		return nil, err
 	}
+	req = req.WithContext(ctx)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
 	resp, err := s.roundTrip.RoundTrip(req)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		start, ok := rangeStart(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			resp.Body.Close()
+			return nil, ErrRangeMismatch{Path: path, Offset: offset, Range: resp.Header.Get("Content-Range")}
+		}
+		return resp.Body, nil
+	case resp.StatusCode == http.StatusOK:
+		if offset > 0 {
+			logrus.Debugf("server ignored range request for %s, skipping %d bytes", path, offset)
+			if err := skip(resp.Body, offset); err != nil {
+				resp.Body.Close()
+				return nil, err
+			}
+		}
+		return resp.Body, nil
+	}
+	resp.Body.Close()
 	if resp.StatusCode == http.StatusNotFound {
 		return nil, ErrMetaNotFound{}
-	} else if resp.StatusCode != http.StatusOK {
-		return nil, ErrServerUnavailable{code: resp.StatusCode}
 	}
-	return resp.Body, nil
+	return nil, ErrServerUnavailable{code: resp.StatusCode}
+}
+
+// rangeStart parses the first byte position from a Content-Range header of
+// the form "bytes first-last/length"
+func rangeStart(contentRange string) (int64, bool) {
+	if !strings.HasPrefix(contentRange, "bytes ") {
+		return 0, false
+	}
+	i := strings.Index(contentRange, "-")
+	if i < 0 {
+		return 0, false
+	}
+	start, err := strconv.ParseInt(strings.TrimPrefix(contentRange[:i], "bytes "), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return start, true
+}
+
+// skip discards the first n bytes of r, it is an error for r to be shorter
+func skip(r io.Reader, n int64) error {
+	_, err := io.CopyN(ioutil.Discard, r, n)
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
 }
 
 // GetKey retrieves a public key from the remote server
 func (s HTTPStore) GetKey(role string) ([]byte, error) {
+	return s.GetKeyContext(context.Background(), role)
+}
+
+// GetKeyContext is GetKey with the request bound to ctx
+func (s HTTPStore) GetKeyContext(ctx context.Context, role string) ([]byte, error) {
 	url, err := s.buildKeyURL(role)
 	if err != nil {
 		return nil, err
@@ -230,6 +318,7 @@ func (s HTTPStore) GetKey(role string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	req = req.WithContext(ctx)
 	resp, err := s.roundTrip.RoundTrip(req)
 	if err != nil {
 		return nil, err
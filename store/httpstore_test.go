@@ -1,14 +1,18 @@
 package store
 
 import (
+	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/hex"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -152,3 +156,69 @@ func TestPyNaCled25519Compat(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestHTTPStoreGetMetaContext(t *testing.T) {
+	release := make(chan struct{})
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+	defer close(release)
+	store, err := NewHTTPStore(server.URL, "metadata", "json", "targets", "key", &http.Transport{})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = store.(ContextRemoteStore).GetMetaContext(ctx, "root", 4801)
+	assert.Error(t, err)
+	assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+}
+
+func TestHTTPStoreGetTargetRange(t *testing.T) {
+	content := []byte("0123456789abcdef")
+	ignoreRange := false
+	wrongRange := false
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if ignoreRange {
+			w.Write(content)
+			return
+		}
+		if wrongRange {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(content)-1, len(content)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(content)
+			return
+		}
+		http.ServeContent(w, r, "target", time.Time{}, bytes.NewReader(content))
+	}
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+	s, err := NewHTTPStore(server.URL, "metadata", "json", "targets", "key", &http.Transport{})
+	assert.NoError(t, err)
+
+	// the body must still be readable once GetTarget returns
+	r, err := s.GetTarget("foo")
+	assert.NoError(t, err)
+	b, err := ioutil.ReadAll(r)
+	r.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, content, b)
+
+	for _, ignoreRange = range []bool{false, true} {
+		r, err = s.(RangeTargetStore).GetTargetRange(context.Background(), "foo", 10)
+		assert.NoError(t, err)
+		b, err = ioutil.ReadAll(r)
+		r.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, content[10:], b)
+	}
+
+	// a range that does not start at the offset is rejected
+	ignoreRange, wrongRange = false, true
+	_, err = s.(RangeTargetStore).GetTargetRange(context.Background(), "foo", 10)
+	assert.Equal(t, ErrRangeMismatch{Path: "foo", Offset: 10, Range: "bytes 0-15/16"}, err)
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	"io"
 
 	"github.com/endophage/gotuf/data"
@@ -41,3 +42,9 @@ type RemoteStore interface {
 	PublicKeyStore
 	GetTarget(path string) (io.ReadCloser, error)
 }
+
+// RangeTargetStore is implemented by remote stores that can serve a target
+// starting part way through, allowing interrupted downloads to be resumed
+type RangeTargetStore interface {
+	GetTargetRange(ctx context.Context, path string, offset int64) (io.ReadCloser, error)
+}
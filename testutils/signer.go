@@ -0,0 +1,117 @@
+package testutils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"time"
+
+	"github.com/endophage/gotuf/signed"
+	"github.com/endophage/gotuf/signer"
+)
+
+// LoopbackSigner runs a signer.Server on a loopback address with mutual TLS,
+// using certificates issued by a throwaway CA
+type LoopbackSigner struct {
+	Server *signer.Server
+	URL    string
+
+	http   *httptest.Server
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	caPool *x509.CertPool
+}
+
+// NewLoopbackSigner starts a signer.Server for the CryptoService. Close must
+// be called to stop it.
+func NewLoopbackSigner(service signed.CryptoService, authorizer signer.Authorizer) (*LoopbackSigner, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := certTemplate("loopback signer CA")
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageCertSign
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	l := &LoopbackSigner{
+		Server: signer.NewServer(service, authorizer),
+		ca:     ca,
+		caKey:  caKey,
+		caPool: x509.NewCertPool(),
+	}
+	l.caPool.AddCert(ca)
+
+	serverCert, err := l.issue("127.0.0.1", x509.ExtKeyUsageServerAuth)
+	if err != nil {
+		return nil, err
+	}
+	l.http = httptest.NewUnstartedServer(l.Server)
+	l.http.TLS = signer.ServerTLSConfig(serverCert, l.caPool)
+	l.http.StartTLS()
+	l.URL = l.http.URL
+	return l, nil
+}
+
+// Client returns a signer.Client authenticated with a certificate for the
+// common name
+func (l *LoopbackSigner) Client(name string) (*signer.Client, error) {
+	cert, err := l.issue(name, x509.ExtKeyUsageClientAuth)
+	if err != nil {
+		return nil, err
+	}
+	return signer.NewClient(l.URL, signer.ClientTLSConfig(cert, l.caPool))
+}
+
+// RootCAs returns the pool containing the loopback CA, which clients must
+// trust to connect to the server
+func (l *LoopbackSigner) RootCAs() *x509.CertPool {
+	return l.caPool
+}
+
+// Close stops the server
+func (l *LoopbackSigner) Close() {
+	l.http.Close()
+}
+
+// issue creates a certificate for the common name signed by the CA
+func (l *LoopbackSigner) issue(name string, usage x509.ExtKeyUsage) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := certTemplate(name)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+	if ip := net.ParseIP(name); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, l.ca, &key.PublicKey, l.caKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+func certTemplate(name string) *x509.Certificate {
+	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+}
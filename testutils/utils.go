@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/store"
 	// need to initialize sqlite for tests
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -32,14 +33,9 @@ func GetSqliteDB() *sql.DB {
 		panic("can't connect to db")
 	}
 	counter++
-	tx, err := conn.Begin()
-	if err != nil {
-		panic("can't begin db transaction")
+	if err := store.CreateSchema(conn); err != nil {
+		panic("can't create db schema")
 	}
-	tx.Exec("CREATE TABLE keys (id int auto_increment, namespace varchar(255) not null, role varchar(255) not null, key text not null, primary key (id));")
-	tx.Exec("CREATE TABLE filehashes(namespace varchar(255) not null, path varchar(255) not null, alg varchar(10) not null, hash varchar(128) not null, primary key (namespace, path, alg));")
-	tx.Exec("CREATE TABLE filemeta(namespace varchar(255) not null, path varchar(255) not null, size int not null, custom text default null, primary key (namespace, path));")
-	tx.Commit()
 	return conn
 }
 
@@ -49,6 +45,7 @@ func FlushDB(db *sql.DB) {
 	tx.Exec("DELETE FROM `filemeta`")
 	tx.Exec("DELETE FROM `filehashes`")
 	tx.Exec("DELETE FROM `keys`")
+	tx.Exec("DELETE FROM `tuf_meta`")
 	tx.Commit()
 	os.RemoveAll("/tmp/tuf")
 }
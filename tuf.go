@@ -12,10 +12,12 @@ import (
 	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/endophage/gotuf/clock"
 	"github.com/endophage/gotuf/data"
 	"github.com/endophage/gotuf/errors"
 	"github.com/endophage/gotuf/keys"
 	"github.com/endophage/gotuf/signed"
+	"github.com/endophage/gotuf/store"
 	"github.com/endophage/gotuf/utils"
 )
 
@@ -50,6 +52,16 @@ func (err ErrNotLoaded) Error() string {
 	return fmt.Sprintf("%s role has not been loaded", err.role)
 }
 
+// ErrInconsistentMeta - the metadata for a role does not match the meta
+// recorded for it in the snapshot (or for the snapshot, in the timestamp)
+type ErrInconsistentMeta struct {
+	role string
+}
+
+func (err ErrInconsistentMeta) Error() string {
+	return fmt.Sprintf("%s does not match the meta recorded for it, it may need to be re-signed", err.role)
+}
+
 // Repo is an in memory representation of the TUF Repo.
 // It operates at the data.Signed level, accepting and producing
 // data.Signed objects. Users of a Repo are responsible for
@@ -62,6 +74,11 @@ type Repo struct {
 	Timestamp     *data.SignedTimestamp
 	keysDB        *keys.KeyDB
 	cryptoService signed.CryptoService
+	metaHashes    []string
+	clock         clock.Clock
+	// signedRoots holds each root signed since the repo was last
+	// published, serialized, by version
+	signedRoots map[int][]byte
 }
 
 // NewRepo initializes a Repo instance with a keysDB and a signer.
@@ -71,10 +88,38 @@ func NewRepo(keysDB *keys.KeyDB, cryptoService signed.CryptoService) *Repo {
 		Targets:       make(map[string]*data.SignedTargets),
 		keysDB:        keysDB,
 		cryptoService: cryptoService,
+		clock:         clock.System,
+		signedRoots:   make(map[int][]byte),
 	}
 	return repo
 }
 
+// SetClock sets the clock the repo initializes default expiries from and
+// verifies imported metadata by. The system clock is used by default.
+func (tr *Repo) SetClock(c clock.Clock) {
+	tr.clock = c
+}
+
+// Clock returns the repo's clock
+func (tr *Repo) Clock() clock.Clock {
+	return tr.clock
+}
+
+// SetMetaHashAlgorithms sets the hash algorithms used to generate the meta
+// recorded for each role in the snapshot, and for the snapshot in the
+// timestamp. By default only sha256 is used. Clients verify metadata using
+// the strongest of the algorithms they also support, so older clients need
+// an algorithm they understand, such as sha256, to remain in the list.
+func (tr *Repo) SetMetaHashAlgorithms(algorithms ...string) error {
+	for _, alg := range algorithms {
+		if _, ok := data.GetHashAlgorithm(alg); !ok {
+			return utils.ErrUnknownHashAlgorithm{Name: alg}
+		}
+	}
+	tr.metaHashes = algorithms
+	return nil
+}
+
 // AddBaseKeys is used to add keys to the role in root.json
 func (tr *Repo) AddBaseKeys(role string, keys ...data.PublicKey) error {
 	if tr.Root == nil {
@@ -162,7 +207,16 @@ func (tr *Repo) RemoveBaseKeys(role string, keyIDs ...string) error {
 // An empty before string indicates to add the role to the end of the
 // delegation list.
 // A new, empty, targets file will be created for the new role.
+// Roles named "hashed-bins", and any beneath them, are reserved for
+// CreateHashedBins.
 func (tr *Repo) UpdateDelegations(role *data.Role, keys []data.Key, before string) error {
+	if reservedRoleName(role.Name) {
+		return errors.ErrInvalidRole{Role: role.Name}
+	}
+	return tr.updateDelegations(role, keys, before)
+}
+
+func (tr *Repo) updateDelegations(role *data.Role, keys []data.Key, before string) error {
 	if !role.IsDelegation() || !role.IsValid() {
 		return errors.ErrInvalidRole{}
 	}
@@ -180,16 +234,15 @@ func (tr *Repo) UpdateDelegations(role *data.Role, keys []data.Key, before strin
 		tr.keysDB.AddKey(key)
 	}
 
-	i := -1
-	var r *data.Role
-	for i, r = range p.Signed.Delegations.Roles {
+	found := false
+	for i, r := range p.Signed.Delegations.Roles {
 		if r.Name == role.Name {
+			p.Signed.Delegations.Roles[i] = role
+			found = true
 			break
 		}
 	}
-	if i >= 0 {
-		p.Signed.Delegations.Roles[i] = role
-	} else {
+	if !found {
 		p.Signed.Delegations.Roles = append(p.Signed.Delegations.Roles, role)
 	}
 	p.Dirty = true
@@ -243,6 +296,7 @@ func (tr *Repo) InitRoot(consistent bool) error {
 	if err != nil {
 		return err
 	}
+	root.Signed.Expires = data.DefaultExpiresAt(data.CanonicalRootRole, tr.clock.Now())
 	tr.Root = root
 	return nil
 }
@@ -250,6 +304,7 @@ func (tr *Repo) InitRoot(consistent bool) error {
 // InitTargets initializes an empty targets
 func (tr *Repo) InitTargets() error {
 	targets := data.NewTargets()
+	targets.Signed.Expires = data.DefaultExpiresAt(data.CanonicalTargetsRole, tr.clock.Now())
 	tr.Targets[data.ValidRoles["targets"]] = targets
 	return nil
 }
@@ -268,6 +323,7 @@ func (tr *Repo) InitSnapshot() error {
 	if err != nil {
 		return err
 	}
+	snapshot.Signed.Expires = data.DefaultExpiresAt(data.CanonicalSnapshotRole, tr.clock.Now())
 	tr.Snapshot = snapshot
 	return nil
 }
@@ -282,6 +338,7 @@ func (tr *Repo) InitTimestamp() error {
 	if err != nil {
 		return err
 	}
+	timestamp.Signed.Expires = data.DefaultExpiresAt(data.CanonicalTimestampRole, tr.clock.Now())
 
 	tr.Timestamp = timestamp
 	return nil
@@ -374,52 +431,134 @@ func (tr Repo) TargetDelegations(role, path, pathHex string) []*data.Role {
 	return roles
 }
 
-// FindTarget attempts to find the target represented by the given
-// path by starting at the top targets file and traversing
-// appropriate delegations until the first entry is found or it
-// runs out of locations to search.
-// N.B. Multiple entries may exist in different delegated roles
-//      for the same target. Only the first one encountered is returned.
-func (tr Repo) FindTarget(path string) *data.FileMeta {
+// Limits applied when walking the delegation tree to guard against
+// malicious or mistaken metadata causing unbounded work.
+const (
+	// MaxDelegationDepth is the deepest delegation, relative to the top
+	// level targets role, that will be inspected
+	MaxDelegationDepth = 32
+	// MaxDelegationsVisited is the maximum number of roles that will be
+	// inspected in a single search
+	MaxDelegationsVisited = 1024
+)
+
+// ErrDelegationLimit - searching for a target exceeded the maximum depth
+// or number of delegations allowed
+type ErrDelegationLimit struct {
+	path string
+}
+
+func (err ErrDelegationLimit) Error() string {
+	return fmt.Sprintf("delegation limit reached while searching for %s", err.path)
+}
+
+// WalkTargets searches for the target represented by the given path using a
+// pre-order depth first traversal of the delegation tree, starting at the
+// top level targets role. Delegations are followed in the order they appear
+// in the delegating role. If a matching delegation is marked terminating and
+// the target is not found beneath it, the search ends without considering
+// any other delegations. Roles are visited at most once.
+// If load is non-nil it is called with each role's name before the role is
+// inspected, allowing the role to be fetched lazily. A role for which load
+// returns an errors.ErrMissingMetadata does not exist and is skipped. Any
+// other error from load ends the search and is returned, so a role that
+// fails verification never lets a lower priority delegation be searched.
+// The name of the role the target was found in is returned alongside its
+// meta.
+func (tr Repo) WalkTargets(path string, load func(role string) error) (*data.FileMeta, string, error) {
 	pathDigest := sha256.Sum256([]byte(path))
 	pathHex := hex.EncodeToString(pathDigest[:])
-
-	var walkTargets func(role string) *data.FileMeta
-	walkTargets = func(role string) *data.FileMeta {
+	visited := make(map[string]struct{})
+
+	// visit returns stop == true if the search should not continue
+	var visit func(role string, depth int) (meta *data.FileMeta, found string, stop bool, err error)
+	visit = func(role string, depth int) (*data.FileMeta, string, bool, error) {
+		if _, ok := visited[role]; ok {
+			logrus.Debugf("skipping %s, it has already been visited", role)
+			return nil, "", false, nil
+		}
+		if depth > MaxDelegationDepth || len(visited) >= MaxDelegationsVisited {
+			return nil, "", true, ErrDelegationLimit{path: path}
+		}
+		visited[role] = struct{}{}
+
+		if load != nil {
+			if err := load(role); err != nil {
+				if _, ok := err.(errors.ErrMissingMetadata); !ok {
+					return nil, "", true, err
+				}
+				logrus.Debugf("skipping %s, it does not exist: %s", role, err)
+				return nil, "", false, nil
+			}
+		}
 		if m := tr.TargetMeta(role, path); m != nil {
-			return m
+			return m, role, true, nil
 		}
-		// Depth first search of delegations based on order
-		// as presented in current targets file for role:
 		for _, r := range tr.TargetDelegations(role, path, pathHex) {
-			if m := walkTargets(r.Name); m != nil {
-				return m
+			m, found, stop, err := visit(r.Name, depth+1)
+			if m != nil || stop || err != nil {
+				return m, found, true, err
+			}
+			if r.Terminating {
+				logrus.Debugf("%s is a terminating delegation, ending search for %s", r.Name, path)
+				return nil, "", true, nil
 			}
 		}
-		return nil
+		return nil, "", false, nil
 	}
 
-	return walkTargets("targets")
+	m, found, _, err := visit(data.ValidRoles["targets"], 0)
+	return m, found, err
+}
+
+// FindTarget attempts to find the target represented by the given
+// path by starting at the top targets file and traversing
+// appropriate delegations until the first entry is found or it
+// runs out of locations to search. See WalkTargets for the order
+// delegations are searched in.
+// N.B. Multiple entries may exist in different delegated roles
+//      for the same target. Only the first one encountered is returned.
+func (tr Repo) FindTarget(path string) *data.FileMeta {
+	m, _, err := tr.WalkTargets(path, nil)
+	if err != nil {
+		logrus.Debug(err)
+		return nil
+	}
+	return m
 }
 
 // AddTargets will attempt to add the given targets specifically to
-// the directed role. If the user does not have the signing keys for the role
-// the function will return an error and the full slice of targets.
+// the directed role, or if the role has been split into hashed bins
+// (see CreateHashedBins), to the bin responsible for each target. If
+// the user does not have the signing keys for the role the function
+// will return an error and the full slice of targets.
 func (tr *Repo) AddTargets(role string, targets data.Files) (data.Files, error) {
 	t, ok := tr.Targets[role]
 	if !ok {
 		return targets, errors.ErrInvalidRole{Role: role}
 	}
+	bins := tr.hashedBins(role)
 	invalid := make(data.Files)
 	for path, target := range targets {
 		pathDigest := sha256.Sum256([]byte(path))
 		pathHex := hex.EncodeToString(pathDigest[:])
 		r := tr.keysDB.GetRole(role)
-		if role == data.ValidRoles["targets"] || (r.CheckPaths(path) || r.CheckPrefixes(pathHex)) {
-			t.Signed.Targets[path] = target
-		} else {
+		if !(role == data.ValidRoles["targets"] || (r.CheckPaths(path) || r.CheckPrefixes(pathHex))) {
 			invalid[path] = target
+			continue
 		}
+		dest := t
+		if len(bins) > 0 {
+			// the role has been split into hashed bins, the target belongs
+			// in whichever bin is responsible for it
+			dest = tr.binTargets(bins, pathHex)
+			if dest == nil {
+				invalid[path] = target
+				continue
+			}
+		}
+		dest.Signed.Targets[path] = target
+		dest.Dirty = true
 	}
 	t.Dirty = true
 	if len(invalid) > 0 {
@@ -428,15 +567,25 @@ func (tr *Repo) AddTargets(role string, targets data.Files) (data.Files, error)
 	return nil, nil
 }
 
-// RemoveTargets removes the given target (paths) from the given target role (delegation)
+// RemoveTargets removes the given target (paths) from the given target role (delegation).
+// If the role has been split into hashed bins the targets are also removed
+// from the bins responsible for them.
 func (tr *Repo) RemoveTargets(role string, targets ...string) error {
 	t, ok := tr.Targets[role]
 	if !ok {
 		return errors.ErrInvalidRole{Role: role}
 	}
 
+	bins := tr.hashedBins(role)
 	for _, path := range targets {
 		delete(t.Signed.Targets, path)
+		if len(bins) > 0 {
+			pathDigest := sha256.Sum256([]byte(path))
+			if bt := tr.binTargets(bins, hex.EncodeToString(pathDigest[:])); bt != nil {
+				delete(bt.Signed.Targets, path)
+				bt.Dirty = true
+			}
+		}
 	}
 	t.Dirty = true
 	return nil
@@ -448,7 +597,7 @@ func (tr *Repo) UpdateSnapshot(role string, s *data.Signed) error {
 	if err != nil {
 		return err
 	}
-	meta, err := data.NewFileMeta(bytes.NewReader(jsonData), "sha256")
+	meta, err := tr.signedFileMeta(s, jsonData)
 	if err != nil {
 		return err
 	}
@@ -463,7 +612,7 @@ func (tr *Repo) UpdateTimestamp(s *data.Signed) error {
 	if err != nil {
 		return err
 	}
-	meta, err := data.NewFileMeta(bytes.NewReader(jsonData), "sha256")
+	meta, err := tr.signedFileMeta(s, jsonData)
 	if err != nil {
 		return err
 	}
@@ -472,6 +621,21 @@ func (tr *Repo) UpdateTimestamp(s *data.Signed) error {
 	return nil
 }
 
+// signedFileMeta generates the FileMeta for the serialized metadata
+// jsonData, including the version of s
+func (tr *Repo) signedFileMeta(s *data.Signed, jsonData []byte) (data.FileMeta, error) {
+	meta, err := data.NewFileMeta(bytes.NewReader(jsonData), tr.metaHashes...)
+	if err != nil {
+		return data.FileMeta{}, err
+	}
+	common := data.SignedCommon{}
+	if err := json.Unmarshal(s.Signed, &common); err != nil {
+		return data.FileMeta{}, err
+	}
+	meta.Version = common.Version
+	return meta, nil
+}
+
 // SignRoot signs the root
 func (tr *Repo) SignRoot(expires time.Time, cryptoService signed.CryptoService) (*data.Signed, error) {
 	logrus.Debug("signing root...")
@@ -487,6 +651,12 @@ func (tr *Repo) SignRoot(expires time.Time, cryptoService signed.CryptoService)
 		return nil, err
 	}
 	tr.Root.Signatures = signed.Signatures
+	// kept so that Publish can write every version of the root
+	raw, err := json.Marshal(signed)
+	if err != nil {
+		return nil, err
+	}
+	tr.signedRoots[tr.Root.Signed.Version] = raw
 	return signed, nil
 }
 
@@ -595,3 +765,119 @@ func (tr Repo) sign(signedData *data.Signed, role data.Role, cryptoService signe
 	}
 	return signedData, nil
 }
+
+// Publish serializes the signed metadata for every role and writes it to
+// the metaStore in a single SetMultiMeta. When the root enables consistent
+// snapshots, every role except the timestamp is additionally written under
+// each of its hash prefixed names (see utils.HashedPaths) so old and new
+// versions of the repo can be served at the same time. Every root signed
+// since the last Publish, and the current root, is also written as
+// <version>.root so that clients can walk the chain of root rotations.
+// The returned map contains, for every target in every targets role, the
+// hash prefixed paths the target must also be made available at. It is
+// nil if consistent snapshots are not enabled.
+func (tr *Repo) Publish(metaStore store.MetadataStore) (map[string][]string, error) {
+	if tr.Root == nil {
+		return nil, ErrNotLoaded{role: "root"}
+	}
+	if tr.Snapshot == nil {
+		return nil, ErrNotLoaded{role: "snapshot"}
+	}
+	if tr.Timestamp == nil {
+		return nil, ErrNotLoaded{role: "timestamp"}
+	}
+	consistent := tr.Root.Signed.ConsistentSnapshot
+	metas := make(map[string][]byte)
+
+	// snapshotted maps each role to the meta its parent recorded for it
+	snapshotRole := data.ValidRoles["snapshot"]
+	snapshotted := make(map[string]data.FileMeta)
+	addMeta := func(role string, s *data.Signed, parent data.Files) error {
+		if len(s.Signatures) == 0 {
+			return errors.ErrInsufficientSignatures{Name: role, Err: signed.ErrNoSignatures}
+		}
+		raw, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		metas[role] = raw
+		if !consistent {
+			return nil
+		}
+		expected, ok := parent[role]
+		if !ok {
+			return errors.ErrMissingMetadata{Name: role}
+		}
+		if err := utils.CheckHashes(raw, expected); err != nil {
+			logrus.Debugf("%s did not match recorded meta: %s", role, err)
+			return ErrInconsistentMeta{role: role}
+		}
+		snapshotted[role] = expected
+		return nil
+	}
+
+	root, err := tr.Root.ToSigned()
+	if err != nil {
+		return nil, err
+	}
+	if err := addMeta(data.ValidRoles["root"], root, tr.Snapshot.Signed.Meta); err != nil {
+		return nil, err
+	}
+	for version, raw := range tr.signedRoots {
+		metas[versionedRootName(version)] = raw
+	}
+	metas[versionedRootName(tr.Root.Signed.Version)] = metas[data.ValidRoles["root"]]
+	for role, t := range tr.Targets {
+		targets, err := t.ToSigned()
+		if err != nil {
+			return nil, err
+		}
+		if err := addMeta(role, targets, tr.Snapshot.Signed.Meta); err != nil {
+			return nil, err
+		}
+	}
+	snapshot, err := tr.Snapshot.ToSigned()
+	if err != nil {
+		return nil, err
+	}
+	if err := addMeta(snapshotRole, snapshot, tr.Timestamp.Signed.Meta); err != nil {
+		return nil, err
+	}
+	timestamp, err := tr.Timestamp.ToSigned()
+	if err != nil {
+		return nil, err
+	}
+	if len(timestamp.Signatures) == 0 {
+		return nil, errors.ErrInsufficientSignatures{Name: "timestamp", Err: signed.ErrNoSignatures}
+	}
+	metas[data.ValidRoles["timestamp"]], err = json.Marshal(timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	var targetPaths map[string][]string
+	if consistent {
+		for role, meta := range snapshotted {
+			for _, p := range utils.HashedPaths(role, meta.Hashes) {
+				metas[p] = metas[role]
+			}
+		}
+		targetPaths = make(map[string][]string)
+		for _, t := range tr.Targets {
+			for path, meta := range t.Signed.Targets {
+				targetPaths[path] = utils.HashedPaths(path, meta.Hashes)
+			}
+		}
+	}
+	if err := metaStore.SetMultiMeta(metas); err != nil {
+		return nil, err
+	}
+	tr.signedRoots = make(map[int][]byte)
+	return targetPaths, nil
+}
+
+// versionedRootName is the name the given version of the root is
+// published under
+func versionedRootName(version int) string {
+	return fmt.Sprintf("%d.%s", version, data.ValidRoles["root"])
+}
@@ -1,7 +1,11 @@
 package tuf
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
@@ -9,8 +13,12 @@ import (
 	"testing"
 
 	"github.com/endophage/gotuf/data"
+	"github.com/endophage/gotuf/errors"
 	"github.com/endophage/gotuf/keys"
 	"github.com/endophage/gotuf/signed"
+	"github.com/endophage/gotuf/store"
+	"github.com/endophage/gotuf/utils"
+	"github.com/stretchr/testify/assert"
 )
 
 func initRepo(t *testing.T, cryptoService signed.CryptoService, keyDB *keys.KeyDB) *Repo {
@@ -163,3 +171,390 @@ func TestUpdateDelegations(t *testing.T) {
 
 	writeRepo(t, "/tmp/tufdelegation", repo)
 }
+
+func signAll(t *testing.T, repo *Repo) {
+	_, err := repo.SignRoot(data.DefaultExpires("root"), nil)
+	assert.NoError(t, err)
+	for r := range repo.Targets {
+		_, err := repo.SignTargets(r, data.DefaultExpires("targets"), nil)
+		assert.NoError(t, err)
+	}
+	_, err = repo.SignSnapshot(data.DefaultExpires("snapshot"), nil)
+	assert.NoError(t, err)
+	_, err = repo.SignTimestamp(data.DefaultExpires("timestamp"), nil)
+	assert.NoError(t, err)
+}
+
+func TestPublishConsistent(t *testing.T) {
+	ed25519 := signed.NewEd25519()
+	keyDB := keys.NewDB()
+	repo := initRepo(t, ed25519, keyDB)
+	repo.Root.Signed.ConsistentSnapshot = true
+
+	content := []byte("target content")
+	meta, err := data.NewFileMeta(bytes.NewReader(content), "sha256", "sha512")
+	assert.NoError(t, err)
+	_, err = repo.AddTargets("targets", data.Files{"foo/bar.txt": meta})
+	assert.NoError(t, err)
+
+	signAll(t, repo)
+
+	metaStore := store.NewMemoryStore(nil, nil)
+	targetPaths, err := repo.Publish(metaStore)
+	assert.NoError(t, err)
+
+	for _, role := range []string{"root", "targets", "snapshot"} {
+		raw, err := metaStore.GetMeta(role, 5<<20)
+		assert.NoError(t, err)
+		digest := sha256.Sum256(raw)
+		hashed, err := metaStore.GetMeta(hex.EncodeToString(digest[:])+"."+role, 5<<20)
+		assert.NoError(t, err, "missing consistent copy of %s", role)
+		assert.Equal(t, raw, hashed)
+	}
+	_, err = metaStore.GetMeta("timestamp", 5<<20)
+	assert.NoError(t, err)
+
+	sha256Digest := sha256.Sum256(content)
+	assert.Len(t, targetPaths["foo/bar.txt"], 2)
+	assert.Contains(t, targetPaths["foo/bar.txt"], "foo/"+hex.EncodeToString(sha256Digest[:])+".bar.txt")
+}
+
+func TestPublishNotConsistent(t *testing.T) {
+	ed25519 := signed.NewEd25519()
+	keyDB := keys.NewDB()
+	repo := initRepo(t, ed25519, keyDB)
+	signAll(t, repo)
+
+	metas := make(map[string][]byte)
+	targetPaths, err := repo.Publish(store.NewMemoryStore(metas, nil))
+	assert.NoError(t, err)
+	assert.Nil(t, targetPaths)
+	assert.Len(t, metas, 5)
+	assert.Equal(t, metas["root"], metas["1.root"])
+}
+
+func TestPublishRootVersions(t *testing.T) {
+	ed25519 := signed.NewEd25519()
+	keyDB := keys.NewDB()
+	repo := initRepo(t, ed25519, keyDB)
+	signAll(t, repo)
+	metaStore := store.NewMemoryStore(nil, nil)
+	_, err := repo.Publish(metaStore)
+	assert.NoError(t, err)
+
+	// a root signed but superseded before being published is written too
+	_, err = repo.SignRoot(data.DefaultExpires("root"), nil)
+	assert.NoError(t, err)
+	signAll(t, repo)
+	_, err = repo.Publish(metaStore)
+	assert.NoError(t, err)
+
+	for version := 1; version <= 3; version++ {
+		raw, err := metaStore.GetMeta(fmt.Sprintf("%d.root", version), 5<<20)
+		assert.NoError(t, err)
+		root := &data.SignedRoot{}
+		assert.NoError(t, json.Unmarshal(raw, root))
+		assert.Equal(t, version, root.Signed.Version)
+	}
+	latest, err := metaStore.GetMeta("3.root", 5<<20)
+	assert.NoError(t, err)
+	current, err := metaStore.GetMeta("root", 5<<20)
+	assert.NoError(t, err)
+	assert.Equal(t, current, latest)
+}
+
+func TestPublishStaleSnapshot(t *testing.T) {
+	ed25519 := signed.NewEd25519()
+	keyDB := keys.NewDB()
+	repo := initRepo(t, ed25519, keyDB)
+	repo.Root.Signed.ConsistentSnapshot = true
+	signAll(t, repo)
+
+	// re-sign targets without updating the snapshot
+	_, err := repo.SignTargets("targets", data.DefaultExpires("targets"), nil)
+	assert.NoError(t, err)
+
+	_, err = repo.Publish(store.NewMemoryStore(nil, nil))
+	assert.IsType(t, ErrInconsistentMeta{}, err)
+}
+
+func TestSignedFileMetaVersion(t *testing.T) {
+	ed25519 := signed.NewEd25519()
+	keyDB := keys.NewDB()
+	repo := initRepo(t, ed25519, keyDB)
+	signAll(t, repo)
+	signAll(t, repo)
+
+	assert.Equal(t, repo.Root.Signed.Version, repo.Snapshot.Signed.Meta["root"].Version)
+	assert.Equal(t, repo.Targets["targets"].Signed.Version, repo.Snapshot.Signed.Meta["targets"].Version)
+	assert.Equal(t, repo.Snapshot.Signed.Version, repo.Timestamp.Signed.Meta["snapshot"].Version)
+	assert.Equal(t, 2, repo.Timestamp.Signed.Meta["snapshot"].Version)
+}
+
+func TestSetMetaHashAlgorithms(t *testing.T) {
+	ed25519 := signed.NewEd25519()
+	keyDB := keys.NewDB()
+	repo := initRepo(t, ed25519, keyDB)
+	repo.Root.Signed.ConsistentSnapshot = true
+
+	assert.IsType(t, utils.ErrUnknownHashAlgorithm{}, repo.SetMetaHashAlgorithms("sha256", "md5"))
+	assert.NoError(t, repo.SetMetaHashAlgorithms("sha256", "blake2b"))
+	signAll(t, repo)
+
+	for _, meta := range []data.FileMeta{
+		repo.Snapshot.Signed.Meta["root"],
+		repo.Snapshot.Signed.Meta["targets"],
+		repo.Timestamp.Signed.Meta["snapshot"],
+	} {
+		assert.Len(t, meta.Hashes, 2)
+		assert.Len(t, meta.Hashes["blake2b"], 64)
+	}
+
+	// both hashes are used to name the consistent copies
+	metaStore := store.NewMemoryStore(nil, nil)
+	_, err := repo.Publish(metaStore)
+	assert.NoError(t, err)
+	for alg, hash := range repo.Snapshot.Signed.Meta["targets"].Hashes {
+		_, err := metaStore.GetMeta(hex.EncodeToString(hash)+".targets", 5<<20)
+		assert.NoError(t, err, alg)
+	}
+}
+
+// delegate adds a delegation from parent to a new, empty, role without
+// going through the key handling of UpdateDelegations
+func delegate(t *testing.T, repo *Repo, parent, name string, terminating bool, paths ...string) {
+	role, err := data.NewRole(name, 1, nil, paths, nil)
+	assert.NoError(t, err)
+	role.Terminating = terminating
+	p := repo.Targets[parent]
+	p.Signed.Delegations.Roles = append(p.Signed.Delegations.Roles, role)
+	if _, ok := repo.Targets[name]; !ok {
+		repo.Targets[name] = data.NewTargets()
+	}
+}
+
+func TestWalkTargetsPreOrder(t *testing.T) {
+	repo := initRepo(t, signed.NewEd25519(), keys.NewDB())
+	delegate(t, repo, "targets", "targets/a", false, "foo")
+	delegate(t, repo, "targets", "targets/b", false, "foo")
+	delegate(t, repo, "targets/a", "targets/a/c", false, "foo")
+
+	repo.Targets["targets/b"].AddTarget("foo/x", data.FileMeta{Length: 2})
+	repo.Targets["targets/a/c"].AddTarget("foo/x", data.FileMeta{Length: 3})
+
+	// the first delegation's subtree is searched before the second delegation
+	meta, role, err := repo.WalkTargets("foo/x", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "targets/a/c", role)
+	assert.Equal(t, int64(3), meta.Length)
+	assert.Equal(t, meta, repo.FindTarget("foo/x"))
+
+	loaded := []string{}
+	_, _, err = repo.WalkTargets("foo/x", func(role string) error {
+		loaded = append(loaded, role)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"targets", "targets/a", "targets/a/c"}, loaded)
+}
+
+func TestWalkTargetsTerminating(t *testing.T) {
+	repo := initRepo(t, signed.NewEd25519(), keys.NewDB())
+	delegate(t, repo, "targets", "targets/a", true, "foo")
+	delegate(t, repo, "targets", "targets/b", false, "foo")
+	repo.Targets["targets/b"].AddTarget("foo/x", data.FileMeta{Length: 2})
+
+	meta, _, err := repo.WalkTargets("foo/x", nil)
+	assert.NoError(t, err)
+	assert.Nil(t, meta, "search should have stopped at the terminating delegation")
+
+	// a terminating delegation that doesn't match the path has no effect
+	repo.Targets["targets"].Signed.Delegations.Roles[0].Paths = []string{"bar"}
+	meta, role, err := repo.WalkTargets("foo/x", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "targets/b", role)
+	assert.Equal(t, int64(2), meta.Length)
+}
+
+func TestWalkTargetsLoadErrors(t *testing.T) {
+	repo := initRepo(t, signed.NewEd25519(), keys.NewDB())
+	delegate(t, repo, "targets", "targets/a", false, "foo")
+	delegate(t, repo, "targets", "targets/b", false, "foo")
+	repo.Targets["targets/b"].AddTarget("foo/x", data.FileMeta{Length: 2})
+
+	// a role that does not exist is skipped
+	meta, role, err := repo.WalkTargets("foo/x", func(role string) error {
+		if role == "targets/a" {
+			return errors.ErrMissingMetadata{Name: role}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "targets/b", role)
+	assert.Equal(t, int64(2), meta.Length)
+
+	// but any other failure ends the search
+	failure := fmt.Errorf("targets/a failed verification")
+	meta, _, err = repo.WalkTargets("foo/x", func(role string) error {
+		if role == "targets/a" {
+			return failure
+		}
+		return nil
+	})
+	assert.Equal(t, failure, err)
+	assert.Nil(t, meta)
+}
+
+func TestWalkTargetsCycle(t *testing.T) {
+	repo := initRepo(t, signed.NewEd25519(), keys.NewDB())
+	delegate(t, repo, "targets", "targets/a", false, "foo")
+	delegate(t, repo, "targets/a", "targets", false, "foo")
+	delegate(t, repo, "targets/a", "targets/b", false, "foo")
+	repo.Targets["targets/b"].AddTarget("foo/x", data.FileMeta{Length: 2})
+
+	meta, role, err := repo.WalkTargets("foo/x", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "targets/b", role)
+	assert.Equal(t, int64(2), meta.Length)
+}
+
+func TestWalkTargetsDepthLimit(t *testing.T) {
+	repo := initRepo(t, signed.NewEd25519(), keys.NewDB())
+	parent := "targets"
+	for i := 0; i <= MaxDelegationDepth; i++ {
+		name := parent + "/d"
+		delegate(t, repo, parent, name, false, "foo")
+		parent = name
+	}
+	repo.Targets[parent].AddTarget("foo/x", data.FileMeta{Length: 2})
+
+	meta, _, err := repo.WalkTargets("foo/x", nil)
+	assert.IsType(t, ErrDelegationLimit{}, err)
+	assert.Nil(t, meta)
+	assert.Nil(t, repo.FindTarget("foo/x"))
+}
+
+func TestCreateHashedBins(t *testing.T) {
+	cs := signed.NewEd25519()
+	repo := initRepo(t, cs, keys.NewDB())
+	binKey, err := cs.Create("targets/bins", data.ED25519Key)
+	assert.NoError(t, err)
+
+	repo.Targets["targets"].AddTarget("existing", data.FileMeta{Length: 1})
+	err = repo.CreateHashedBins("targets", 4, []data.PublicKey{binKey}, 1)
+	assert.NoError(t, err)
+
+	bins := repo.hashedBins("targets")
+	assert.Len(t, bins, 4)
+	assert.Equal(t, "targets/hashed-bins/bin-0-3", bins[0].Name)
+	assert.Equal(t, []string{"0", "1", "2", "3"}, bins[0].PathHashPrefixes)
+	assert.Equal(t, []string{binKey.ID()}, bins[0].KeyIDs)
+	assert.Empty(t, repo.Targets["targets"].Signed.Targets)
+	assert.NotNil(t, repo.FindTarget("existing"))
+
+	paths := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	files := make(data.Files)
+	for i, p := range paths {
+		files[p] = data.FileMeta{Length: int64(i)}
+	}
+	invalid, err := repo.AddTargets("targets", files)
+	assert.NoError(t, err)
+	assert.Nil(t, invalid)
+	assert.Empty(t, repo.Targets["targets"].Signed.Targets)
+	for _, p := range paths {
+		meta, role, err := repo.WalkTargets(p, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, files[p], *meta)
+		pathDigest := sha256.Sum256([]byte(p))
+		r := repo.keysDB.GetRole(role)
+		assert.True(t, r.CheckPrefixes(hex.EncodeToString(pathDigest[:])))
+	}
+
+	assert.NoError(t, repo.RemoveTargets("targets", "a"))
+	assert.Nil(t, repo.FindTarget("a"))
+	assert.NotNil(t, repo.FindTarget("b"))
+
+	// a delegation named like a bin is not one
+	userKey, err := cs.Create("targets/bin-user", data.ED25519Key)
+	assert.NoError(t, err)
+	userRole, err := data.NewRole("targets/bin-0-3", 1, nil, nil, []string{"0"})
+	assert.NoError(t, err)
+	assert.NoError(t, repo.UpdateDelegations(userRole, []data.Key{userKey}, ""))
+	assert.Len(t, repo.hashedBins("targets"), 4)
+
+	// re-binning moves every target to the new bins and drops the old ones
+	binKey2, err := cs.Create("targets/bins", data.ED25519Key)
+	assert.NoError(t, err)
+	err = repo.CreateHashedBins("targets", 32, []data.PublicKey{binKey2}, 1)
+	assert.NoError(t, err)
+	bins = repo.hashedBins("targets")
+	assert.Len(t, bins, 32)
+	assert.Equal(t, "targets/hashed-bins/bin-00-07", bins[0].Name)
+	assert.Len(t, repo.Targets["targets/hashed-bins"].Signed.Delegations.Roles, 32)
+	_, ok := repo.Targets["targets/hashed-bins/bin-0-3"]
+	assert.False(t, ok)
+	assert.Nil(t, repo.keysDB.GetRole("targets/hashed-bins/bin-0-3"))
+	assert.Nil(t, repo.keysDB.GetKey(binKey.ID()))
+	assert.NotNil(t, repo.keysDB.GetKey(binKey2.ID()))
+	for _, p := range append(paths[1:], "existing") {
+		assert.NotNil(t, repo.FindTarget(p), p)
+	}
+	_, ok = repo.Targets["targets/bin-0-3"]
+	assert.True(t, ok)
+	assert.NotNil(t, repo.keysDB.GetKey(userKey.ID()))
+	assert.Len(t, repo.Targets["targets"].Signed.Delegations.Roles, 2)
+	assert.Len(t, repo.Targets["targets"].Signed.Delegations.Keys, 2)
+
+	err = repo.CreateHashedBins("targets", 256, []data.PublicKey{binKey2}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "targets/hashed-bins/bin-00", repo.hashedBins("targets")[0].Name)
+
+	// the bins' delegation is reserved
+	reserved, err := data.NewRole("targets/hashed-bins", 1, nil, []string{""}, nil)
+	assert.NoError(t, err)
+	assert.IsType(t, errors.ErrInvalidRole{}, repo.UpdateDelegations(reserved, nil, ""))
+}
+
+func TestCreateHashedBinsInvalidCount(t *testing.T) {
+	repo := initRepo(t, signed.NewEd25519(), keys.NewDB())
+	for _, n := range []int{0, 3, MaxHashedBins * 2} {
+		err := repo.CreateHashedBins("targets", n, nil, 1)
+		assert.Equal(t, ErrInvalidBinCount{count: n}, err)
+	}
+}
+
+func TestCreateHashedBinsVersions(t *testing.T) {
+	cs := signed.NewEd25519()
+	repo := initRepo(t, cs, keys.NewDB())
+	binKey, err := cs.Create("targets/bins", data.ED25519Key)
+	assert.NoError(t, err)
+	binKeys := []data.PublicKey{binKey}
+
+	assert.NoError(t, repo.CreateHashedBins("targets", 16, binKeys, 1))
+	for i := 0; i < 3; i++ {
+		_, err = repo.SignTargets("targets/hashed-bins/bin-0", data.DefaultExpires("targets"), nil)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 3, repo.Targets["targets/hashed-bins/bin-0"].Signed.Version)
+
+	// splitting again reuses the name bin-0 at no lower version than it had
+	assert.NoError(t, repo.CreateHashedBins("targets", 256, binKeys, 1))
+	assert.Equal(t, 3, repo.Targets["targets/hashed-bins"].Signed.Version)
+	assert.NoError(t, repo.CreateHashedBins("targets", 16, binKeys, 1))
+	_, err = repo.SignTargets("targets/hashed-bins/bin-0", data.DefaultExpires("targets"), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, repo.Targets["targets/hashed-bins/bin-0"].Signed.Version)
+}
+
+func TestCreateHashedBinsInvalidThreshold(t *testing.T) {
+	cs := signed.NewEd25519()
+	repo := initRepo(t, cs, keys.NewDB())
+	binKey, err := cs.Create("targets/bins", data.ED25519Key)
+	assert.NoError(t, err)
+	assert.NoError(t, repo.CreateHashedBins("targets", 4, []data.PublicKey{binKey}, 1))
+
+	// a threshold the keys cannot meet leaves the existing bins in place
+	err = repo.CreateHashedBins("targets", 16, []data.PublicKey{binKey}, 2)
+	assert.Equal(t, keys.ErrInvalidThreshold, err)
+	assert.Len(t, repo.hashedBins("targets"), 4)
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"bytes"
 	"crypto/hmac"
 	"encoding/hex"
 	"errors"
@@ -60,26 +61,38 @@ func (e ErrUnknownHashAlgorithm) Error() string {
 // PassphraseFunc type for func that request a passphrase
 type PassphraseFunc func(role string, confirm bool) ([]byte, error)
 
-// FileMetaEqual checks whether 2 FileMeta objects are consistent with eachother
+// FileMetaEqual checks whether 2 FileMeta objects are consistent with eachother.
+// Only the strongest hash algorithm the two have in common is compared,
+// algorithms that have not been registered with data.RegisterHashAlgorithm
+// are ignored.
 func FileMetaEqual(actual data.FileMeta, expected data.FileMeta) error {
 	if actual.Length != expected.Length {
 		return ErrWrongLength
 	}
-	hashChecked := false
-	for typ, hash := range expected.Hashes {
-		if h, ok := actual.Hashes[typ]; ok {
-			hashChecked = true
-			if !hmac.Equal(h, hash) {
-				return ErrWrongHash{typ, hash, h}
-			}
-		}
-	}
-	if !hashChecked {
+	typ, ok := data.StrongestHash(expected.Hashes, actual.Hashes)
+	if !ok {
 		return ErrNoCommonHash{expected.Hashes, actual.Hashes}
 	}
+	if !hmac.Equal(actual.Hashes[typ], expected.Hashes[typ]) {
+		return ErrWrongHash{typ, expected.Hashes[typ], actual.Hashes[typ]}
+	}
 	return nil
 }
 
+// CheckHashes ensures raw matches the expected meta, hashing raw with the
+// strongest algorithm the expected meta provides
+func CheckHashes(raw []byte, expected data.FileMeta) error {
+	alg, ok := data.StrongestHash(expected.Hashes)
+	if !ok {
+		return ErrNoCommonHash{Expected: expected.Hashes}
+	}
+	actual, err := data.NewFileMeta(bytes.NewReader(raw), alg)
+	if err != nil {
+		return err
+	}
+	return FileMetaEqual(actual, expected)
+}
+
 // NormalizeTarget adds a slash, if required, to the front of a target path
 func NormalizeTarget(path string) string {
 	return gopath.Join("/", path)
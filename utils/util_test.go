@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"bytes"
 	"encoding/hex"
 	"testing"
 
@@ -43,6 +44,18 @@ func TestFileMetaEqual(t *testing.T) {
 			b:    fileMeta(10, map[string]string{"sha512": "111111", "sha256": "333333"}),
 			err:  func(test) error { return nil },
 		},
+		{
+			name: "strongest common hash compared",
+			a:    fileMeta(10, map[string]string{"sha256": "111111", "sha512": "222222", "blake2b": "333333"}),
+			b:    fileMeta(10, map[string]string{"sha256": "111111", "sha512": "444444"}),
+			err:  func(t test) error { return ErrWrongHash{"sha512", t.b.Hashes["sha512"], t.a.Hashes["sha512"]} },
+		},
+		{
+			name: "unsupported hashes ignored",
+			a:    fileMeta(10, map[string]string{"md5": "111111"}),
+			b:    fileMeta(10, map[string]string{"md5": "111111"}),
+			err:  func(t test) error { return ErrNoCommonHash{t.b.Hashes, t.a.Hashes} },
+		},
 		{
 			name: "no common hashes",
 			a:    fileMeta(10, map[string]string{"sha512": "111111"}),
@@ -55,6 +68,18 @@ func TestFileMetaEqual(t *testing.T) {
 	}
 }
 
+func TestCheckHashes(t *testing.T) {
+	raw := []byte("some metadata")
+	meta, err := data.NewFileMeta(bytes.NewReader(raw), "sha256", "sha512")
+	assert.NoError(t, err)
+	assert.NoError(t, CheckHashes(raw, meta))
+
+	assert.Equal(t, ErrWrongLength, CheckHashes([]byte("other metadata"), meta))
+	assert.IsType(t, ErrWrongHash{}, CheckHashes([]byte("more metadata"), meta))
+	unknown := data.FileMeta{Length: meta.Length, Hashes: data.Hashes{"md5": []byte{0}}}
+	assert.IsType(t, ErrNoCommonHash{}, CheckHashes(raw, unknown))
+}
+
 func TestNormalizeTarget(t *testing.T) {
 	for before, after := range map[string]string{
 		"":                    "/",
@@ -2,8 +2,6 @@ package utils
 
 import (
 	"bytes"
-	"crypto/sha256"
-	"crypto/sha512"
 	"crypto/tls"
 	"fmt"
 	"io"
@@ -34,19 +32,21 @@ func Upload(url string, body io.Reader) (*http.Response, error) {
 }
 
 // ValidateTarget ensures that the data read from reader matches
-// the known metadata
+// the known metadata, using the strongest hash the metadata provides
 func ValidateTarget(r io.Reader, m *data.FileMeta) error {
-	h := sha256.New()
-	length, err := io.Copy(h, r)
+	typ, ok := data.StrongestHash(m.Hashes)
+	if !ok {
+		return fmt.Errorf("Targets entry has no supported hash")
+	}
+	actual, err := data.NewFileMeta(r, typ)
 	if err != nil {
 		return err
 	}
-	if length != m.Length {
-		return fmt.Errorf("Size of downloaded target did not match targets entry.\nExpected: %d\nReceived: %d\n", m.Length, length)
+	if actual.Length != m.Length {
+		return fmt.Errorf("Size of downloaded target did not match targets entry.\nExpected: %d\nReceived: %d\n", m.Length, actual.Length)
 	}
-	hashDigest := h.Sum(nil)
-	if bytes.Compare(m.Hashes["sha256"], hashDigest[:]) != 0 {
-		return fmt.Errorf("Hash of downloaded target did not match targets entry.\nExpected: %x\nReceived: %x\n", m.Hashes["sha256"], hashDigest)
+	if !bytes.Equal(m.Hashes[typ], actual.Hashes[typ]) {
+		return fmt.Errorf("Hash of downloaded target did not match targets entry.\nExpected: %x\nReceived: %x\n", m.Hashes[typ], actual.Hashes[typ])
 	}
 	return nil
 }
@@ -93,15 +93,13 @@ func (nc *NoopCloser) Close() error {
 }
 
 // DoHash returns the digest of d using the hashing algorithm named
-// in alg
+// in alg, or nil if alg has not been registered
 func DoHash(alg string, d []byte) []byte {
-	switch alg {
-	case "sha256":
-		digest := sha256.Sum256(d)
-		return digest[:]
-	case "sha512":
-		digest := sha512.Sum512(d)
-		return digest[:]
+	a, ok := data.GetHashAlgorithm(alg)
+	if !ok {
+		return nil
 	}
-	return nil
+	h := a.New()
+	h.Write(d)
+	return h.Sum(nil)
 }